@@ -0,0 +1,711 @@
+package edc
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Address - structured address of company, siren, hideout or tcc
+// Locality - city, town or village with type abbreviation (г., пгт, с., д., п.)
+// Street   - street with type abbreviation (ул., пр-т, пер., ...)
+// Display  - formatted address, address text fields of objects are kept as typed
+type Address struct {
+	ID        int64  `sql:"id"         json:"id"       form:"id"       query:"id"`
+	Region    string `sql:"region"     json:"region"   form:"region"   query:"region"`
+	District  string `sql:"district"   json:"district" form:"district" query:"district"`
+	Locality  string `sql:"locality"   json:"locality" form:"locality" query:"locality"`
+	Street    string `sql:"street"     json:"street"   form:"street"   query:"street"`
+	House     string `sql:"house"      json:"house"    form:"house"    query:"house"`
+	Building  string `sql:"building"   json:"building" form:"building" query:"building"`
+	Entrance  string `sql:"entrance"   json:"entrance" form:"entrance" query:"entrance"`
+	Display   string `sql:"display"    json:"display"  form:"display"  query:"display"`
+	Version   int64  `sql:"version"    json:"version"  form:"version"  query:"version"`
+	CreatedAt string `sql:"created_at" json:"-"`
+	UpdatedAt string `sql:"updated_at" json:"-"`
+}
+
+// AddressObject - company, siren, hideout or tcc located at address
+type AddressObject struct {
+	Type      string `json:"type"       form:"type"       query:"type"`
+	ID        int64  `json:"id"         form:"id"         query:"id"`
+	Name      string `json:"name"       form:"name"       query:"name"`
+	AddressID int64  `json:"address_id" form:"address_id" query:"address_id"`
+	Address   string `json:"address"    form:"address"    query:"address"`
+}
+
+// AddressGroup - number of objects in district, locality or street
+type AddressGroup struct {
+	Region   string `json:"region"   form:"region"   query:"region"`
+	District string `json:"district" form:"district" query:"district"`
+	Locality string `json:"locality" form:"locality" query:"locality"`
+	Street   string `json:"street"   form:"street"   query:"street"`
+	Objects  int64  `json:"objects"  form:"objects"  query:"objects"`
+}
+
+// addressTypes - type abbreviations of address parts, canonical form first
+var addressTypes = []struct {
+	field string
+	short string
+	words []string
+}{
+	{"region", "обл.", []string{"обл.", "обл", "область"}},
+	{"region", "край", []string{"край"}},
+	{"region", "Респ.", []string{"респ.", "респ", "республика"}},
+	{"district", "р-н", []string{"р-н", "р-он", "район"}},
+	{"district", "м.о.", []string{"м.о.", "мо", "муниципальный округ"}},
+	{"district", "г.о.", []string{"г.о.", "го", "городской округ"}},
+	{"locality", "г.", []string{"г.", "г", "гор.", "город"}},
+	{"locality", "пгт", []string{"пгт.", "пгт", "поселок городского типа", "посёлок городского типа"}},
+	{"locality", "с.", []string{"с.", "с", "село"}},
+	{"locality", "д.", []string{"дер.", "деревня"}},
+	{"locality", "п.", []string{"пос.", "поселок", "посёлок"}},
+	{"locality", "ст.", []string{"ст.", "станция"}},
+	{"locality", "х.", []string{"х.", "хутор"}},
+	{"street", "ул.", []string{"ул.", "ул", "улица"}},
+	{"street", "пр-т", []string{"пр-т", "пр-кт", "просп.", "проспект"}},
+	{"street", "пер.", []string{"пер.", "пер", "переулок"}},
+	{"street", "б-р", []string{"б-р", "бульвар"}},
+	{"street", "наб.", []string{"наб.", "набережная"}},
+	{"street", "ш.", []string{"ш.", "шоссе"}},
+	{"street", "пл.", []string{"пл.", "площадь"}},
+	{"street", "пр-д", []string{"пр-д", "проезд"}},
+	{"street", "мкр", []string{"мкр.", "мкр", "микрорайон"}},
+	{"street", "туп.", []string{"туп.", "тупик"}},
+	{"street", "ал.", []string{"ал.", "аллея"}},
+	{"street", "тракт", []string{"тракт"}},
+}
+
+var (
+	addressPostcode = regexp.MustCompile(`^\d{6}$`)
+	addressHouse    = regexp.MustCompile(`(?i)^(?:д\.|дом|д)?\s*(\d+[\p{L}]?(?:[/-]\d+[\p{L}]?)?)\s*(?:(?:корп\.|корпус|корп|к\.|к)\s*(\S+))?\s*(?:(?:стр\.|строение|стр)\s*(\S+))?$`)
+	addressPart     = regexp.MustCompile(`(?i)^(корп\.|корпус|корп|к\.|стр\.|строение|стр|под\.|подъезд|п-д|п\.)\s*(\S+)$`)
+	addressTail     = regexp.MustCompile(`(?i)^(.*?\S)\s+(?:д\.\s*|дом\s+)?(\d+[\p{L}]?(?:[/-]\d+[\p{L}]?)?(?:\s*(?:корп\.|корп|к\.|к)\s*\S+)?)$`)
+)
+
+// ParseAddress - parse address string like «Тверская обл., Калининский р-н, д. Никулино, ул. Центральная, д. 5, корп. 2, под. 3»
+func ParseAddress(s string) Address {
+	var address Address
+	for _, part := range strings.Split(strings.ReplaceAll(s, ";", ","), ",") {
+		part = strings.Join(strings.Fields(part), " ")
+		if part == "" || addressPostcode.MatchString(part) {
+			continue
+		}
+		if m := addressPart.FindStringSubmatch(part); m != nil && (address.House != "" || !strings.HasPrefix(strings.ToLower(m[1]), "п.")) {
+			addressPartSet(&address, strings.ToLower(m[1]), m[2])
+			continue
+		}
+		if address.House == "" && (address.Street != "" || address.Locality != "") {
+			if m := addressHouse.FindStringSubmatch(part); m != nil {
+				address.House, address.Building = m[1], m[2]
+				if m[3] != "" {
+					address.Building = strings.TrimSpace(address.Building + " стр. " + m[3])
+				}
+				continue
+			}
+		}
+		field, value := addressType(part, address)
+		switch field {
+		case "region":
+			address.Region = value
+		case "district":
+			address.District = value
+		case "locality":
+			address.Locality = value
+		case "street":
+			if m := addressTail.FindStringSubmatch(value); m != nil && address.House == "" {
+				value = m[1]
+				if h := addressHouse.FindStringSubmatch(m[2]); h != nil {
+					address.House, address.Building = h[1], h[2]
+				}
+			}
+			address.Street = value
+		default:
+			switch {
+			case address.Locality == "":
+				address.Locality = value
+			case address.Street == "":
+				address.Street = value
+			}
+		}
+	}
+	address.Display = addressFormat(address)
+	return address
+}
+
+// addressType - detect type of address part by abbreviation at start or end of part
+func addressType(part string, address Address) (string, string) {
+	lower := strings.ToLower(part)
+	for _, t := range addressTypes {
+		for _, word := range t.words {
+			if t.field == "locality" && word == "д." && address.Locality != "" {
+				continue
+			}
+			if strings.HasPrefix(lower, word+" ") || (strings.HasSuffix(word, ".") && strings.HasPrefix(lower, word) && len(lower) > len(word)) {
+				name := strings.TrimSpace(part[len(word):])
+				return t.field, addressJoin(t.field, t.short, name)
+			}
+			if strings.HasSuffix(lower, " "+word) {
+				name := strings.TrimSpace(part[:len(part)-len(word)])
+				return t.field, addressJoin(t.field, t.short, name)
+			}
+		}
+	}
+	if strings.HasPrefix(lower, "д.") && address.Locality == "" {
+		return "locality", addressJoin("locality", "д.", strings.TrimSpace(part[len("д."):]))
+	}
+	return "", part
+}
+
+// addressJoin - name with canonical type abbreviation, region and district types are written after name
+func addressJoin(field, short, name string) string {
+	if field == "region" || field == "district" {
+		return name + " " + short
+	}
+	return short + " " + name
+}
+
+func addressPartSet(address *Address, kind, value string) {
+	switch kind {
+	case "корп.", "корпус", "корп", "к.":
+		address.Building = value
+	case "стр.", "строение", "стр":
+		address.Building = strings.TrimSpace(address.Building + " стр. " + value)
+	default:
+		address.Entrance = value
+	}
+}
+
+// addressFormat - formatted display string of address
+func addressFormat(address Address) string {
+	var parts []string
+	for _, part := range []string{address.Region, address.District, address.Locality, address.Street} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if address.House != "" {
+		parts = append(parts, "д. "+address.House)
+	}
+	if address.Building != "" {
+		if strings.HasPrefix(address.Building, "стр. ") {
+			parts = append(parts, address.Building)
+		} else {
+			parts = append(parts, "корп. "+address.Building)
+		}
+	}
+	if address.Entrance != "" {
+		parts = append(parts, "под. "+address.Entrance)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// AddressGet - get one address by id
+func AddressGet(id int64) (Address, error) {
+	var address Address
+	if id == 0 {
+		return address, nil
+	}
+	address.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			region,
+			district,
+			locality,
+			street,
+			house,
+			building,
+			entrance,
+			display,
+			version,
+			created_at,
+			updated_at
+		FROM
+			addresses
+		WHERE
+			id = $1
+	`, id).Scan(&address.Region, &address.District, &address.Locality, &address.Street, &address.House, &address.Building,
+		&address.Entrance, &address.Display, &address.Version, &address.CreatedAt, &address.UpdatedAt)
+	if err != nil {
+		errmsg("AddressGet QueryRow", err)
+	}
+	return address, err
+}
+
+// AddressListGet - get all addresses for list
+func AddressListGet() ([]Address, error) {
+	var addresses []Address
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			region,
+			district,
+			locality,
+			street,
+			house,
+			building,
+			entrance,
+			display
+		FROM
+			addresses
+		ORDER BY
+			region ASC,
+			district ASC,
+			locality ASC,
+			street ASC,
+			house ASC
+	`)
+	if err != nil {
+		errmsg("AddressListGet Query", err)
+		return addresses, err
+	}
+	for rows.Next() {
+		var address Address
+		err := rows.Scan(&address.ID, &address.Region, &address.District, &address.Locality, &address.Street, &address.House,
+			&address.Building, &address.Entrance, &address.Display)
+		if err != nil {
+			errmsg("AddressListGet Scan", err)
+			return addresses, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+const addressObjects = `
+	WITH objects AS (
+		SELECT 'company' AS type, id, name, address_id FROM companies WHERE address_id <> 0 AND deleted_at IS NULL
+		UNION ALL
+		SELECT 'siren', id, address, address_id FROM sirens WHERE address_id <> 0 AND deleted_at IS NULL
+		UNION ALL
+		SELECT 'hideout', id, address, address_id FROM hideouts WHERE address_id <> 0 AND deleted_at IS NULL
+		UNION ALL
+		SELECT 'tcc', id, address, address_id FROM tccs WHERE address_id <> 0 AND deleted_at IS NULL
+	)
+`
+
+// AddressBuildingGet - get companies, sirens, hideouts and tccs located in the same building as address
+func AddressBuildingGet(id int64) ([]AddressObject, error) {
+	var objects []AddressObject
+	if id == 0 {
+		return objects, nil
+	}
+	rows, err := pool.Query(context.Background(), addressObjects+`
+		SELECT
+			o.type,
+			o.id,
+			COALESCE(o.name, ''),
+			a.id,
+			a.display
+		FROM
+			objects AS o
+		INNER JOIN
+			addresses AS a ON a.id = o.address_id
+		INNER JOIN
+			addresses AS b ON b.id = $1
+		WHERE
+			lower(a.region) = lower(b.region)
+		AND
+			lower(a.district) = lower(b.district)
+		AND
+			lower(a.locality) = lower(b.locality)
+		AND
+			lower(a.street) = lower(b.street)
+		AND
+			lower(a.house) = lower(b.house)
+		AND
+			lower(a.building) = lower(b.building)
+		ORDER BY
+			o.type ASC,
+			o.id ASC
+	`, id)
+	if err != nil {
+		errmsg("AddressBuildingGet Query", err)
+		return objects, err
+	}
+	for rows.Next() {
+		var object AddressObject
+		err := rows.Scan(&object.Type, &object.ID, &object.Name, &object.AddressID, &object.Address)
+		if err != nil {
+			errmsg("AddressBuildingGet Scan", err)
+			return objects, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, rows.Err()
+}
+
+// AddressGroupGet - get number of objects grouped by district, locality and street
+func AddressGroupGet() ([]AddressGroup, error) {
+	var groups []AddressGroup
+	rows, err := pool.Query(context.Background(), addressObjects+`
+		SELECT
+			a.region,
+			a.district,
+			a.locality,
+			a.street,
+			count(*)
+		FROM
+			objects AS o
+		INNER JOIN
+			addresses AS a ON a.id = o.address_id
+		GROUP BY
+			a.region,
+			a.district,
+			a.locality,
+			a.street
+		ORDER BY
+			a.region ASC,
+			a.district ASC,
+			a.locality ASC,
+			a.street ASC
+	`)
+	if err != nil {
+		errmsg("AddressGroupGet Query", err)
+		return groups, err
+	}
+	for rows.Next() {
+		var group AddressGroup
+		err := rows.Scan(&group.Region, &group.District, &group.Locality, &group.Street, &group.Objects)
+		if err != nil {
+			errmsg("AddressGroupGet Scan", err)
+			return groups, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// AddressInsert - create new address, existing address with same parts is reused
+func AddressInsert(address Address) (int64, error) {
+	return AddressInsertCtx(context.Background(), address)
+}
+
+// AddressInsertCtx - AddressInsert with context, actor of context is written to audit log
+func AddressInsertCtx(ctx context.Context, address Address) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("AddressInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	return addressInsert(ctx, tx, address)
+}
+
+// addressInsert - create new address or get id of existing one with same parts inside transaction
+func addressInsert(ctx context.Context, tx pgx.Tx, address Address) (int64, error) {
+	address.Display = addressFormat(address)
+	err := tx.QueryRow(ctx, `
+		SELECT
+			id
+		FROM
+			addresses
+		WHERE
+			region = $1
+		AND
+			district = $2
+		AND
+			locality = $3
+		AND
+			street = $4
+		AND
+			house = $5
+		AND
+			building = $6
+		AND
+			entrance = $7
+		LIMIT 1
+	`, address.Region, address.District, address.Locality, address.Street, address.House, address.Building,
+		address.Entrance).Scan(&address.ID)
+	if err == nil {
+		return address.ID, nil
+	}
+	if err != pgx.ErrNoRows {
+		errmsg("addressInsert QueryRow", err)
+		return 0, err
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO addresses
+		(
+			region,
+			district,
+			locality,
+			street,
+			house,
+			building,
+			entrance,
+			display,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6,
+			$7,
+			$8,
+			$9,
+			$10
+		)
+		RETURNING
+			id
+	`, address.Region, address.District, address.Locality, address.Street, address.House, address.Building, address.Entrance,
+		address.Display, time.Now(), time.Now()).Scan(&address.ID)
+	if err != nil {
+		errmsg("addressInsert Insert", err)
+	}
+	return address.ID, err
+}
+
+// AddressUpdate - save address changes
+func AddressUpdate(address Address) error {
+	return AddressUpdateCtx(context.Background(), address)
+}
+
+// AddressUpdateCtx - AddressUpdate with context, actor of context is written to audit log
+func AddressUpdateCtx(ctx context.Context, address Address) error {
+	address.Display = addressFormat(address)
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("AddressUpdate Begin", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `
+		UPDATE addresses SET
+			region = $2,
+			district = $3,
+			locality = $4,
+			street = $5,
+			house = $6,
+			building = $7,
+			entrance = $8,
+			display = $9,
+			updated_at = $10,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $11
+	`, address.ID, address.Region, address.District, address.Locality, address.Street, address.House, address.Building,
+		address.Entrance, address.Display, time.Now(), address.Version)
+	if err != nil {
+		errmsg("AddressUpdate Exec", err)
+		return err
+	}
+	err = versionCheck("addresses", address.ID, address.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return AddressGet(address.ID)
+	})
+	if err != nil {
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("AddressUpdate Commit", err)
+	}
+	return err
+}
+
+// AddressDelete - delete address by id, objects keep their address strings
+func AddressDelete(id int64) error {
+	return AddressDeleteCtx(context.Background(), id)
+}
+
+// AddressDeleteCtx - AddressDelete with context, actor of context is written to audit log
+func AddressDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("AddressDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	for _, table := range []string{"companies", "sirens", "hideouts", "tccs"} {
+		_, err := tx.Exec(ctx, `
+			UPDATE `+pgx.Identifier{table}.Sanitize()+` SET
+				address_id = 0
+			WHERE
+				address_id = $1
+		`, id)
+		if err != nil {
+			errmsg("AddressDelete "+table, err)
+			return err
+		}
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			addresses
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("AddressDelete Exec", err)
+	}
+	return err
+}
+
+// AddressMigrate - parse address strings of companies, sirens, hideouts and tccs without structured address
+// and link them to addresses, strings are kept as is. Returns number of linked objects.
+func AddressMigrate() (int64, error) {
+	return AddressMigrateCtx(context.Background())
+}
+
+// AddressMigrateCtx - AddressMigrate with context, actor of context is written to audit log
+func AddressMigrateCtx(ctx context.Context) (_ int64, err error) {
+	var count int64
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("AddressMigrate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	for _, table := range []string{"companies", "sirens", "hideouts", "tccs"} {
+		rows, err := tx.Query(ctx, `
+			SELECT
+				id,
+				address
+			FROM
+				`+pgx.Identifier{table}.Sanitize()+`
+			WHERE
+				COALESCE(address_id, 0) = 0
+			AND
+				COALESCE(address, '') <> ''
+			AND
+				deleted_at IS NULL
+		`)
+		if err != nil {
+			errmsg("AddressMigrate Query "+table, err)
+			return count, err
+		}
+		var (
+			ids   []int64
+			texts []string
+		)
+		for rows.Next() {
+			var id int64
+			var text string
+			err := rows.Scan(&id, &text)
+			if err != nil {
+				rows.Close()
+				errmsg("AddressMigrate Scan "+table, err)
+				return count, err
+			}
+			ids = append(ids, id)
+			texts = append(texts, text)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			errmsg("AddressMigrate rows "+table, rows.Err())
+			return count, rows.Err()
+		}
+		for i := range ids {
+			addressID, err := addressResolve(ctx, tx, table, ids[i], texts[i])
+			if err != nil {
+				return count, err
+			}
+			if addressID == 0 {
+				continue
+			}
+			_, err = tx.Exec(ctx, `
+				UPDATE `+pgx.Identifier{table}.Sanitize()+` SET
+					address_id = $2
+				WHERE
+					id = $1
+			`, ids[i], addressID)
+			if err != nil {
+				errmsg("AddressMigrate Exec "+table, err)
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// addressResolve - get id of structured address for address string of object of table inside transaction of
+// object change. Linked address is kept while string is not changed, otherwise string is parsed and stored,
+// id is 0 if it can't be parsed to locality or street.
+func addressResolve(ctx context.Context, tx pgx.Tx, table string, id int64, text string) (int64, error) {
+	if id != 0 {
+		var (
+			current   string
+			addressID int64
+		)
+		err := tx.QueryRow(ctx, `
+			SELECT
+				COALESCE(address, ''),
+				COALESCE(address_id, 0)
+			FROM
+				`+pgx.Identifier{table}.Sanitize()+`
+			WHERE
+				id = $1
+		`, id).Scan(&current, &addressID)
+		if err != nil && err != pgx.ErrNoRows {
+			errmsg("addressResolve QueryRow", err)
+			return 0, err
+		}
+		if addressID != 0 && current == text {
+			return addressID, nil
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return 0, nil
+	}
+	address := ParseAddress(text)
+	if address.Locality == "" && address.Street == "" {
+		return 0, nil
+	}
+	return addressInsert(ctx, tx, address)
+}
+
+// addressLink - resolve address string of object of table and save address id after object change
+// inside its transaction
+func addressLink(ctx context.Context, tx pgx.Tx, table string, id int64, text string) error {
+	addressID, err := addressResolve(ctx, tx, table, id, text)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE `+pgx.Identifier{table}.Sanitize()+` SET
+			address_id = $2
+		WHERE
+			id = $1
+		AND
+			address_id <> $2
+	`, id, addressID)
+	return err
+}
+
+func addressCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			addresses (
+				id         bigserial PRIMARY KEY,
+				region     text NOT NULL DEFAULT '',
+				district   text NOT NULL DEFAULT '',
+				locality   text NOT NULL DEFAULT '',
+				street     text NOT NULL DEFAULT '',
+				house      text NOT NULL DEFAULT '',
+				building   text NOT NULL DEFAULT '',
+				entrance   text NOT NULL DEFAULT '',
+				display    text NOT NULL DEFAULT '',
+				version    bigint NOT NULL DEFAULT 0,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now()
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("addressCreateTable exec", err)
+	}
+	return err
+}
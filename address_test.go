@@ -0,0 +1,71 @@
+package edc
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Address
+	}{
+		{
+			name: "full",
+			in:   "Тверская обл., Калининский р-н, д. Никулино, ул. Центральная, д. 5, корп. 2, под. 3",
+			want: Address{Region: "Тверская обл.", District: "Калининский р-н", Locality: "д. Никулино", Street: "ул. Центральная", House: "5", Building: "2", Entrance: "3"},
+		},
+		{
+			name: "postcode and city",
+			in:   "170100, г. Тверь, ул. Советская, д. 10",
+			want: Address{Locality: "г. Тверь", Street: "ул. Советская", House: "10"},
+		},
+		{
+			name: "house in street part",
+			in:   "г. Тверь, ул. Центральная д. 5",
+			want: Address{Locality: "г. Тверь", Street: "ул. Центральная", House: "5"},
+		},
+		{
+			name: "house word in street part",
+			in:   "г. Тверь, ул. Центральная дом 5",
+			want: Address{Locality: "г. Тверь", Street: "ул. Центральная", House: "5"},
+		},
+		{
+			name: "bare house in street part",
+			in:   "г. Тверь, ул. Ленина 5 к 2",
+			want: Address{Locality: "г. Тверь", Street: "ул. Ленина", House: "5", Building: "2"},
+		},
+		{
+			name: "number in street name",
+			in:   "г. Тверь, ул. 8 Марта 12",
+			want: Address{Locality: "г. Тверь", Street: "ул. 8 Марта", House: "12"},
+		},
+		{
+			name: "type after name",
+			in:   "Тверь город, Советская улица, 10а",
+			want: Address{Locality: "г. Тверь", Street: "ул. Советская", House: "10а"},
+		},
+		{
+			name: "house with building and structure",
+			in:   "г. Тверь, пр-т Чайковского, д. 28/2 корп. 1 стр. 3",
+			want: Address{Locality: "г. Тверь", Street: "пр-т Чайковского", House: "28/2", Building: "1 стр. 3"},
+		},
+		{
+			name: "settlement with entrance",
+			in:   "пгт Радченко, пер. Школьный, 3; п. 2",
+			want: Address{Locality: "пгт Радченко", Street: "пер. Школьный", House: "3", Entrance: "2"},
+		},
+		{
+			name: "unparsed",
+			in:   "за рекой",
+			want: Address{Locality: "за рекой"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseAddress(tt.in)
+			tt.want.Display = addressFormat(tt.want)
+			if got != tt.want {
+				t.Errorf("ParseAddress(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
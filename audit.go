@@ -0,0 +1,343 @@
+package edc
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// AuditInsert, AuditUpdate and AuditDelete - operations of audit log
+const (
+	AuditInsert = "insert"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditLog - record of change of row, written by trigger on every insert, update and delete
+// Actor  - actor of context from WithAuditActor, database user if not set
+// Before - json of changed fields before update or whole deleted row, empty for insert
+// After  - json of changed fields after update or whole inserted row, empty for delete
+type AuditLog struct {
+	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
+	Actor     string `sql:"actor"      json:"actor"      form:"actor"      query:"actor"`
+	Entity    string `sql:"entity"     json:"entity"     form:"entity"     query:"entity"`
+	RecordID  int64  `sql:"record_id"  json:"record_id"  form:"record_id"  query:"record_id"`
+	Operation string `sql:"operation"  json:"operation"  form:"operation"  query:"operation"`
+	Before    string `sql:"before"     json:"before"     form:"before"     query:"before"`
+	After     string `sql:"after"      json:"after"      form:"after"      query:"after"`
+	CreatedAt string `sql:"created_at" json:"created_at" form:"created_at" query:"created_at"`
+}
+
+// auditRecordKeys - field with record id of tables without id, rows of desk_radio_channels are logged under desk
+var auditRecordKeys = map[string]string{
+	"desk_radio_channels": "desk_id",
+}
+
+// auditTables - tables with audit trigger
+var auditTables = []string{
+	"addresses",
+	"certificate_series",
+	"certificates",
+	"companies",
+	"company_go_roles",
+	"contact_assignments",
+	"contacts",
+	"course_members",
+	"course_sessions",
+	"departments",
+	"desk_radio_channels",
+	"desks",
+	"educations",
+	"emails",
+	"hideout_types",
+	"hideouts",
+	"kinds",
+	"phones",
+	"post_trainings",
+	"posts",
+	"practice_frequencies",
+	"practice_participants",
+	"practice_plans",
+	"practices",
+	"radio_channels",
+	"ranks",
+	"scope_go_posts",
+	"scopes",
+	"siren_events",
+	"siren_types",
+	"sirens",
+	"tccs",
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor - context with actor written to audit log by changes made with it,
+// pass it to Ctx variants of insert, update and delete functions
+func WithAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// auditBegin - begin transaction of write, actor of context is set for this transaction only
+func auditBegin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if actor, _ := ctx.Value(auditActorKey{}).(string); actor != "" {
+		_, err = tx.Exec(ctx, `SELECT set_config('edc.actor', $1, true)`, actor)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// auditEnd - commit transaction of write without error, rollback otherwise
+func auditEnd(ctx context.Context, tx pgx.Tx, err *error) {
+	if *err != nil {
+		_ = tx.Rollback(ctx)
+		return
+	}
+	*err = tx.Commit(ctx)
+	if *err != nil {
+		errmsg("auditEnd Commit", *err)
+	}
+}
+
+const auditLogQuery = `
+	SELECT
+		id,
+		actor,
+		entity,
+		record_id,
+		operation,
+		COALESCE(before::text, '') AS before,
+		COALESCE(after::text, '') AS after,
+		created_at::text
+	FROM
+		audit_logs
+`
+
+// AuditRecordGet - get history of record of entity (table name), latest change first
+func AuditRecordGet(entity string, id int64) ([]AuditLog, error) {
+	if id == 0 {
+		return []AuditLog{}, nil
+	}
+	return auditLogList("AuditRecordGet", auditLogQuery+`
+		WHERE
+			entity = $1
+		AND
+			record_id = $2
+		ORDER BY
+			id DESC
+	`, entity, id)
+}
+
+// AuditChildGet - get history of rows of entity linked to record by field, for example
+// AuditChildGet("phones", "company_id", id) shows added and removed phones of company
+func AuditChildGet(entity, field string, id int64) ([]AuditLog, error) {
+	if id == 0 {
+		return []AuditLog{}, nil
+	}
+	return auditLogList("AuditChildGet", auditLogQuery+`
+		WHERE
+			entity = $1
+		AND
+			record_id IN (
+				SELECT
+					record_id
+				FROM
+					audit_logs
+				WHERE
+					entity = $1
+				AND
+					(before->>$2 = $3::bigint::text OR after->>$2 = $3::bigint::text)
+			)
+		ORDER BY
+			id DESC
+	`, entity, field, id)
+}
+
+// AuditListGet - get changes made in period by actor in entity, empty actor or entity for all.
+// Start and end in format 2006-01-02, end is included.
+func AuditListGet(actor, entity, start, end string) ([]AuditLog, error) {
+	return auditLogList("AuditListGet", auditLogQuery+`
+		WHERE
+			($1 = '' OR actor = $1)
+		AND
+			($2 = '' OR entity = $2)
+		AND
+			created_at >= $3::date
+		AND
+			created_at < $4::date + 1
+		ORDER BY
+			id DESC
+	`, actor, entity, start, end)
+}
+
+func auditLogList(name, query string, args ...interface{}) ([]AuditLog, error) {
+	var logs []AuditLog
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		errmsg(name+" Query", err)
+		return logs, err
+	}
+	for rows.Next() {
+		var log AuditLog
+		err := rows.Scan(&log.ID, &log.Actor, &log.Entity, &log.RecordID, &log.Operation, &log.Before, &log.After,
+			&log.CreatedAt)
+		if err != nil {
+			errmsg(name+" Scan", err)
+			return logs, err
+		}
+		logs = append(logs, log)
+	}
+	return logs, rows.Err()
+}
+
+// AuditPurge - delete audit records older than date (format 2006-01-02), returns number of deleted records
+func AuditPurge(date string) (int64, error) {
+	return AuditPurgeCtx(context.Background(), date)
+}
+
+// AuditPurgeCtx - AuditPurge with context, actor of context is written to audit log
+func AuditPurgeCtx(ctx context.Context, date string) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("AuditPurge auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM
+			audit_logs
+		WHERE
+			created_at < $1::date
+	`, date)
+	if err != nil {
+		errmsg("AuditPurge Exec", err)
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// auditTrigger - trigger function writes whole row for insert and delete,
+// only changed fields except updated_at for update. Argument of trigger is field with record id, id by default.
+const auditTrigger = `
+	CREATE OR REPLACE FUNCTION audit_log_trigger() RETURNS trigger AS $$
+	DECLARE
+		old_row    jsonb;
+		new_row    jsonb;
+		before_row jsonb;
+		after_row  jsonb;
+		field      text;
+	BEGIN
+		IF TG_OP <> 'INSERT' THEN
+			old_row := to_jsonb(OLD);
+		END IF;
+		IF TG_OP <> 'DELETE' THEN
+			new_row := to_jsonb(NEW);
+		END IF;
+		IF TG_OP = 'UPDATE' THEN
+			before_row := '{}';
+			after_row := '{}';
+			FOR field IN SELECT jsonb_object_keys(new_row) LOOP
+				IF field <> 'updated_at' AND new_row->field IS DISTINCT FROM old_row->field THEN
+					before_row := before_row || jsonb_build_object(field, old_row->field);
+					after_row := after_row || jsonb_build_object(field, new_row->field);
+				END IF;
+			END LOOP;
+			IF before_row = '{}' THEN
+				RETURN NULL;
+			END IF;
+		ELSE
+			before_row := old_row;
+			after_row := new_row;
+		END IF;
+		INSERT INTO audit_logs
+			(actor, entity, record_id, operation, before, after, created_at)
+		VALUES
+			(
+				COALESCE(NULLIF(current_setting('edc.actor', true), ''), current_user),
+				TG_TABLE_NAME,
+				(COALESCE(new_row, old_row)->>COALESCE(TG_ARGV[0], 'id'))::bigint,
+				lower(TG_OP),
+				before_row,
+				after_row,
+				now()
+			);
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql
+`
+
+func auditCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			audit_logs (
+				id         bigserial PRIMARY KEY,
+				actor      text NOT NULL DEFAULT '',
+				entity     text NOT NULL,
+				record_id  bigint,
+				operation  text NOT NULL,
+				before     jsonb,
+				after      jsonb,
+				created_at TIMESTAMP without time zone default now()
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("auditCreateTable exec", err)
+		return err
+	}
+	_, err = pool.Exec(context.Background(), `
+		CREATE INDEX IF NOT EXISTS
+			audit_logs_record_idx
+		ON
+			audit_logs (entity, record_id)
+	`)
+	if err != nil {
+		errmsg("auditCreateTable index", err)
+		return err
+	}
+	_, err = pool.Exec(context.Background(), auditTrigger)
+	if err != nil {
+		errmsg("auditCreateTable function", err)
+		return err
+	}
+	for _, table := range auditTables {
+		var exists bool
+		err = pool.QueryRow(context.Background(), `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists)
+		if err != nil {
+			errmsg("auditCreateTable to_regclass", err)
+			return err
+		}
+		if !exists {
+			continue
+		}
+		_, err = pool.Exec(context.Background(), `
+			DROP TRIGGER IF EXISTS audit_log ON `+pgx.Identifier{table}.Sanitize())
+		if err != nil {
+			errmsg("auditCreateTable drop trigger "+table, err)
+			return err
+		}
+		var key string
+		if field, ok := auditRecordKeys[table]; ok {
+			key = "'" + field + "'"
+		}
+		_, err = pool.Exec(context.Background(), `
+			CREATE TRIGGER
+				audit_log
+			AFTER INSERT OR UPDATE OR DELETE ON
+				`+pgx.Identifier{table}.Sanitize()+`
+			FOR EACH ROW EXECUTE PROCEDURE
+				audit_log_trigger(`+key+`)
+		`)
+		if err != nil {
+			errmsg("auditCreateTable create trigger "+table, err)
+			return err
+		}
+	}
+	return nil
+}
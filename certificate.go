@@ -3,18 +3,35 @@ package edc
 import (
 	"context"
 	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
 // Certificate - struct for certificate
+// PostID     - post the certificate is issued for
+// Validity   - validity in months, post validity is used if 0
+// ExpiryDate - calculated from cert date and validity if empty
+// SeriesID   - numbering series, number is allocated on create if Num is empty
+// Period     - year of series sequence, 0 if sequence does not restart
+// Seq        - sequence number allocated in series
+// EducationID - education course which produced the certificate
 type Certificate struct {
-	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
-	Num       string `sql:"num"        json:"num"        form:"num"        query:"num"`
-	ContactID int64  `sql:"contact_id" json:"contact_id" form:"contact_id" query:"contact_id"`
-	CompanyID int64  `sql:"company_id" json:"company_id" form:"company_id" query:"company_id"`
-	CertDate  string `sql:"cert_date"  json:"cert_date"  form:"cert_date"  query:"cert_date"`
-	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
-	CreatedAt string `sql:"created_at" json:"-"`
-	UpdatedAt string `sql:"updated_at" json:"-"`
+	ID          int64  `sql:"id"           json:"id"           form:"id"           query:"id"`
+	Num         string `sql:"num"          json:"num"          form:"num"          query:"num"`
+	ContactID   int64  `sql:"contact_id"   json:"contact_id"   form:"contact_id"   query:"contact_id"`
+	CompanyID   int64  `sql:"company_id"   json:"company_id"   form:"company_id"   query:"company_id"`
+	CertDate    string `sql:"cert_date"    json:"cert_date"    form:"cert_date"    query:"cert_date"`
+	PostID      int64  `sql:"post_id"      json:"post_id"      form:"post_id"      query:"post_id"`
+	Validity    int64  `sql:"validity"     json:"validity"     form:"validity"     query:"validity"`
+	ExpiryDate  string `sql:"expiry_date"  json:"expiry_date"  form:"expiry_date"  query:"expiry_date"`
+	SeriesID    int64  `sql:"series_id"    json:"series_id"    form:"series_id"    query:"series_id"`
+	Period      int64  `sql:"period"       json:"period"       form:"period"       query:"period"`
+	Seq         int64  `sql:"seq"          json:"seq"          form:"seq"          query:"seq"`
+	EducationID int64  `sql:"education_id" json:"education_id" form:"education_id" query:"education_id"`
+	Note        string `sql:"note"         json:"note"         form:"note"         query:"note"`
+	Version     int64  `sql:"version"      json:"version"      form:"version"      query:"version"`
+	CreatedAt   string `sql:"created_at"   json:"-"`
+	UpdatedAt   string `sql:"updated_at"   json:"-"`
 }
 
 // CertificateList - struct for certificate list
@@ -26,6 +43,7 @@ type CertificateList struct {
 	CompanyID   int64  `sql:"company_id"   json:"company_id"   form:"company_id"   query:"company_id"`
 	CompanyName string `sql:"company_name" json:"company_name" form:"company_name" query:"company_name"`
 	CertDate    string `sql:"cert_date"    json:"cert_date"    form:"cert_date"    query:"cert_date"`
+	ExpiryDate  string `sql:"expiry_date"  json:"expiry_date"  form:"expiry_date"  query:"expiry_date"`
 	Note        string `sql:"note"         json:"note"         form:"note"         query:"note"`
 }
 
@@ -42,14 +60,24 @@ func CertificateGet(id int64) (Certificate, error) {
 			contact_id,
 			company_id,
 			cert_date,
+			post_id,
+			validity,
+			COALESCE(expiry_date::text, '') AS expiry_date,
+			series_id,
+			period,
+			seq,
+			education_id,
 			note,
+			version,
 			created_at,
 			updated_at
  		FROM
 			certificates
 		WHERE
 			id = $1
-	`, id).Scan(&certificate.Num, &certificate.ContactID, &certificate.CompanyID, &certificate.CertDate, &certificate.Note, &certificate.CreatedAt, &certificate.UpdatedAt)
+	`, id).Scan(&certificate.Num, &certificate.ContactID, &certificate.CompanyID, &certificate.CertDate, &certificate.PostID, &certificate.Validity,
+		&certificate.ExpiryDate, &certificate.SeriesID, &certificate.Period, &certificate.Seq, &certificate.EducationID, &certificate.Note,
+		&certificate.Version, &certificate.CreatedAt, &certificate.UpdatedAt)
 	if err != nil {
 		errmsg("CertificateGet QueryRow", err)
 	}
@@ -68,6 +96,7 @@ func CertificateListGet() ([]CertificateList, error) {
 			c.company_id,
 			co.name AS company_name,
 			c.cert_date,
+			COALESCE(c.expiry_date::text, '') AS expiry_date,
 			c.note
 		FROM
 			certificates AS c
@@ -75,6 +104,8 @@ func CertificateListGet() ([]CertificateList, error) {
 			contacts AS p ON c.contact_id = p.id
 		LEFT JOIN
 			companies AS co ON c.company_id = co.id
+		WHERE
+			c.deleted_at IS NULL
 		GROUP BY
 			c.id,
 			p.name,
@@ -87,7 +118,7 @@ func CertificateListGet() ([]CertificateList, error) {
 	}
 	for rows.Next() {
 		var certificate CertificateList
-		err := rows.Scan(&certificate.ID, &certificate.Num, &certificate.ContactID, &certificate.ContactName, &certificate.CompanyID, &certificate.CompanyName, &certificate.CertDate, &certificate.Note)
+		err := rows.Scan(&certificate.ID, &certificate.Num, &certificate.ContactID, &certificate.ContactName, &certificate.CompanyID, &certificate.CompanyName, &certificate.CertDate, &certificate.ExpiryDate, &certificate.Note)
 		if err != nil {
 			errmsg("CertificateListGet Scan", err)
 			return certificates, err
@@ -97,15 +128,59 @@ func CertificateListGet() ([]CertificateList, error) {
 	return certificates, rows.Err()
 }
 
-// CertificateCreate - create new certificate
+// CertificateCreate - create new certificate, number is allocated from series if empty
 func CertificateCreate(certificate Certificate) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return CertificateCreateCtx(context.Background(), certificate)
+}
+
+// CertificateCreateCtx - CertificateCreate with context, actor of context is written to audit log
+func CertificateCreateCtx(ctx context.Context, certificate Certificate) (int64, error) {
+	err := certificateExpiry(&certificate)
+	if err != nil {
+		errmsg("CertificateCreate certificateExpiry", err)
+		return 0, err
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CertificateCreate Begin", err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	err = certificateInsert(tx, &certificate)
+	if err != nil {
+		errmsg("CertificateCreate certificateInsert", err)
+		return 0, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("CertificateCreate Commit", err)
+		return 0, err
+	}
+	return certificate.ID, nil
+}
+
+// certificateInsert - insert certificate inside transaction, number is allocated from series if empty
+func certificateInsert(tx pgx.Tx, certificate *Certificate) error {
+	if certificate.Num == "" && certificate.SeriesID != 0 {
+		err := certificateNumAllocate(tx, certificate)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.QueryRow(context.Background(), `
 		INSERT INTO certificates
 		(
 			num,
 			contact_id,
 			company_id,
 			cert_date,
+			post_id,
+			validity,
+			expiry_date,
+			series_id,
+			period,
+			seq,
+			education_id,
 			note,
 			created_at,
 			updated_at
@@ -118,7 +193,14 @@ func CertificateCreate(certificate Certificate) (int64, error) {
 			$4,
 			$5,
 			$6,
-			$7
+			NULLIF($7, '')::date,
+			$8,
+			$9,
+			$10,
+			$11,
+			$12,
+			$13,
+			$14
 		)
 		RETURNING
 			id
@@ -126,45 +208,231 @@ func CertificateCreate(certificate Certificate) (int64, error) {
 		certificate.ContactID,
 		certificate.CompanyID,
 		certificate.CertDate,
+		certificate.PostID,
+		certificate.Validity,
+		certificate.ExpiryDate,
+		certificate.SeriesID,
+		certificate.Period,
+		certificate.Seq,
+		certificate.EducationID,
 		certificate.Note,
 		time.Now(),
 		time.Now()).Scan(&certificate.ID)
-	if err != nil {
-		errmsg("CertificateCreate QueryRow", err)
-	}
-	return certificate.ID, nil
 }
 
 // CertificateUpdate - save certificate changes
 func CertificateUpdate(certificate Certificate) error {
-	_, err := pool.Exec(context.Background(), `
+	return CertificateUpdateCtx(context.Background(), certificate)
+}
+
+// CertificateUpdateCtx - CertificateUpdate with context, actor of context is written to audit log
+func CertificateUpdateCtx(ctx context.Context, certificate Certificate) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CertificateUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = certificateExpiry(&certificate)
+	if err != nil {
+		errmsg("CertificateUpdate certificateExpiry", err)
+		return err
+	}
+	tag, err := tx.Exec(ctx, `
 		UPDATE certificates SET
 			num = $2,
 			contact_id = $3,
 			company_id = $4,
 			cert_date = $5,
-			note = $6,
-			updated_at = $7
+			post_id = $6,
+			validity = $7,
+			expiry_date = NULLIF($8, '')::date,
+			education_id = $9,
+			note = $10,
+			updated_at = $11,
+			version = version + 1
 		WHERE
 			id = $1
+		AND
+			version = $12
 	`, certificate.ID, certificate.Num,
 		certificate.ContactID,
 		certificate.CompanyID,
 		certificate.CertDate,
+		certificate.PostID,
+		certificate.Validity,
+		certificate.ExpiryDate,
+		certificate.EducationID,
 		certificate.Note,
-		time.Now())
+		time.Now(),
+		certificate.Version)
 	if err != nil {
 		errmsg("CertificateUpdate Exec", err)
+		return err
 	}
-	return err
+	return versionCheck("certificates", certificate.ID, certificate.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return CertificateGet(certificate.ID)
+	})
+}
+
+// CertificateExpiringGet - get all certificates expiring within days from today
+func CertificateExpiringGet(days int64) ([]CertificateList, error) {
+	var certificates []CertificateList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			c.id,
+			c.num,
+			c.contact_id,
+			p.name AS contact_name,
+			c.company_id,
+			co.name AS company_name,
+			COALESCE(c.cert_date::text, '') AS cert_date,
+			COALESCE(c.expiry_date::text, '') AS expiry_date,
+			c.note
+		FROM
+			certificates AS c
+		LEFT JOIN
+			contacts AS p ON c.contact_id = p.id
+		LEFT JOIN
+			companies AS co ON c.company_id = co.id
+		WHERE
+			c.deleted_at IS NULL
+		AND
+			c.expiry_date BETWEEN current_date AND current_date + $1::int
+		ORDER BY
+			c.expiry_date ASC
+	`, days)
+	if err != nil {
+		errmsg("CertificateExpiringGet Query", err)
+		return certificates, err
+	}
+	for rows.Next() {
+		var certificate CertificateList
+		err := rows.Scan(&certificate.ID, &certificate.Num, &certificate.ContactID, &certificate.ContactName, &certificate.CompanyID,
+			&certificate.CompanyName, &certificate.CertDate, &certificate.ExpiryDate, &certificate.Note)
+		if err != nil {
+			errmsg("CertificateExpiringGet Scan", err)
+			return certificates, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, rows.Err()
+}
+
+// CertificateLapsedGet - get last certificates of company contacts which have expired
+func CertificateLapsedGet(id int64) ([]CertificateList, error) {
+	var certificates []CertificateList
+	if id == 0 {
+		return certificates, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			num,
+			contact_id,
+			contact_name,
+			company_id,
+			company_name,
+			COALESCE(cert_date::text, '') AS cert_date,
+			COALESCE(expiry_date::text, '') AS expiry_date,
+			note
+		FROM (
+			SELECT DISTINCT ON (c.contact_id)
+				c.id,
+				c.num,
+				c.contact_id,
+				p.name AS contact_name,
+				p.company_id,
+				co.name AS company_name,
+				c.cert_date,
+				c.expiry_date,
+				c.note
+			FROM
+				certificates AS c
+			INNER JOIN
+				contacts AS p ON c.contact_id = p.id
+			LEFT JOIN
+				companies AS co ON p.company_id = co.id
+			WHERE
+				p.company_id = $1
+			AND
+				c.deleted_at IS NULL
+			AND
+				p.deleted_at IS NULL
+			ORDER BY
+				c.contact_id,
+				c.expiry_date DESC NULLS FIRST
+		) AS l
+		WHERE
+			expiry_date < current_date
+		ORDER BY
+			contact_name ASC
+	`, id)
+	if err != nil {
+		errmsg("CertificateLapsedGet Query", err)
+		return certificates, err
+	}
+	for rows.Next() {
+		var certificate CertificateList
+		err := rows.Scan(&certificate.ID, &certificate.Num, &certificate.ContactID, &certificate.ContactName, &certificate.CompanyID,
+			&certificate.CompanyName, &certificate.CertDate, &certificate.ExpiryDate, &certificate.Note)
+		if err != nil {
+			errmsg("CertificateLapsedGet Scan", err)
+			return certificates, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, rows.Err()
+}
+
+// certificateExpiry - set validity from post and calculate expiry date
+func certificateExpiry(certificate *Certificate) error {
+	if certificate.Validity == 0 && certificate.PostID != 0 {
+		err := pool.QueryRow(context.Background(), `
+			SELECT
+				validity
+			FROM
+				posts
+			WHERE
+				id = $1
+		`, certificate.PostID).Scan(&certificate.Validity)
+		if err != nil && err != pgx.ErrNoRows {
+			return err
+		}
+	}
+	if certificate.ExpiryDate != "" || certificate.Validity == 0 {
+		return nil
+	}
+	date, err := time.Parse("2006-01-02", certificate.CertDate)
+	if err != nil {
+		return nil
+	}
+	certificate.ExpiryDate = date.AddDate(0, int(certificate.Validity), 0).Format("2006-01-02")
+	return nil
 }
 
-// CertificateDelete - delete certificate by id
+// CertificateDelete - move certificate to trash
 func CertificateDelete(id int64) error {
+	return CertificateDeleteCtx(context.Background(), id)
+}
+
+// CertificateDeleteCtx - CertificateDelete with context, actor of context is written to audit log
+func CertificateDeleteCtx(ctx context.Context, id int64) error {
+	return trashDelete(ctx, "certificates", id)
+}
+
+// certificatePurge - delete certificate by id with child rows
+func certificatePurge(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("certificatePurge auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			certificates
 		WHERE
@@ -185,7 +453,16 @@ func certificateCreateTable() error {
 				contact_id BIGINT,
 				company_id BIGINT,
 				cert_date DATE,
+				post_id BIGINT NOT NULL DEFAULT 0,
+				validity BIGINT NOT NULL DEFAULT 0,
+				expiry_date DATE,
+				series_id BIGINT NOT NULL DEFAULT 0,
+				period BIGINT NOT NULL DEFAULT 0,
+				seq BIGINT NOT NULL DEFAULT 0,
+				education_id BIGINT NOT NULL DEFAULT 0,
 				note TEXT,
+				deleted_at TIMESTAMP without time zone,
+				version BIGINT NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
 				UNIQUE(num)
@@ -0,0 +1,468 @@
+package edc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// CertificateSeries - numbering sequence of certificates
+// Pattern - number format, {year} and {yy} are replaced by year of certificate,
+// {seq} by sequence number, {seq:04} by sequence number padded with zeros.
+// Sequence restarts every year if pattern contains year.
+type CertificateSeries struct {
+	ID        int64  `sql:"id"         json:"id"      form:"id"      query:"id"`
+	Name      string `sql:"name"       json:"name"    form:"name"    query:"name"`
+	Pattern   string `sql:"pattern"    json:"pattern" form:"pattern" query:"pattern"`
+	Note      string `sql:"note"       json:"note"    form:"note"    query:"note"`
+	Version   int64  `sql:"version"    json:"version" form:"version" query:"version"`
+	CreatedAt string `sql:"created_at" json:"-"`
+	UpdatedAt string `sql:"updated_at" json:"-"`
+}
+
+// CertificateSeriesList - struct for certificate series list
+type CertificateSeriesList struct {
+	ID      int64  `sql:"id"      json:"id"      form:"id"      query:"id"`
+	Name    string `sql:"name"    json:"name"    form:"name"    query:"name"`
+	Pattern string `sql:"pattern" json:"pattern" form:"pattern" query:"pattern"`
+	Note    string `sql:"note"    json:"note"    form:"note"    query:"note"`
+}
+
+// CertificateAudit - gaps and duplicates in certificate register
+type CertificateAudit struct {
+	SeriesID   int64                  `json:"series_id"  form:"series_id"  query:"series_id"`
+	Gaps       []CertificateGap       `json:"gaps"       form:"gaps"       query:"gaps"`
+	Duplicates []CertificateDuplicate `json:"duplicates" form:"duplicates" query:"duplicates"`
+}
+
+// CertificateGap - range of allocated sequence numbers without certificates
+type CertificateGap struct {
+	Period  int64  `json:"period"   form:"period"   query:"period"`
+	From    int64  `json:"from"     form:"from"     query:"from"`
+	To      int64  `json:"to"       form:"to"       query:"to"`
+	FromNum string `json:"from_num" form:"from_num" query:"from_num"`
+	ToNum   string `json:"to_num"   form:"to_num"   query:"to_num"`
+}
+
+// CertificateDuplicate - certificates with same number ignoring case and spaces
+// or with same sequence number in series
+type CertificateDuplicate struct {
+	Num  string   `json:"num"  form:"num"  query:"num"`
+	IDs  []int64  `json:"ids"  form:"ids"  query:"ids"`
+	Nums []string `json:"nums" form:"nums" query:"nums"`
+}
+
+var certificateSeqRe = regexp.MustCompile(`\{seq(?::(\d+))?\}`)
+
+// CertificateSeriesGet - get one certificate series by id
+func CertificateSeriesGet(id int64) (CertificateSeries, error) {
+	var series CertificateSeries
+	if id == 0 {
+		return series, nil
+	}
+	series.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			name,
+			pattern,
+			note,
+			version,
+			created_at,
+			updated_at
+		FROM
+			certificate_series
+		WHERE
+			id = $1
+	`, id).Scan(&series.Name, &series.Pattern, &series.Note, &series.Version, &series.CreatedAt, &series.UpdatedAt)
+	if err != nil {
+		errmsg("CertificateSeriesGet QueryRow", err)
+	}
+	return series, err
+}
+
+// CertificateSeriesListGet - get all certificate series for list
+func CertificateSeriesListGet() ([]CertificateSeriesList, error) {
+	var seriesList []CertificateSeriesList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			name,
+			pattern,
+			note
+		FROM
+			certificate_series
+		ORDER BY
+			name ASC
+	`)
+	if err != nil {
+		errmsg("CertificateSeriesListGet Query", err)
+		return seriesList, err
+	}
+	for rows.Next() {
+		var series CertificateSeriesList
+		err := rows.Scan(&series.ID, &series.Name, &series.Pattern, &series.Note)
+		if err != nil {
+			errmsg("CertificateSeriesListGet Scan", err)
+			return seriesList, err
+		}
+		seriesList = append(seriesList, series)
+	}
+	return seriesList, rows.Err()
+}
+
+// CertificateSeriesSelectGet - get all certificate series for select
+func CertificateSeriesSelectGet() ([]SelectItem, error) {
+	var seriesList []SelectItem
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			name
+		FROM
+			certificate_series
+		ORDER BY
+			name ASC
+	`)
+	if err != nil {
+		errmsg("CertificateSeriesSelectGet Query", err)
+		return seriesList, err
+	}
+	for rows.Next() {
+		var series SelectItem
+		err := rows.Scan(&series.ID, &series.Name)
+		if err != nil {
+			errmsg("CertificateSeriesSelectGet Scan", err)
+			return seriesList, err
+		}
+		seriesList = append(seriesList, series)
+	}
+	return seriesList, rows.Err()
+}
+
+// CertificateSeriesInsert - create new certificate series
+func CertificateSeriesInsert(series CertificateSeries) (int64, error) {
+	return CertificateSeriesInsertCtx(context.Background(), series)
+}
+
+// CertificateSeriesInsertCtx - CertificateSeriesInsert with context, actor of context is written to audit log
+func CertificateSeriesInsertCtx(ctx context.Context, series CertificateSeries) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CertificateSeriesInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO certificate_series
+		(
+			name,
+			pattern,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5
+		)
+		RETURNING
+			id
+	`, series.Name, series.Pattern, series.Note, time.Now(), time.Now()).Scan(&series.ID)
+	if err != nil {
+		errmsg("CertificateSeriesInsert QueryRow", err)
+	}
+	return series.ID, err
+}
+
+// CertificateSeriesUpdate - save certificate series changes
+func CertificateSeriesUpdate(series CertificateSeries) error {
+	return CertificateSeriesUpdateCtx(context.Background(), series)
+}
+
+// CertificateSeriesUpdateCtx - CertificateSeriesUpdate with context, actor of context is written to audit log
+func CertificateSeriesUpdateCtx(ctx context.Context, series CertificateSeries) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CertificateSeriesUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		UPDATE certificate_series SET
+			name = $2,
+			pattern = $3,
+			note = $4,
+			updated_at = $5,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $6
+	`, series.ID, series.Name, series.Pattern, series.Note, time.Now(), series.Version)
+	if err != nil {
+		errmsg("CertificateSeriesUpdate Exec", err)
+		return err
+	}
+	return versionCheck("certificate_series", series.ID, series.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return CertificateSeriesGet(series.ID)
+	})
+}
+
+// CertificateSeriesDelete - delete certificate series by id
+func CertificateSeriesDelete(id int64) error {
+	return CertificateSeriesDeleteCtx(context.Background(), id)
+}
+
+// CertificateSeriesDeleteCtx - CertificateSeriesDelete with context, actor of context is written to audit log
+func CertificateSeriesDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CertificateSeriesDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			certificate_series
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("CertificateSeriesDelete Exec", err)
+	}
+	return err
+}
+
+// certificateNumAllocate - allocate next number of series for certificate inside transaction
+func certificateNumAllocate(tx pgx.Tx, certificate *Certificate) error {
+	var pattern string
+	err := tx.QueryRow(context.Background(), `
+		SELECT
+			pattern
+		FROM
+			certificate_series
+		WHERE
+			id = $1
+	`, certificate.SeriesID).Scan(&pattern)
+	if err != nil {
+		return err
+	}
+	year := time.Now().Year()
+	if date, err := time.Parse("2006-01-02", certificate.CertDate); err == nil {
+		year = date.Year()
+	}
+	certificate.Period = 0
+	if strings.Contains(pattern, "{year}") || strings.Contains(pattern, "{yy}") {
+		certificate.Period = int64(year)
+	}
+	err = tx.QueryRow(context.Background(), `
+		INSERT INTO certificate_series_counters
+		(
+			series_id,
+			period,
+			value
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			1
+		)
+		ON CONFLICT (series_id, period) DO UPDATE SET
+			value = certificate_series_counters.value + 1
+		RETURNING
+			value
+	`, certificate.SeriesID, certificate.Period).Scan(&certificate.Seq)
+	if err != nil {
+		return err
+	}
+	certificate.Num = certificateNumFormat(pattern, year, certificate.Seq)
+	return nil
+}
+
+// certificateNumFormat - format certificate number by series pattern
+func certificateNumFormat(pattern string, year int, seq int64) string {
+	num := strings.NewReplacer(
+		"{year}", strconv.Itoa(year),
+		"{yy}", fmt.Sprintf("%02d", year%100),
+	).Replace(pattern)
+	num = certificateSeqRe.ReplaceAllStringFunc(num, func(s string) string {
+		width := certificateSeqRe.FindStringSubmatch(s)[1]
+		if width == "" {
+			return strconv.FormatInt(seq, 10)
+		}
+		w, _ := strconv.Atoi(width)
+		return fmt.Sprintf("%0*d", w, seq)
+	})
+	if !certificateSeqRe.MatchString(pattern) {
+		num += strconv.FormatInt(seq, 10)
+	}
+	return num
+}
+
+// CertificateAuditGet - get gaps and duplicates of certificate numbers, id 0 for all series
+// Certificates in trash are not counted, their numbers are reported as gaps
+func CertificateAuditGet(id int64) (CertificateAudit, error) {
+	audit := CertificateAudit{SeriesID: id}
+	var pattern string
+	if id != 0 {
+		series, err := CertificateSeriesGet(id)
+		if err != nil {
+			errmsg("CertificateAuditGet CertificateSeriesGet", err)
+			return audit, err
+		}
+		pattern = series.Pattern
+		rows, err := pool.Query(context.Background(), `
+			SELECT
+				n.period,
+				g.seq
+			FROM
+				certificate_series_counters AS n
+			CROSS JOIN LATERAL
+				generate_series(1, n.value) AS g(seq)
+			WHERE
+				n.series_id = $1
+			AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					certificates AS c
+				WHERE
+					c.series_id = n.series_id
+				AND
+					c.period = n.period
+				AND
+					c.seq = g.seq
+				AND
+					c.deleted_at IS NULL
+			)
+			ORDER BY
+				n.period ASC,
+				g.seq ASC
+		`, id)
+		if err != nil {
+			errmsg("CertificateAuditGet gaps Query", err)
+			return audit, err
+		}
+		for rows.Next() {
+			var period, seq int64
+			err := rows.Scan(&period, &seq)
+			if err != nil {
+				errmsg("CertificateAuditGet gaps Scan", err)
+				return audit, err
+			}
+			last := len(audit.Gaps) - 1
+			if last >= 0 && audit.Gaps[last].Period == period && audit.Gaps[last].To == seq-1 {
+				audit.Gaps[last].To = seq
+				continue
+			}
+			audit.Gaps = append(audit.Gaps, CertificateGap{Period: period, From: seq, To: seq})
+		}
+		if err := rows.Err(); err != nil {
+			errmsg("CertificateAuditGet gaps Rows", err)
+			return audit, err
+		}
+		for i := range audit.Gaps {
+			year := int(audit.Gaps[i].Period)
+			audit.Gaps[i].FromNum = certificateNumFormat(pattern, year, audit.Gaps[i].From)
+			audit.Gaps[i].ToNum = certificateNumFormat(pattern, year, audit.Gaps[i].To)
+		}
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			min(num) AS num,
+			array_agg(id ORDER BY id) AS ids,
+			array_agg(num ORDER BY id) AS nums
+		FROM
+			certificates
+		WHERE
+			deleted_at IS NULL
+		AND
+			($1::bigint = 0 OR series_id = $1)
+		GROUP BY
+			lower(regexp_replace(num, '\s', '', 'g'))
+		HAVING
+			count(*) > 1
+		UNION ALL
+		SELECT
+			min(num) AS num,
+			array_agg(id ORDER BY id) AS ids,
+			array_agg(num ORDER BY id) AS nums
+		FROM
+			certificates
+		WHERE
+			deleted_at IS NULL
+		AND
+			seq > 0
+		AND
+			($1::bigint = 0 OR series_id = $1)
+		GROUP BY
+			series_id,
+			period,
+			seq
+		HAVING
+			count(*) > 1
+		ORDER BY
+			num ASC
+	`, id)
+	if err != nil {
+		errmsg("CertificateAuditGet duplicates Query", err)
+		return audit, err
+	}
+	for rows.Next() {
+		var duplicate CertificateDuplicate
+		err := rows.Scan(&duplicate.Num, &duplicate.IDs, &duplicate.Nums)
+		if err != nil {
+			errmsg("CertificateAuditGet duplicates Scan", err)
+			return audit, err
+		}
+		audit.Duplicates = append(audit.Duplicates, duplicate)
+	}
+	return audit, rows.Err()
+}
+
+func certificateSeriesCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			certificate_series (
+				id         bigserial PRIMARY KEY,
+				name       text,
+				pattern    text,
+				note       text,
+				version    bigint NOT NULL DEFAULT 0,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now(),
+				UNIQUE(name)
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("certificateSeriesCreateTable exec", err)
+		return err
+	}
+	str = `
+		CREATE TABLE IF NOT EXISTS
+			certificate_series_counters (
+				series_id bigint,
+				period    bigint,
+				value     bigint NOT NULL DEFAULT 0,
+				PRIMARY KEY(series_id, period)
+			)
+	`
+	_, err = pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("certificateSeriesCreateTable counters exec", err)
+	}
+	return err
+}
@@ -2,62 +2,117 @@ package edc
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
+// ErrCompanyCycle - company can't be parent of itself or of its ancestor
+var ErrCompanyCycle = errors.New("company parent makes cycle")
+
 // Company is struct for company
+// ParentID - parent company of branch, 0 for top level company
+// Children - direct branches of company
 type Company struct {
-	ID        int64          `sql:"id"         json:"id"        form:"id"        query:"id"`
-	Name      string         `sql:"name"       json:"name"      form:"name"      query:"name"`
-	Address   string         `sql:"address"    json:"address"   form:"address"   query:"address"`
-	ScopeID   int64          `sql:"scope_id"   json:"scope_id"  form:"scope_id"  query:"scope_id"`
-	Note      string         `sql:"note"       json:"note"      form:"note"      query:"note"`
+	ID        int64          `sql:"id"         json:"id"         form:"id"         query:"id"`
+	Name      string         `sql:"name"       json:"name"       form:"name"       query:"name"`
+	Address   string         `sql:"address"    json:"address"    form:"address"    query:"address"`
+	AddressID int64          `sql:"address_id" json:"address_id" form:"address_id" query:"address_id"`
+	Latitude  string         `sql:"latitude"   json:"latitude"   form:"latitude"   query:"latitude"`
+	Longitude string         `sql:"longitude"  json:"longitude"  form:"longitude"  query:"longitude"`
+	ScopeID   int64          `sql:"scope_id"   json:"scope_id"   form:"scope_id"   query:"scope_id"`
+	ParentID  int64          `sql:"parent_id"  json:"parent_id"  form:"parent_id"  query:"parent_id"`
+	Note      string         `sql:"note"       json:"note"       form:"note"       query:"note"`
+	Version   int64          `sql:"version"    json:"version"    form:"version"    query:"version"`
 	CreatedAt string         `sql:"created_at" json:"-"`
 	UpdatedAt string         `sql:"updated_at" json:"-"`
-	Emails    []string       `sql:"-"          json:"emails"    form:"emails"    query:"emails"`
-	Phones    []int64        `sql:"-"          json:"phones"    form:"phones"    query:"phones"`
-	Faxes     []int64        `sql:"-"          json:"faxes"     form:"faxes"     query:"faxes"`
-	Practices []PracticeList `sql:"-"          json:"practices" form:"practices" query:"practices"`
-	Contacts  []ContactShort `sql:"-"          json:"contacts"  form:"contacts"  query:"contacts"`
+	Emails    []string       `sql:"-"          json:"emails"     form:"emails"     query:"emails"`
+	Phones    []int64        `sql:"-"          json:"phones"     form:"phones"     query:"phones"`
+	Faxes     []int64        `sql:"-"          json:"faxes"      form:"faxes"      query:"faxes"`
+	Practices []PracticeList `sql:"-"          json:"practices"  form:"practices"  query:"practices"`
+	Contacts  []ContactShort `sql:"-"          json:"contacts"   form:"contacts"   query:"contacts"`
+	Children  []CompanyList  `sql:"-"          json:"children"   form:"children"   query:"children"`
 }
 
 // CompanyList is struct for list company
+// Children - number of direct branches
+// Contacts - number of contacts of company or of whole subtree
 type CompanyList struct {
-	ID        int64    `json:"id"         form:"id"         query:"id"`
-	Name      string   `json:"name"       form:"name"       query:"name"`
-	Address   string   `json:"address"    form:"address"    query:"address"`
-	ScopeName string   `json:"scope_name" form:"scope_name" query:"scope_name"`
-	Emails    []string `json:"emails"     form:"emails"     query:"emails"      pg:",array"`
-	Phones    []int64  `json:"phones"     form:"phones"     query:"phones"      pg:",array"`
-	Faxes     []int64  `json:"faxes"      form:"faxes"      query:"faxes"       pg:",array"`
-	Practices []string `json:"practices"  form:"practices"  query:"practices"   pg:",array"`
+	ID         int64    `json:"id"          form:"id"          query:"id"`
+	Name       string   `json:"name"        form:"name"        query:"name"`
+	Address    string   `json:"address"     form:"address"     query:"address"`
+	ScopeName  string   `json:"scope_name"  form:"scope_name"  query:"scope_name"`
+	ParentID   int64    `json:"parent_id"   form:"parent_id"   query:"parent_id"`
+	ParentName string   `json:"parent_name" form:"parent_name" query:"parent_name"`
+	Children   int64    `json:"children"    form:"children"    query:"children"`
+	Contacts   int64    `json:"contacts"    form:"contacts"    query:"contacts"`
+	Emails     []string `json:"emails"      form:"emails"      query:"emails"      pg:",array"`
+	Phones     []int64  `json:"phones"      form:"phones"      query:"phones"      pg:",array"`
+	Faxes      []int64  `json:"faxes"       form:"faxes"       query:"faxes"       pg:",array"`
+	Practices  []string `json:"practices"   form:"practices"   query:"practices"   pg:",array"`
+}
+
+// CompanyTree - company with branches
+type CompanyTree struct {
+	ID       int64         `json:"id"        form:"id"        query:"id"`
+	Name     string        `json:"name"      form:"name"      query:"name"`
+	ParentID int64         `json:"parent_id" form:"parent_id" query:"parent_id"`
+	Level    int64         `json:"level"     form:"level"     query:"level"`
+	Children []CompanyTree `json:"children"  form:"children"  query:"children"`
 }
 
-// CompanyGet - get one company by id
+// companySubtree - ids of company and all its branches
+const companySubtree = `
+	WITH RECURSIVE subtree AS (
+		SELECT
+			id
+		FROM
+			companies
+		WHERE
+			id = $1
+		UNION
+		SELECT
+			c.id
+		FROM
+			companies AS c
+		INNER JOIN
+			subtree AS s ON c.parent_id = s.id
+	)
+`
+
+// CompanyGet - get one company by id with its practices, contacts and branches
 func CompanyGet(id int64) (Company, error) {
+	return companyGet("CompanyGet", id, false)
+}
+
+// CompanySubtreeGet - get one company by id with its branches, practices and contacts of company and all its branches
+func CompanySubtreeGet(id int64) (Company, error) {
+	return companyGet("CompanySubtreeGet", id, true)
+}
+
+func companyGet(name string, id int64, subtree bool) (Company, error) {
 	var company Company
 	if id == 0 {
 		return company, nil
 	}
-	var (
-		emails    []string
-		phones    []int64
-		faxes     []int64
-		practices []PracticeList
-		contacts  []ContactShort
-	)
 	company.ID = id
 	err := pool.QueryRow(context.Background(), `
 		SELECT
 			c.name,
 			c.address,
+			c.address_id,
+			c.latitude,
+			c.longitude,
 			c.scope_id,
+			c.parent_id,
 			c.note,
+			c.version,
 			c.created_at,
 			c.updated_at,
-			array_agg(DISTINCT e.email) AS emails,
-			array_agg(DISTINCT ph.phone) AS phones,
-			array_agg(DISTINCT f.phone) AS faxes
+			array_remove(array_agg(DISTINCT e.email), NULL) AS emails,
+			array_remove(array_agg(DISTINCT ph.phone), NULL) AS phones,
+			array_remove(array_agg(DISTINCT f.phone), NULL) AS faxes
 		FROM
 			companies AS c
 		LEFT JOIN
@@ -70,47 +125,77 @@ func CompanyGet(id int64) (Company, error) {
 			c.id = $1
 		GROUP BY
 			c.id
-	`, id).Scan(&company.Name, &company.Address, &company.ScopeID, &company.Note, &company.CreatedAt, &company.UpdatedAt, &emails,
-		&phones,
-		&faxes,
-		&practices,
-		&contacts)
+	`, id).Scan(&company.Name, &company.Address, &company.AddressID, &company.Latitude, &company.Longitude, &company.ScopeID,
+		&company.ParentID, &company.Note, &company.Version, &company.CreatedAt, &company.UpdatedAt, &company.Emails, &company.Phones,
+		&company.Faxes)
 	if err != nil {
-		errmsg("GetCompany QueryRow", err)
+		errmsg(name+" QueryRow", err)
 		return company, err
 	}
-	practices, err = PracticeCompanyGet(id)
+	company.Practices, err = practiceCompanyQuery(name, id, subtree)
 	if err != nil {
-		errmsg("PracticeCompanyGet", err)
 		return company, err
 	}
-	company.Practices = practices
-	contacts, err = ContactCompanyGet(id)
+	company.Contacts, err = contactCompanyQuery(name, id, subtree)
 	if err != nil {
-		errmsg("ContactCompanyGet", err)
 		return company, err
 	}
-	company.Contacts = contacts
+	company.Children, err = companyListQuery(name, id, false)
 	return company, err
 }
 
-// CompanyListGet - get all companyes for list
+// CompanyListGet - get all companies for list
 func CompanyListGet() ([]CompanyList, error) {
+	return companyListQuery("CompanyListGet", -1, false)
+}
+
+// CompanyListSubtreeGet - get all companies for list, practices and contacts are aggregated across branches
+func CompanyListSubtreeGet() ([]CompanyList, error) {
+	return companyListQuery("CompanyListSubtreeGet", -1, true)
+}
+
+// companyListQuery - get companies with parent, -1 for all companies, subtree aggregates practices and contacts of branches
+func companyListQuery(name string, parentID int64, subtree bool) ([]CompanyList, error) {
 	var companies []CompanyList
 	rows, err := pool.Query(context.Background(), `
+		WITH RECURSIVE tree AS (
+			SELECT
+				id AS root_id,
+				id
+			FROM
+				companies
+			UNION
+			SELECT
+				t.root_id,
+				c.id
+			FROM
+				companies AS c
+			INNER JOIN
+				tree AS t ON c.parent_id = t.id
+			WHERE
+				$2::bool
+		)
 		SELECT
 			c.id,
 			c.name,
 			c.address,
-			s.name AS scope_name,
-			array_agg(DISTINCT e.email) AS emails,
-			array_agg(DISTINCT p.phone) AS phones,
-			array_agg(DISTINCT f.phone) AS faxes,
-			array_agg(DISTINCT pr.date_of_practice) AS practices
-        FROM
+			COALESCE(s.name, '') AS scope_name,
+			c.parent_id,
+			COALESCE(pc.name, '') AS parent_name,
+			(SELECT count(*) FROM companies AS ch WHERE ch.parent_id = c.id AND ch.deleted_at IS NULL) AS children,
+			count(DISTINCT ct.id) AS contacts,
+			array_remove(array_agg(DISTINCT e.email), NULL) AS emails,
+			array_remove(array_agg(DISTINCT p.phone), NULL) AS phones,
+			array_remove(array_agg(DISTINCT f.phone), NULL) AS faxes,
+			array_remove(array_agg(DISTINCT pr.date_of_practice), NULL) AS practices
+		FROM
 			companies AS c
+		INNER JOIN
+			tree AS t ON t.root_id = c.id
 		LEFT JOIN
 			scopes AS s ON c.scope_id = s.id
+		LEFT JOIN
+			companies AS pc ON pc.id = c.parent_id
 		LEFT JOIN
 			emails AS e ON c.id = e.company_id
 		LEFT JOIN
@@ -118,22 +203,30 @@ func CompanyListGet() ([]CompanyList, error) {
 		LEFT JOIN
 			phones AS f ON c.id = f.company_id AND f.fax = true
 		LEFT JOIN
-			practices AS pr ON c.id = pr.company_id
+			practices AS pr ON t.id = pr.company_id AND pr.deleted_at IS NULL
+		LEFT JOIN
+			contacts AS ct ON t.id = ct.company_id AND ct.deleted_at IS NULL
+		WHERE
+			c.deleted_at IS NULL
+		AND
+			($1::bigint = -1 OR c.parent_id = $1)
 		GROUP BY
 			c.id,
-			s.name
+			s.name,
+			pc.name
 		ORDER BY
 			c.name ASC
-	`)
+	`, parentID, subtree)
 	if err != nil {
-		errmsg("GetCompanyList Query", err)
+		errmsg(name+" Query", err)
+		return companies, err
 	}
 	for rows.Next() {
 		var company CompanyList
-		err := rows.Scan(&company.ID, &company.Name, &company.Address, &company.ScopeName,
-			&company.Emails, &company.Phones, &company.Faxes, &company.Practices)
+		err := rows.Scan(&company.ID, &company.Name, &company.Address, &company.ScopeName, &company.ParentID, &company.ParentName,
+			&company.Children, &company.Contacts, &company.Emails, &company.Phones, &company.Faxes, &company.Practices)
 		if err != nil {
-			errmsg("GetCompanyList Scan", err)
+			errmsg(name+" Scan", err)
 			return companies, err
 		}
 		companies = append(companies, company)
@@ -141,6 +234,118 @@ func CompanyListGet() ([]CompanyList, error) {
 	return companies, rows.Err()
 }
 
+// CompanyTreeGet - get tree of companies with branches, top level companies first
+func CompanyTreeGet() ([]CompanyTree, error) {
+	var tree []CompanyTree
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			name,
+			parent_id
+		FROM
+			companies
+		WHERE
+			deleted_at IS NULL
+		ORDER BY
+			name ASC
+	`)
+	if err != nil {
+		errmsg("CompanyTreeGet Query", err)
+		return tree, err
+	}
+	var companies []CompanyTree
+	for rows.Next() {
+		var company CompanyTree
+		err := rows.Scan(&company.ID, &company.Name, &company.ParentID)
+		if err != nil {
+			errmsg("CompanyTreeGet Scan", err)
+			return tree, err
+		}
+		companies = append(companies, company)
+	}
+	if rows.Err() != nil {
+		errmsg("CompanyTreeGet rows", rows.Err())
+		return tree, rows.Err()
+	}
+	return companyTreeBuild(companies), nil
+}
+
+// companyTreeBuild - build tree from flat list, companies with missing parent and companies in cycle are top level
+func companyTreeBuild(companies []CompanyTree) []CompanyTree {
+	ids := make(map[int64]bool, len(companies))
+	children := make(map[int64][]CompanyTree)
+	for _, company := range companies {
+		ids[company.ID] = true
+	}
+	var roots []CompanyTree
+	for _, company := range companies {
+		if company.ParentID == 0 || !ids[company.ParentID] {
+			roots = append(roots, company)
+		} else {
+			children[company.ParentID] = append(children[company.ParentID], company)
+		}
+	}
+	visited := make(map[int64]bool, len(companies))
+	var build func(company CompanyTree, level int64) CompanyTree
+	build = func(company CompanyTree, level int64) CompanyTree {
+		visited[company.ID] = true
+		company.Level = level
+		for _, child := range children[company.ID] {
+			if !visited[child.ID] {
+				company.Children = append(company.Children, build(child, level+1))
+			}
+		}
+		return company
+	}
+	var tree []CompanyTree
+	for _, company := range roots {
+		tree = append(tree, build(company, 0))
+	}
+	for _, company := range companies {
+		if !visited[company.ID] {
+			tree = append(tree, build(company, 0))
+		}
+	}
+	return tree
+}
+
+// companyParentCheck - check inside transaction that parent is not company itself or its branch,
+// company and parent are locked until end of transaction so concurrent changes can't make cycle
+func companyParentCheck(ctx context.Context, tx pgx.Tx, id, parentID int64) error {
+	if parentID == 0 || id == 0 {
+		return nil
+	}
+	if id == parentID {
+		return ErrCompanyCycle
+	}
+	_, err := tx.Exec(ctx, `
+		SELECT
+			id
+		FROM
+			companies
+		WHERE
+			id IN ($1, $2)
+		ORDER BY
+			id ASC
+		FOR UPDATE
+	`, id, parentID)
+	if err != nil {
+		return err
+	}
+	var cycle bool
+	err = tx.QueryRow(ctx, companySubtree+`
+		SELECT
+			EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+	`, id, parentID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCompanyCycle
+	}
+	return nil
+}
+
 // CompanySelectGet - get all companyes for select
 func CompanySelectGet() ([]SelectItem, error) {
 	var companies []SelectItem
@@ -150,6 +355,8 @@ func CompanySelectGet() ([]SelectItem, error) {
 			name
 		FROM
 			companies
+		WHERE
+			deleted_at IS NULL
 		ORDER BY
 			name ASC
 	`)
@@ -170,12 +377,32 @@ func CompanySelectGet() ([]SelectItem, error) {
 
 // CompanyInsert - create new company
 func CompanyInsert(company Company) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return CompanyInsertCtx(context.Background(), company)
+}
+
+// CompanyInsertCtx - CompanyInsert with context, actor of context is written to audit log
+func CompanyInsertCtx(ctx context.Context, company Company) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CompanyInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	company.AddressID, err = addressResolve(ctx, tx, "companies", 0, company.Address)
+	if err != nil {
+		errmsg("CreateCompany addressResolve", err)
+		return 0, err
+	}
+	err = tx.QueryRow(ctx, `
 		INSERT INTO companies
 		(
 			name,
 			address,
+			address_id,
+			latitude,
+			longitude,
 			scope_id,
+			parent_id,
 			note,
 			created_at,
 			updated_at
@@ -187,13 +414,21 @@ func CompanyInsert(company Company) (int64, error) {
 			$3,
 			$4,
 			$5,
-			$6
+			$6,
+			$7,
+			$8,
+			$9,
+			$10
 		)
 		RETURNING
 			id
 	`, company.Name,
 		company.Address,
+		company.AddressID,
+		company.Latitude,
+		company.Longitude,
 		company.ScopeID,
+		company.ParentID,
 		company.Note,
 		time.Now(),
 		time.Now()).Scan(&company.ID)
@@ -201,55 +436,119 @@ func CompanyInsert(company Company) (int64, error) {
 		errmsg("CreateCompany QueryRow", err)
 		return 0, err
 	}
-	_ = EmailCompanyUpdate(company.ID, company.Emails)
-	_ = PhoneCompanyUpdate(company.ID, company.Phones, false)
-	_ = PhoneCompanyUpdate(company.ID, company.Faxes, true)
+	_ = EmailCompanyUpdateCtx(ctx, company.ID, company.Emails)
+	_ = PhoneCompanyUpdateCtx(ctx, company.ID, company.Phones, false)
+	_ = PhoneCompanyUpdateCtx(ctx, company.ID, company.Faxes, true)
 	return company.ID, nil
 }
 
 // CompanyUpdate - save company changes
 func CompanyUpdate(company Company) error {
-	_, err := pool.Exec(context.Background(), `
+	return CompanyUpdateCtx(context.Background(), company)
+}
+
+// CompanyUpdateCtx - CompanyUpdate with context, actor of context is written to audit log
+func CompanyUpdateCtx(ctx context.Context, company Company) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CompanyUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = companyParentCheck(ctx, tx, company.ID, company.ParentID)
+	if err != nil {
+		errmsg("CompanyUpdate companyParentCheck", err)
+		return err
+	}
+	tag, err := tx.Exec(ctx, `
 		UPDATE companies SET
 			name = $2,
 			address = $3,
-			scope_id = $4,
-			note = $5,
-			updated_at = $6
+			address_id = CASE WHEN address IS NOT DISTINCT FROM $3 THEN address_id ELSE 0 END,
+			latitude = $4,
+			longitude = $5,
+			scope_id = $6,
+			parent_id = $7,
+			note = $8,
+			updated_at = $9,
+			version = version + 1
 		WHERE
 			id = $1
+		AND
+			version = $10
 	`, company.ID, company.Name,
 		company.Address,
+		company.Latitude,
+		company.Longitude,
 		company.ScopeID,
+		company.ParentID,
 		company.Note,
-		time.Now())
+		time.Now(),
+		company.Version)
 	if err != nil {
 		errmsg("CompanyUpdate Exec", err)
 		return err
 	}
-	_ = EmailCompanyUpdate(company.ID, company.Emails)
-	_ = PhoneCompanyUpdate(company.ID, company.Phones, false)
-	_ = PhoneCompanyUpdate(company.ID, company.Faxes, true)
+	err = versionCheck("companies", company.ID, company.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return CompanyGet(company.ID)
+	})
+	if err != nil {
+		return err
+	}
+	err = addressLink(ctx, tx, "companies", company.ID, company.Address)
+	if err != nil {
+		errmsg("CompanyUpdate addressLink", err)
+		return err
+	}
+	_ = EmailCompanyUpdateCtx(ctx, company.ID, company.Emails)
+	_ = PhoneCompanyUpdateCtx(ctx, company.ID, company.Phones, false)
+	_ = PhoneCompanyUpdateCtx(ctx, company.ID, company.Faxes, true)
 	return nil
 }
 
-// CompanyDelete - delete company by id
+// CompanyDelete - move company to trash, emails, phones, contacts and branches are kept until purge
 func CompanyDelete(id int64) error {
+	return CompanyDeleteCtx(context.Background(), id)
+}
+
+// CompanyDeleteCtx - CompanyDelete with context, actor of context is written to audit log
+func CompanyDeleteCtx(ctx context.Context, id int64) error {
+	return trashDelete(ctx, "companies", id)
+}
+
+// companyPurge - delete company by id with child rows
+func companyPurge(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("companyPurge auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		UPDATE companies SET
+			parent_id = (SELECT parent_id FROM companies WHERE id = $1)
+		WHERE
+			parent_id = $1
+	`, id)
+	if err != nil {
+		errmsg("DeleteCompany children Exec", err)
+		return err
+	}
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
-			companyes
+			companies
 		WHERE
 			id = $1
 	`, id)
 	if err != nil {
 		errmsg("DeleteCompany Exec", err)
 	}
-	_ = EmailCompanyDelete(id)
-	_ = PhoneCompanyDelete(id, false)
-	_ = PhoneCompanyDelete(id, true)
+	_ = EmailCompanyDeleteCtx(ctx, id)
+	_ = PhoneCompanyDeleteCtx(ctx, id, false)
+	_ = PhoneCompanyDeleteCtx(ctx, id, true)
 	return err
 }
 
@@ -260,8 +559,14 @@ func companyCreateTable() error {
 				id BIGSERIAL PRIMARY KEY,
 				name TEXT,
 				address TEXT,
+				address_id BIGINT NOT NULL DEFAULT 0,
+				latitude TEXT,
+				longitude TEXT,
 				scope_id BIGINT,
+				parent_id BIGINT NOT NULL DEFAULT 0,
 				note TEXT,
+				deleted_at timestamp without time zone,
+				version bigint NOT NULL DEFAULT 0,
 				created_at timestamp without time zone,
 				updated_at timestamp without time zone default now(),
 				UNIQUE(name, scope_id)
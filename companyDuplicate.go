@@ -0,0 +1,392 @@
+package edc
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// CompanyDuplicate - pair of companies which may be the same organization
+// Similarity        - similarity of names without legal form and quotes from 0 to 1
+// AddressSimilarity - similarity of normalized addresses from 0 to 1, 0 if address is empty
+type CompanyDuplicate struct {
+	ID                int64   `json:"id"                 form:"id"                 query:"id"`
+	Name              string  `json:"name"               form:"name"               query:"name"`
+	Address           string  `json:"address"            form:"address"            query:"address"`
+	ScopeName         string  `json:"scope_name"         form:"scope_name"         query:"scope_name"`
+	DuplicateID       int64   `json:"duplicate_id"       form:"duplicate_id"       query:"duplicate_id"`
+	DuplicateName     string  `json:"duplicate_name"     form:"duplicate_name"     query:"duplicate_name"`
+	DuplicateAddress  string  `json:"duplicate_address"  form:"duplicate_address"  query:"duplicate_address"`
+	DuplicateScope    string  `json:"duplicate_scope"    form:"duplicate_scope"    query:"duplicate_scope"`
+	Similarity        float64 `json:"similarity"         form:"similarity"         query:"similarity"`
+	AddressSimilarity float64 `json:"address_similarity" form:"address_similarity" query:"address_similarity"`
+	SamePhone         bool    `json:"same_phone"         form:"same_phone"         query:"same_phone"`
+	SameEmail         bool    `json:"same_email"         form:"same_email"         query:"same_email"`
+}
+
+// MergeAudit - record of merge of duplicate into surviving record
+// Merged - duplicate record in json before merge
+type MergeAudit struct {
+	ID          int64  `sql:"id"           json:"id"           form:"id"           query:"id"`
+	Entity      string `sql:"entity"       json:"entity"       form:"entity"       query:"entity"`
+	SurvivorID  int64  `sql:"survivor_id"  json:"survivor_id"  form:"survivor_id"  query:"survivor_id"`
+	DuplicateID int64  `sql:"duplicate_id" json:"duplicate_id" form:"duplicate_id" query:"duplicate_id"`
+	Merged      string `sql:"merged"       json:"merged"       form:"merged"       query:"merged"`
+	CreatedAt   string `sql:"created_at"   json:"created_at"   form:"created_at"   query:"created_at"`
+}
+
+type companyCandidate struct {
+	id        int64
+	name      string
+	key       string
+	address   string
+	addrKey   string
+	scopeName string
+	phones    []int64
+	emails    []string
+}
+
+// legalForms - legal forms of organizations removed from names before comparison, longest first
+var legalForms = []string{
+	"общество с ограниченной ответственностью",
+	"публичное акционерное общество",
+	"закрытое акционерное общество",
+	"открытое акционерное общество",
+	"акционерное общество",
+	"индивидуальный предприниматель",
+	"федеральное государственное унитарное предприятие",
+	"государственное унитарное предприятие",
+	"муниципальное унитарное предприятие",
+	"фгбоу", "фгуп", "фгбу", "фгку", "мбдоу", "мадоу", "мбоу", "маоу", "мкоу", "гбуз", "гбоу",
+	"ооо", "оао", "зао", "пао", "нао", "муп", "гуп", "мбу", "мку", "мау", "гбу", "гку", "фку",
+	"ано", "нко", "тсж", "снт", "ао", "ип",
+}
+
+// CompanyDuplicateGet - get pairs of companies with similar names or shared phone or email.
+// Similarity - minimal similarity of names, 0 for default 0.85
+func CompanyDuplicateGet(similarity float64) ([]CompanyDuplicate, error) {
+	var duplicates []CompanyDuplicate
+	if similarity == 0 {
+		similarity = 0.85
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			c.id,
+			c.name,
+			COALESCE(c.address, '') AS address,
+			COALESCE(s.name, '') AS scope_name,
+			array_remove(array_agg(DISTINCT ph.phone), NULL) AS phones,
+			array_remove(array_agg(DISTINCT lower(e.email)), NULL) AS emails
+		FROM
+			companies AS c
+		LEFT JOIN
+			scopes AS s ON s.id = c.scope_id
+		LEFT JOIN
+			phones AS ph ON ph.company_id = c.id
+		LEFT JOIN
+			emails AS e ON e.company_id = c.id
+		WHERE
+			c.deleted_at IS NULL
+		GROUP BY
+			c.id,
+			s.name
+		ORDER BY
+			c.id ASC
+	`)
+	if err != nil {
+		errmsg("CompanyDuplicateGet Query", err)
+		return duplicates, err
+	}
+	var companies []companyCandidate
+	for rows.Next() {
+		var company companyCandidate
+		err := rows.Scan(&company.id, &company.name, &company.address, &company.scopeName, &company.phones, &company.emails)
+		if err != nil {
+			errmsg("CompanyDuplicateGet Scan", err)
+			return duplicates, err
+		}
+		company.key = companyNameKey(company.name)
+		company.addrKey = addressKey(company.address)
+		companies = append(companies, company)
+	}
+	if rows.Err() != nil {
+		errmsg("CompanyDuplicateGet rows", rows.Err())
+		return duplicates, rows.Err()
+	}
+	for i := range companies {
+		for j := i + 1; j < len(companies); j++ {
+			a, b := companies[i], companies[j]
+			if a.key == "" || b.key == "" {
+				continue
+			}
+			duplicate := CompanyDuplicate{
+				ID:               a.id,
+				Name:             a.name,
+				Address:          a.address,
+				ScopeName:        a.scopeName,
+				DuplicateID:      b.id,
+				DuplicateName:    b.name,
+				DuplicateAddress: b.address,
+				DuplicateScope:   b.scopeName,
+				Similarity:       nameSimilarity(a.key, b.key),
+				SamePhone:        sharedInt64(a.phones, b.phones),
+				SameEmail:        sharedString(a.emails, b.emails),
+			}
+			if a.addrKey != "" && b.addrKey != "" {
+				duplicate.AddressSimilarity = nameSimilarity(a.addrKey, b.addrKey)
+			}
+			if duplicate.Similarity < similarity && !duplicate.SamePhone && !duplicate.SameEmail {
+				continue
+			}
+			if duplicate.Similarity < 0.5 && duplicate.AddressSimilarity < similarity {
+				continue
+			}
+			duplicates = append(duplicates, duplicate)
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return companyDuplicateScore(duplicates[i]) > companyDuplicateScore(duplicates[j])
+	})
+	return duplicates, nil
+}
+
+// CompanyMerge - merge duplicate company into company inside transaction. Contacts, practices, certificates,
+// sirens, tccs, emails and phones are moved to company, merge is recorded to audit, duplicate is deleted.
+// Company may be direct branch of duplicate, merge into deeper branch returns ErrCompanyCycle.
+func CompanyMerge(id, duplicateID int64) error {
+	return CompanyMergeCtx(context.Background(), id, duplicateID)
+}
+
+// CompanyMergeCtx - CompanyMerge with context, actor of context is written to audit log
+func CompanyMergeCtx(ctx context.Context, id, duplicateID int64) error {
+	if id == 0 || duplicateID == 0 {
+		return nil
+	}
+	if id == duplicateID {
+		return ErrMerge
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CompanyMerge Begin", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	err = mergeLock(tx, "companies", id, duplicateID)
+	if err != nil {
+		errmsg("CompanyMerge mergeLock", err)
+		return err
+	}
+	var nested bool
+	err = tx.QueryRow(ctx, companySubtree+`
+		SELECT
+			EXISTS (SELECT 1 FROM subtree WHERE id = $2 AND id NOT IN (SELECT id FROM companies WHERE parent_id = $1))
+	`, duplicateID, id).Scan(&nested)
+	if err != nil {
+		errmsg("CompanyMerge subtree", err)
+		return err
+	}
+	if nested {
+		return ErrCompanyCycle
+	}
+	err = mergeAudit(tx, "companies", id, duplicateID)
+	if err != nil {
+		errmsg("CompanyMerge mergeAudit", err)
+		return err
+	}
+	deletes := []string{
+		`DELETE FROM emails AS d USING emails AS s
+			WHERE d.company_id = $2 AND s.company_id = $1 AND lower(d.email) = lower(s.email)`,
+		`DELETE FROM phones AS d USING phones AS s
+			WHERE d.company_id = $2 AND s.company_id = $1 AND d.phone = s.phone AND d.fax = s.fax`,
+		`UPDATE contacts AS c SET department_id = s.id FROM departments AS d, departments AS s
+			WHERE c.department_id = d.id AND d.company_id = $2 AND s.company_id = $1 AND s.parent_id = d.parent_id AND s.name = d.name`,
+		`DELETE FROM departments AS d USING departments AS s
+			WHERE d.company_id = $2 AND s.company_id = $1 AND s.parent_id = d.parent_id AND s.name = d.name`,
+		`DELETE FROM company_go_roles AS d USING company_go_roles AS s
+			WHERE d.company_id = $2 AND s.company_id = $1 AND d.contact_id = s.contact_id AND d.post_id = s.post_id`,
+	}
+	for _, query := range deletes {
+		_, err = tx.Exec(ctx, query, id, duplicateID)
+		if err != nil {
+			errmsg("CompanyMerge Delete", err)
+			return err
+		}
+	}
+	updates := []string{
+		`UPDATE contacts SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE practices SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE practice_plans SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE certificates SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE sirens SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE tccs SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE emails SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE phones SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE contact_assignments SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE company_go_roles SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE departments SET company_id = $1, updated_at = $3 WHERE company_id = $2`,
+		`UPDATE companies SET parent_id = (SELECT parent_id FROM companies WHERE id = $2), updated_at = $3
+			WHERE id = $1 AND parent_id = $2`,
+		`UPDATE companies SET parent_id = $1, updated_at = $3 WHERE parent_id = $2`,
+	}
+	for _, query := range updates {
+		_, err = tx.Exec(ctx, query, id, duplicateID, time.Now())
+		if err != nil {
+			errmsg("CompanyMerge Update", err)
+			return err
+		}
+	}
+	// duplicate is deleted before survivor takes its fields to keep unique (name, scope_id)
+	_, err = tx.Exec(ctx, `
+		WITH d AS (
+			DELETE FROM
+				companies
+			WHERE
+				id = $2
+			RETURNING
+				*
+		)
+		UPDATE companies AS c SET
+			address = COALESCE(NULLIF(c.address, ''), d.address),
+			scope_id = CASE WHEN COALESCE(c.scope_id, 0) = 0 THEN d.scope_id ELSE c.scope_id END,
+			note = concat_ws(E'\n', NULLIF(c.note, ''), NULLIF(d.note, '')),
+			updated_at = $3
+		FROM
+			d
+		WHERE
+			c.id = $1
+	`, id, duplicateID, time.Now())
+	if err != nil {
+		errmsg("CompanyMerge Exec", err)
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("CompanyMerge Commit", err)
+	}
+	return err
+}
+
+// MergeAuditListGet - get merges of entity (table name), empty for all entities
+func MergeAuditListGet(entity string) ([]MergeAudit, error) {
+	var audits []MergeAudit
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			entity,
+			survivor_id,
+			duplicate_id,
+			merged::text,
+			created_at::text
+		FROM
+			merge_audits
+		WHERE
+			$1::text = '' OR entity = $1
+		ORDER BY
+			created_at DESC
+	`, entity)
+	if err != nil {
+		errmsg("MergeAuditListGet Query", err)
+		return audits, err
+	}
+	for rows.Next() {
+		var audit MergeAudit
+		err := rows.Scan(&audit.ID, &audit.Entity, &audit.SurvivorID, &audit.DuplicateID, &audit.Merged, &audit.CreatedAt)
+		if err != nil {
+			errmsg("MergeAuditListGet Scan", err)
+			return audits, err
+		}
+		audits = append(audits, audit)
+	}
+	return audits, rows.Err()
+}
+
+// mergeAudit - record duplicate row of table before it is merged into survivor
+func mergeAudit(tx pgx.Tx, table string, id, duplicateID int64) error {
+	_, err := tx.Exec(context.Background(), `
+		INSERT INTO merge_audits
+		(
+			entity,
+			survivor_id,
+			duplicate_id,
+			merged,
+			created_at
+		)
+		SELECT
+			$1,
+			$2,
+			d.id,
+			row_to_json(d)::jsonb,
+			$4
+		FROM
+			`+pgx.Identifier{table}.Sanitize()+` AS d
+		WHERE
+			d.id = $3
+	`, table, id, duplicateID, time.Now())
+	return err
+}
+
+func companyDuplicateScore(duplicate CompanyDuplicate) float64 {
+	score := duplicate.Similarity + duplicate.AddressSimilarity/2
+	if duplicate.SamePhone {
+		score++
+	}
+	if duplicate.SameEmail {
+		score++
+	}
+	return score
+}
+
+// companyNameKey - words of company name without legal form and quotes in alphabetical order
+func companyNameKey(name string) string {
+	name = " " + strings.Join(companyWords(name), " ") + " "
+	for _, form := range legalForms {
+		name = strings.ReplaceAll(name, " "+form+" ", " ")
+	}
+	words := strings.Fields(name)
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// addressKey - words of address without common abbreviations of address parts
+func addressKey(address string) string {
+	var words []string
+	for _, word := range companyWords(address) {
+		switch word {
+		case "г", "гор", "город", "ул", "улица", "д", "дом", "пр", "пр-т", "проспект", "пер", "переулок",
+			"обл", "область", "р-н", "район", "корп", "к", "стр", "строение", "кв", "оф", "офис":
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// companyWords - lower case words of string without quotes and punctuation, hyphens are kept
+func companyWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(strings.ReplaceAll(s, "ё", "е")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+}
+
+func mergeAuditCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			merge_audits (
+				id           bigserial PRIMARY KEY,
+				entity       text,
+				survivor_id  bigint,
+				duplicate_id bigint,
+				merged       jsonb,
+				created_at   TIMESTAMP without time zone default now()
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("mergeAuditCreateTable exec", err)
+	}
+	return err
+}
@@ -6,22 +6,28 @@ import (
 )
 
 // Contact is struct for contact
+// EffectiveDate - date of change of company, post, GO post or rank, today if empty
+// Career        - timeline of company, post, GO post and rank assignments
 type Contact struct {
-	ID           int64    `sql:"id"            json:"id"            form:"id"            query:"id"`
-	Name         string   `sql:"name"          json:"name"          form:"name"          query:"name"`
-	CompanyID    int64    `sql:"company_id"    json:"company_id"    form:"company_id"    query:"company_id"`
-	DepartmentID int64    `sql:"department_id" json:"department_id" form:"department_id" query:"department_id"`
-	PostID       int64    `sql:"post_id"       json:"post_id"       form:"post_id"       query:"post_id"`
-	PostGOID     int64    `sql:"post_go_id"    json:"post_go_id"    form:"post_go_id"    query:"post_go_id"`
-	RankID       int64    `sql:"rank_id"       json:"rank_id"       form:"rank_id"       query:"rank_id"`
-	Birthday     string   `sql:"birthday"      json:"birthday"      form:"birthday"      query:"birthday"`
-	Note         string   `sql:"note"          json:"note"          form:"note"          query:"note"`
-	CreatedAt    string   `sql:"created_at"    json:"-"`
-	UpdatedAt    string   `sql:"updated_at"    json:"-"`
-	Emails       []string `sql:"-"             json:"emails"        form:"emails"        query:"emails"`
-	Phones       []int64  `sql:"-"             json:"phones"        form:"phones"        query:"phones"`
-	Faxes        []int64  `sql:"-"             json:"faxes"         form:"faxes"         query:"faxes"`
-	Educations   []string `sql:"-"             json:"educations"    form:"educations"    query:"educations"`
+	ID            int64               `sql:"id"            json:"id"             form:"id"             query:"id"`
+	Name          string              `sql:"name"          json:"name"           form:"name"           query:"name"`
+	CompanyID     int64               `sql:"company_id"    json:"company_id"     form:"company_id"     query:"company_id"`
+	DepartmentID  int64               `sql:"department_id" json:"department_id"  form:"department_id"  query:"department_id"`
+	PostID        int64               `sql:"post_id"       json:"post_id"        form:"post_id"        query:"post_id"`
+	PostGOID      int64               `sql:"post_go_id"    json:"post_go_id"     form:"post_go_id"     query:"post_go_id"`
+	RankID        int64               `sql:"rank_id"       json:"rank_id"        form:"rank_id"        query:"rank_id"`
+	Birthday      string              `sql:"birthday"      json:"birthday"       form:"birthday"       query:"birthday"`
+	Note          string              `sql:"note"          json:"note"           form:"note"           query:"note"`
+	Version       int64               `sql:"version"       json:"version"        form:"version"        query:"version"`
+	CreatedAt     string              `sql:"created_at"    json:"-"`
+	UpdatedAt     string              `sql:"updated_at"    json:"-"`
+	Emails        []string            `sql:"-"             json:"emails"         form:"emails"         query:"emails"`
+	Phones        []int64             `sql:"-"             json:"phones"         form:"phones"         query:"phones"`
+	Faxes         []int64             `sql:"-"             json:"faxes"          form:"faxes"          query:"faxes"`
+	Educations    []string            `sql:"-"             json:"educations"     form:"educations"     query:"educations"`
+	Trainings     []EducationHistory  `sql:"-"             json:"trainings"      form:"trainings"      query:"trainings"`
+	EffectiveDate string              `sql:"-"             json:"effective_date" form:"effective_date" query:"effective_date"`
+	Career        []ContactAssignment `sql:"-"             json:"career"         form:"career"         query:"career"`
 }
 
 // ContactList is struct for contact list
@@ -39,6 +45,7 @@ type ContactList struct {
 type ContactShort struct {
 	ID             int64  `json:"id"              form:"id"              query:"id"`
 	Name           string `json:"name"            form:"name"            query:"name"`
+	CompanyName    string `json:"company_name"    form:"company_name"    query:"company_name"`
 	DepartmentName string `json:"department_name" form:"department_name" query:"department_name"`
 	PostName       string `json:"post_name"       form:"post_name"       query:"post_name"`
 	PostGOName     string `json:"post_go_name"    form:"post_go_name"    query:"post_go_name"`
@@ -61,6 +68,7 @@ func ContactGet(id int64) (Contact, error) {
 			c.rank_id,
 			c.birthday,
 			c.note,
+			c.version,
 			c.created_at,
 			c.updated_at,
 			array_agg(DISTINCT e.email) AS emails,
@@ -76,17 +84,22 @@ func ContactGet(id int64) (Contact, error) {
 		LEFT JOIN
 			phones AS f ON c.id = f.contact_id AND f.fax = true
 		LEFT JOIN
-			educations AS ed ON c.id = ed.contact_id
+			educations AS ed ON c.id = ed.contact_id AND ed.deleted_at IS NULL
 		WHERE
 			c.id = $1
 		GROUP BY
 			c.id
 	`, id).Scan(&contact.Name, &contact.CompanyID, &contact.DepartmentID, &contact.PostID, &contact.PostGOID, &contact.RankID,
-		&contact.Birthday, &contact.Note, &contact.CreatedAt, &contact.UpdatedAt, &contact.Emails, &contact.Phones, &contact.Faxes, &contact.Educations)
+		&contact.Birthday, &contact.Note, &contact.Version, &contact.CreatedAt, &contact.UpdatedAt, &contact.Emails, &contact.Phones, &contact.Faxes, &contact.Educations)
 	if err != nil {
 		errmsg("GetContact QueryRow", err)
 		return contact, err
 	}
+	contact.Trainings, err = EducationHistoryGet(id)
+	if err != nil {
+		return contact, err
+	}
+	contact.Career, err = ContactAssignmentGet(id)
 	return contact, err
 }
 
@@ -112,6 +125,8 @@ func ContactListGet() ([]ContactList, error) {
 			phones AS ph ON c.id = ph.contact_id AND ph.fax = false
 		LEFT JOIN
 			phones AS f ON c.id = f.contact_id AND f.fax = true
+		WHERE
+			c.deleted_at IS NULL
 		GROUP BY
 			c.id,
 			co.id,
@@ -144,6 +159,8 @@ func ContactSelectGet() ([]SelectItem, error) {
 			name
 		FROM
 			contacts
+		WHERE
+			deleted_at IS NULL
 		ORDER BY
 			name ASC
 	`)
@@ -164,35 +181,46 @@ func ContactSelectGet() ([]SelectItem, error) {
 
 // ContactCompanyGet - get all contacts from company
 func ContactCompanyGet(id int64) ([]ContactShort, error) {
+	return contactCompanyQuery("ContactCompanyGet", id, false)
+}
+
+// contactCompanyQuery - get contacts of company or of company and all its branches
+func contactCompanyQuery(name string, id int64, subtree bool) ([]ContactShort, error) {
 	var contacts []ContactShort
 	if id == 0 {
 		return contacts, nil
 	}
-	rows, err := pool.Query(context.Background(), `
+	rows, err := pool.Query(context.Background(), companySubtree+`
 		SELECT
 			c.id,
 			c.name,
-			po.name AS post_name,
-			pog.name AS post_go_name
+			COALESCE(co.name, '') AS company_name,
+			COALESCE(po.name, '') AS post_name,
+			COALESCE(pog.name, '') AS post_go_name
 		FROM
 			contacts AS c
+		LEFT JOIN
+			companies AS co ON c.company_id = co.id
 		LEFT JOIN
 			posts AS po ON c.post_id = po.id
 		LEFT JOIN
 			posts AS pog ON c.post_go_id = pog.id
 		WHERE
-			c.company_id = ?
+			c.deleted_at IS NULL
+		AND
+			(c.company_id = $1 OR ($2::bool AND c.company_id IN (SELECT id FROM subtree)))
 		ORDER BY
-			name ASC
-	`, id)
+			c.name ASC
+	`, id, subtree)
 	if err != nil {
-		errmsg("GetContactCompany query", err)
+		errmsg(name+" Query", err)
+		return contacts, err
 	}
 	for rows.Next() {
 		var contact ContactShort
-		err := rows.Scan(&contact.ID, &contact.Name, &contact.PostName, &contact.PostGOName)
+		err := rows.Scan(&contact.ID, &contact.Name, &contact.CompanyName, &contact.PostName, &contact.PostGOName)
 		if err != nil {
-			errmsg("GetCompanyList Scan", err)
+			errmsg(name+" Scan", err)
 			return contacts, err
 		}
 		contacts = append(contacts, contact)
@@ -202,7 +230,18 @@ func ContactCompanyGet(id int64) ([]ContactShort, error) {
 
 // ContactInsert - create new contact
 func ContactInsert(contact Contact) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return ContactInsertCtx(context.Background(), contact)
+}
+
+// ContactInsertCtx - ContactInsert with context, actor of context is written to audit log
+func ContactInsertCtx(ctx context.Context, contact Contact) (int64, error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("ContactInsert Begin", err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO contacts
 		(
 			name,
@@ -237,15 +276,36 @@ func ContactInsert(contact Contact) (int64, error) {
 		errmsg("ContactInsert QueryRow", err)
 		return 0, err
 	}
-	_ = EmailContactUpdate(contact.ID, contact.Emails)
-	_ = PhoneContactUpdate(contact.ID, contact.Phones, false)
-	_ = PhoneContactUpdate(contact.ID, contact.Faxes, true)
+	err = contactAssignmentSave(ctx, tx, contact, contact.EffectiveDate)
+	if err != nil {
+		errmsg("ContactInsert contactAssignmentSave", err)
+		return 0, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("ContactInsert Commit", err)
+		return 0, err
+	}
+	_ = EmailContactUpdateCtx(ctx, contact.ID, contact.Emails)
+	_ = PhoneContactUpdateCtx(ctx, contact.ID, contact.Phones, false)
+	_ = PhoneContactUpdateCtx(ctx, contact.ID, contact.Faxes, true)
 	return contact.ID, nil
 }
 
 // ContactUpdate - save contact changes
 func ContactUpdate(contact Contact) error {
-	_, err := pool.Exec(context.Background(), `
+	return ContactUpdateCtx(context.Background(), contact)
+}
+
+// ContactUpdateCtx - ContactUpdate with context, actor of context is written to audit log
+func ContactUpdateCtx(ctx context.Context, contact Contact) error {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("ContactUpdate Begin", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `
 		UPDATE contacts SET
 			name = $2,
 			company_id = $3,
@@ -255,30 +315,66 @@ func ContactUpdate(contact Contact) error {
 			rank_id = $7,
 			birthday = $8,
 			note = $9,
-			updated_at = $10
+			updated_at = $10,
+			version = version + 1
 		WHERE
 			id = $1
+		AND
+			version = $11
 	`, contact.ID, contact.Name, contact.CompanyID, contact.DepartmentID, contact.PostID, contact.PostGOID, contact.RankID, contact.Birthday,
-		contact.Note, time.Now())
+		contact.Note, time.Now(), contact.Version)
 	if err != nil {
 		errmsg("ContactUpdate Exec", err)
 		return err
 	}
-	_ = EmailContactUpdate(contact.ID, contact.Emails)
-	_ = PhoneContactUpdate(contact.ID, contact.Phones, false)
-	_ = PhoneContactUpdate(contact.ID, contact.Faxes, true)
+	err = versionCheck("contacts", contact.ID, contact.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return ContactGet(contact.ID)
+	})
+	if err != nil {
+		return err
+	}
+	err = contactAssignmentSave(ctx, tx, contact, contact.EffectiveDate)
+	if err != nil {
+		errmsg("ContactUpdate contactAssignmentSave", err)
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("ContactUpdate Commit", err)
+		return err
+	}
+	_ = EmailContactUpdateCtx(ctx, contact.ID, contact.Emails)
+	_ = PhoneContactUpdateCtx(ctx, contact.ID, contact.Phones, false)
+	_ = PhoneContactUpdateCtx(ctx, contact.ID, contact.Faxes, true)
 	return nil
 }
 
-// ContactDelete - delete contact by id
+// ContactDelete - move contact to trash, emails, phones and career are kept until purge
 func ContactDelete(id int64) error {
+	return ContactDeleteCtx(context.Background(), id)
+}
+
+// ContactDeleteCtx - ContactDelete with context, actor of context is written to audit log
+func ContactDeleteCtx(ctx context.Context, id int64) error {
+	return trashDelete(ctx, "contacts", id)
+}
+
+// contactPurge - delete contact by id with child rows
+func contactPurge(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_ = EmailContactDelete(id)
-	_ = PhoneContactDelete(id, true)
-	_ = PhoneContactDelete(id, false)
-	_, err := pool.Exec(context.Background(), `
+	_ = EmailContactDeleteCtx(ctx, id)
+	_ = PhoneContactDeleteCtx(ctx, id, true)
+	_ = PhoneContactDeleteCtx(ctx, id, false)
+	_ = contactAssignmentDelete(ctx, id)
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("contactPurge auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			contacts
 		WHERE
@@ -303,6 +399,8 @@ func contactCreateTable() error {
 				rank_id bigint,
 				birthday date,
 				note text,
+				deleted_at TIMESTAMP without time zone,
+				version bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
 				UNIQUE(name, birthday)
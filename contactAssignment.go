@@ -0,0 +1,247 @@
+package edc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrContactAssignmentDate - effective date is before start of current assignment of contact
+var ErrContactAssignmentDate = errors.New("effective date is before start of current assignment")
+
+// ContactAssignment - company, post, GO post and rank held by contact in period
+// StartDate - first day of assignment, empty if unknown
+// EndDate   - day after last day of assignment, empty for current assignment
+type ContactAssignment struct {
+	ID          int64  `sql:"id"           json:"id"           form:"id"           query:"id"`
+	ContactID   int64  `sql:"contact_id"   json:"contact_id"   form:"contact_id"   query:"contact_id"`
+	ContactName string `sql:"-"            json:"contact_name" form:"contact_name" query:"contact_name"`
+	CompanyID   int64  `sql:"company_id"   json:"company_id"   form:"company_id"   query:"company_id"`
+	CompanyName string `sql:"-"            json:"company_name" form:"company_name" query:"company_name"`
+	PostID      int64  `sql:"post_id"      json:"post_id"      form:"post_id"      query:"post_id"`
+	PostName    string `sql:"-"            json:"post_name"    form:"post_name"    query:"post_name"`
+	PostGOID    int64  `sql:"post_go_id"   json:"post_go_id"   form:"post_go_id"   query:"post_go_id"`
+	PostGOName  string `sql:"-"            json:"post_go_name" form:"post_go_name" query:"post_go_name"`
+	RankID      int64  `sql:"rank_id"      json:"rank_id"      form:"rank_id"      query:"rank_id"`
+	RankName    string `sql:"-"            json:"rank_name"    form:"rank_name"    query:"rank_name"`
+	StartDate   string `sql:"start_date"   json:"start_date"   form:"start_date"   query:"start_date"`
+	EndDate     string `sql:"end_date"     json:"end_date"     form:"end_date"     query:"end_date"`
+}
+
+const contactAssignmentQuery = `
+	SELECT
+		a.id,
+		a.contact_id,
+		COALESCE(c.name, '') AS contact_name,
+		a.company_id,
+		COALESCE(co.name, '') AS company_name,
+		a.post_id,
+		COALESCE(po.name, '') AS post_name,
+		a.post_go_id,
+		COALESCE(pog.name, '') AS post_go_name,
+		a.rank_id,
+		COALESCE(r.name, '') AS rank_name,
+		COALESCE(a.start_date::text, '') AS start_date,
+		COALESCE(a.end_date::text, '') AS end_date
+	FROM
+		contact_assignments AS a
+	LEFT JOIN
+		contacts AS c ON c.id = a.contact_id
+	LEFT JOIN
+		companies AS co ON co.id = a.company_id
+	LEFT JOIN
+		posts AS po ON po.id = a.post_id
+	LEFT JOIN
+		posts AS pog ON pog.id = a.post_go_id
+	LEFT JOIN
+		ranks AS r ON r.id = a.rank_id
+`
+
+// ContactAssignmentGet - get career timeline of contact, latest assignment first
+func ContactAssignmentGet(id int64) ([]ContactAssignment, error) {
+	if id == 0 {
+		return []ContactAssignment{}, nil
+	}
+	return contactAssignmentList("ContactAssignmentGet", contactAssignmentQuery+`
+		WHERE
+			a.contact_id = $1
+		ORDER BY
+			a.start_date DESC NULLS LAST,
+			a.id DESC
+	`, id)
+}
+
+// ContactAssignmentPostGet - get contacts held post or GO post at company on date (format 2006-01-02),
+// today if date is empty
+func ContactAssignmentPostGet(companyID, postID int64, date string) ([]ContactAssignment, error) {
+	if companyID == 0 || postID == 0 {
+		return []ContactAssignment{}, nil
+	}
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	return contactAssignmentList("ContactAssignmentPostGet", contactAssignmentQuery+`
+		WHERE
+			a.company_id = $1
+		AND
+			(a.post_id = $2 OR a.post_go_id = $2)
+		AND
+			c.deleted_at IS NULL
+		AND
+			(a.start_date IS NULL OR a.start_date <= $3::date)
+		AND
+			(a.end_date IS NULL OR a.end_date > $3::date)
+		ORDER BY
+			contact_name ASC
+	`, companyID, postID, date)
+}
+
+func contactAssignmentList(name, query string, args ...interface{}) ([]ContactAssignment, error) {
+	var assignments []ContactAssignment
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		errmsg(name+" Query", err)
+		return assignments, err
+	}
+	for rows.Next() {
+		var assignment ContactAssignment
+		err := rows.Scan(&assignment.ID, &assignment.ContactID, &assignment.ContactName, &assignment.CompanyID, &assignment.CompanyName,
+			&assignment.PostID, &assignment.PostName, &assignment.PostGOID, &assignment.PostGOName, &assignment.RankID, &assignment.RankName,
+			&assignment.StartDate, &assignment.EndDate)
+		if err != nil {
+			errmsg(name+" Scan", err)
+			return assignments, err
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, rows.Err()
+}
+
+// contactAssignmentSave - close current assignment of contact and open new one from date inside transaction
+// of contact change if company, post, GO post or rank of contact is changed. Date is today if empty and
+// must not be before start of current assignment.
+func contactAssignmentSave(ctx context.Context, tx pgx.Tx, contact Contact, date string) error {
+	if contact.ID == 0 {
+		return nil
+	}
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	var (
+		current ContactAssignment
+		early   bool
+	)
+	err := tx.QueryRow(ctx, `
+		SELECT
+			id,
+			company_id,
+			post_id,
+			post_go_id,
+			rank_id,
+			COALESCE(start_date > $2::date, false)
+		FROM
+			contact_assignments
+		WHERE
+			contact_id = $1
+		AND
+			end_date IS NULL
+		ORDER BY
+			id DESC
+		LIMIT 1
+		FOR UPDATE
+	`, contact.ID, date).Scan(&current.ID, &current.CompanyID, &current.PostID, &current.PostGOID, &current.RankID, &early)
+	if err != nil && err != pgx.ErrNoRows {
+		return err
+	}
+	if current.CompanyID == contact.CompanyID && current.PostID == contact.PostID &&
+		current.PostGOID == contact.PostGOID && current.RankID == contact.RankID {
+		return nil
+	}
+	if early {
+		return ErrContactAssignmentDate
+	}
+	if current.ID != 0 {
+		_, err = tx.Exec(ctx, `
+			UPDATE contact_assignments SET
+				end_date = $2::date,
+				updated_at = $3
+			WHERE
+				id = $1
+		`, current.ID, date, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	if contact.CompanyID != 0 || contact.PostID != 0 || contact.PostGOID != 0 || contact.RankID != 0 {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO contact_assignments
+			(
+				contact_id,
+				company_id,
+				post_id,
+				post_go_id,
+				rank_id,
+				start_date,
+				created_at,
+				updated_at
+			)
+			VALUES
+			(
+				$1,
+				$2,
+				$3,
+				$4,
+				$5,
+				$6::date,
+				$7,
+				$8
+			)
+		`, contact.ID, contact.CompanyID, contact.PostID, contact.PostGOID, contact.RankID, date, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contactAssignmentDelete - delete career timeline of contact
+func contactAssignmentDelete(ctx context.Context, id int64) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("contactAssignmentDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			contact_assignments
+		WHERE
+			contact_id = $1
+	`, id)
+	return err
+}
+
+func contactAssignmentCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			contact_assignments (
+				id         bigserial PRIMARY KEY,
+				contact_id bigint,
+				company_id bigint NOT NULL DEFAULT 0,
+				post_id    bigint NOT NULL DEFAULT 0,
+				post_go_id bigint NOT NULL DEFAULT 0,
+				rank_id    bigint NOT NULL DEFAULT 0,
+				start_date date,
+				end_date   date,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now()
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("contactAssignmentCreateTable exec", err)
+	}
+	return err
+}
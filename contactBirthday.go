@@ -0,0 +1,126 @@
+package edc
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// ContactBirthday - birthday of contact within date range
+// Date        - date of birthday in range, 29 february is celebrated 28 february in non-leap year
+// Age         - age of contact on date
+// Anniversary - age is multiple of 5
+// Round       - age is multiple of 10
+type ContactBirthday struct {
+	ID          int64  `json:"id"           form:"id"           query:"id"`
+	Name        string `json:"name"         form:"name"         query:"name"`
+	CompanyID   int64  `json:"company_id"   form:"company_id"   query:"company_id"`
+	CompanyName string `json:"company_name" form:"company_name" query:"company_name"`
+	PostName    string `json:"post_name"    form:"post_name"    query:"post_name"`
+	PostGOName  string `json:"post_go_name" form:"post_go_name" query:"post_go_name"`
+	Birthday    string `json:"birthday"     form:"birthday"     query:"birthday"`
+	Date        string `json:"date"         form:"date"         query:"date"`
+	DateStr     string `json:"date_str"     form:"date_str"     query:"date_str"`
+	Age         int64  `json:"age"          form:"age"          query:"age"`
+	Anniversary bool   `json:"anniversary"  form:"anniversary"  query:"anniversary"`
+	Round       bool   `json:"round"        form:"round"        query:"round"`
+}
+
+// ContactBirthdayGet - get birthdays of contacts between start and end dates (format 2006-01-02) inclusive
+func ContactBirthdayGet(start, end string) ([]ContactBirthday, error) {
+	var birthdays []ContactBirthday
+	startDate, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		errmsg("ContactBirthdayGet Parse start", err)
+		return birthdays, err
+	}
+	endDate, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		errmsg("ContactBirthdayGet Parse end", err)
+		return birthdays, err
+	}
+	if endDate.Before(startDate) {
+		return birthdays, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			c.id,
+			c.name,
+			COALESCE(c.company_id, 0) AS company_id,
+			COALESCE(co.name, '') AS company_name,
+			COALESCE(po.name, '') AS post_name,
+			COALESCE(pog.name, '') AS post_go_name,
+			c.birthday
+		FROM
+			contacts AS c
+		LEFT JOIN
+			companies AS co ON c.company_id = co.id
+		LEFT JOIN
+			posts AS po ON c.post_id = po.id
+		LEFT JOIN
+			posts AS pog ON c.post_go_id = pog.id
+		WHERE
+			c.birthday IS NOT NULL
+		AND
+			c.deleted_at IS NULL
+	`)
+	if err != nil {
+		errmsg("ContactBirthdayGet Query", err)
+		return birthdays, err
+	}
+	for rows.Next() {
+		var contact ContactBirthday
+		var birthday time.Time
+		err := rows.Scan(&contact.ID, &contact.Name, &contact.CompanyID, &contact.CompanyName, &contact.PostName,
+			&contact.PostGOName, &birthday)
+		if err != nil {
+			errmsg("ContactBirthdayGet Scan", err)
+			return birthdays, err
+		}
+		contact.Birthday = birthday.Format("2006-01-02")
+		for _, date := range birthdayDates(birthday, startDate, endDate) {
+			item := contact
+			item.Date = date.Format("2006-01-02")
+			item.DateStr = setStrMonth(item.Date)
+			item.Age = int64(date.Year() - birthday.Year())
+			item.Anniversary = item.Age%5 == 0
+			item.Round = item.Age%10 == 0
+			birthdays = append(birthdays, item)
+		}
+	}
+	if rows.Err() != nil {
+		errmsg("ContactBirthdayGet rows", rows.Err())
+		return birthdays, rows.Err()
+	}
+	sort.SliceStable(birthdays, func(i, j int) bool {
+		if birthdays[i].Date != birthdays[j].Date {
+			return birthdays[i].Date < birthdays[j].Date
+		}
+		return birthdays[i].Name < birthdays[j].Name
+	})
+	return birthdays, nil
+}
+
+// birthdayDates - dates of birthdays between start and end inclusive, range may span several years
+func birthdayDates(birthday, start, end time.Time) []time.Time {
+	var dates []time.Time
+	for year := start.Year(); year <= end.Year(); year++ {
+		if year <= birthday.Year() {
+			continue
+		}
+		day := birthday.Day()
+		if birthday.Month() == time.February && day == 29 && !leapYear(year) {
+			day = 28
+		}
+		date := time.Date(year, birthday.Month(), day, 0, 0, 0, 0, time.UTC)
+		if date.Before(start) || date.After(end) {
+			continue
+		}
+		dates = append(dates, date)
+	}
+	return dates
+}
+
+func leapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
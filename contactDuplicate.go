@@ -0,0 +1,359 @@
+package edc
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrMerge - merged records are the same record, missing or deleted
+var ErrMerge = errors.New("merged records are the same, missing or deleted")
+
+// ContactDuplicate - pair of contacts which may be the same person
+// Similarity - similarity of names from 0 to 1, order of words is ignored
+type ContactDuplicate struct {
+	ID                   int64   `json:"id"                     form:"id"                     query:"id"`
+	Name                 string  `json:"name"                   form:"name"                   query:"name"`
+	CompanyName          string  `json:"company_name"           form:"company_name"           query:"company_name"`
+	Birthday             string  `json:"birthday"               form:"birthday"               query:"birthday"`
+	DuplicateID          int64   `json:"duplicate_id"           form:"duplicate_id"           query:"duplicate_id"`
+	DuplicateName        string  `json:"duplicate_name"         form:"duplicate_name"         query:"duplicate_name"`
+	DuplicateCompanyName string  `json:"duplicate_company_name" form:"duplicate_company_name" query:"duplicate_company_name"`
+	DuplicateBirthday    string  `json:"duplicate_birthday"     form:"duplicate_birthday"     query:"duplicate_birthday"`
+	Similarity           float64 `json:"similarity"             form:"similarity"             query:"similarity"`
+	SamePhone            bool    `json:"same_phone"             form:"same_phone"             query:"same_phone"`
+	SameEmail            bool    `json:"same_email"             form:"same_email"             query:"same_email"`
+	SameCompany          bool    `json:"same_company"           form:"same_company"           query:"same_company"`
+}
+
+type contactCandidate struct {
+	id          int64
+	name        string
+	key         string
+	companyID   int64
+	companyName string
+	birthday    string
+	phones      []int64
+	emails      []string
+}
+
+// ContactDuplicateGet - get pairs of contacts with similar names, shared phone or shared email.
+// Similarity - minimal similarity of names, 0 for default 0.85.
+// Contacts with shared phone or email and dissimilar names are listed only if they work in the same company.
+func ContactDuplicateGet(similarity float64) ([]ContactDuplicate, error) {
+	var duplicates []ContactDuplicate
+	if similarity == 0 {
+		similarity = 0.85
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			c.id,
+			c.name,
+			COALESCE(c.company_id, 0) AS company_id,
+			COALESCE(co.name, '') AS company_name,
+			COALESCE(c.birthday::text, '') AS birthday,
+			array_remove(array_agg(DISTINCT ph.phone), NULL) AS phones,
+			array_remove(array_agg(DISTINCT lower(e.email)), NULL) AS emails
+		FROM
+			contacts AS c
+		LEFT JOIN
+			companies AS co ON co.id = c.company_id
+		LEFT JOIN
+			phones AS ph ON ph.contact_id = c.id
+		LEFT JOIN
+			emails AS e ON e.contact_id = c.id
+		WHERE
+			c.deleted_at IS NULL
+		GROUP BY
+			c.id,
+			co.name
+		ORDER BY
+			c.id ASC
+	`)
+	if err != nil {
+		errmsg("ContactDuplicateGet Query", err)
+		return duplicates, err
+	}
+	var contacts []contactCandidate
+	for rows.Next() {
+		var contact contactCandidate
+		err := rows.Scan(&contact.id, &contact.name, &contact.companyID, &contact.companyName, &contact.birthday, &contact.phones,
+			&contact.emails)
+		if err != nil {
+			errmsg("ContactDuplicateGet Scan", err)
+			return duplicates, err
+		}
+		contact.key = nameKey(contact.name)
+		contacts = append(contacts, contact)
+	}
+	if rows.Err() != nil {
+		errmsg("ContactDuplicateGet rows", rows.Err())
+		return duplicates, rows.Err()
+	}
+	for i := range contacts {
+		for j := i + 1; j < len(contacts); j++ {
+			a, b := contacts[i], contacts[j]
+			if a.key == "" || b.key == "" {
+				continue
+			}
+			duplicate := ContactDuplicate{
+				ID:                   a.id,
+				Name:                 a.name,
+				CompanyName:          a.companyName,
+				Birthday:             a.birthday,
+				DuplicateID:          b.id,
+				DuplicateName:        b.name,
+				DuplicateCompanyName: b.companyName,
+				DuplicateBirthday:    b.birthday,
+				Similarity:           nameSimilarity(a.key, b.key),
+				SamePhone:            sharedInt64(a.phones, b.phones),
+				SameEmail:            sharedString(a.emails, b.emails),
+				SameCompany:          a.companyID != 0 && a.companyID == b.companyID,
+			}
+			if duplicate.Similarity < similarity && !duplicate.SamePhone && !duplicate.SameEmail {
+				continue
+			}
+			if duplicate.Similarity < 0.5 && !duplicate.SameCompany {
+				continue
+			}
+			duplicates = append(duplicates, duplicate)
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicateScore(duplicates[i]) > duplicateScore(duplicates[j])
+	})
+	return duplicates, nil
+}
+
+// ContactMerge - merge duplicate contact into contact inside transaction. Emails, phones, educations,
+// certificates, sirens, hideouts and other references are moved to contact, empty fields of contact
+// are filled from duplicate, merge is recorded to audit, duplicate is deleted.
+func ContactMerge(id, duplicateID int64) error {
+	return ContactMergeCtx(context.Background(), id, duplicateID)
+}
+
+// ContactMergeCtx - ContactMerge with context, actor of context is written to audit log
+func ContactMergeCtx(ctx context.Context, id, duplicateID int64) error {
+	if id == 0 || duplicateID == 0 {
+		return nil
+	}
+	if id == duplicateID {
+		return ErrMerge
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("ContactMerge Begin", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	err = mergeLock(tx, "contacts", id, duplicateID)
+	if err != nil {
+		errmsg("ContactMerge mergeLock", err)
+		return err
+	}
+	err = mergeAudit(tx, "contacts", id, duplicateID)
+	if err != nil {
+		errmsg("ContactMerge mergeAudit", err)
+		return err
+	}
+	deletes := []string{
+		`DELETE FROM emails AS d USING emails AS s
+			WHERE d.contact_id = $2 AND s.contact_id = $1 AND lower(d.email) = lower(s.email)`,
+		`DELETE FROM phones AS d USING phones AS s
+			WHERE d.contact_id = $2 AND s.contact_id = $1 AND d.phone = s.phone AND d.fax = s.fax`,
+		`DELETE FROM practice_participants AS d USING practice_participants AS s
+			WHERE d.contact_id = $2 AND s.contact_id = $1 AND d.practice_id = s.practice_id`,
+		`DELETE FROM course_members AS d USING course_members AS s
+			WHERE d.contact_id = $2 AND s.contact_id = $1 AND d.session_id = s.session_id`,
+		`DELETE FROM company_go_roles AS d USING company_go_roles AS s
+			WHERE d.contact_id = $2 AND s.contact_id = $1 AND d.company_id = s.company_id AND d.post_id = s.post_id`,
+	}
+	for _, query := range deletes {
+		_, err = tx.Exec(ctx, query, id, duplicateID)
+		if err != nil {
+			errmsg("ContactMerge Delete", err)
+			return err
+		}
+	}
+	updates := []string{
+		`UPDATE emails SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE phones SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE educations SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE certificates SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE sirens SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE hideouts SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE tccs SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE desks SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE siren_events SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE practice_participants SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE course_members SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE contact_assignments SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+		`UPDATE company_go_roles SET contact_id = $1, updated_at = $3 WHERE contact_id = $2`,
+	}
+	for _, query := range updates {
+		_, err = tx.Exec(ctx, query, id, duplicateID, time.Now())
+		if err != nil {
+			errmsg("ContactMerge Update", err)
+			return err
+		}
+	}
+	// duplicate is deleted before survivor takes its fields to keep unique (name, birthday)
+	_, err = tx.Exec(ctx, `
+		WITH d AS (
+			DELETE FROM
+				contacts
+			WHERE
+				id = $2
+			RETURNING
+				*
+		)
+		UPDATE contacts AS c SET
+			company_id = CASE WHEN COALESCE(c.company_id, 0) = 0 THEN d.company_id ELSE c.company_id END,
+			department_id = CASE WHEN COALESCE(c.department_id, 0) = 0 THEN d.department_id ELSE c.department_id END,
+			post_id = CASE WHEN COALESCE(c.post_id, 0) = 0 THEN d.post_id ELSE c.post_id END,
+			post_go_id = CASE WHEN COALESCE(c.post_go_id, 0) = 0 THEN d.post_go_id ELSE c.post_go_id END,
+			rank_id = CASE WHEN COALESCE(c.rank_id, 0) = 0 THEN d.rank_id ELSE c.rank_id END,
+			birthday = COALESCE(c.birthday, d.birthday),
+			note = concat_ws(E'\n', NULLIF(c.note, ''), NULLIF(d.note, '')),
+			updated_at = $3
+		FROM
+			d
+		WHERE
+			c.id = $1
+	`, id, duplicateID, time.Now())
+	if err != nil {
+		errmsg("ContactMerge Exec", err)
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("ContactMerge Commit", err)
+	}
+	return err
+}
+
+// mergeLock - lock merged records until end of transaction, ErrMerge if any of them is missing or in trash
+func mergeLock(tx pgx.Tx, table string, id, duplicateID int64) error {
+	var count int64
+	rows, err := tx.Query(context.Background(), `
+		SELECT
+			id
+		FROM
+			`+pgx.Identifier{table}.Sanitize()+`
+		WHERE
+			id IN ($1, $2)
+		AND
+			deleted_at IS NULL
+		FOR UPDATE
+	`, id, duplicateID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		count++
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	if count != 2 {
+		return ErrMerge
+	}
+	return nil
+}
+
+func duplicateScore(duplicate ContactDuplicate) float64 {
+	score := duplicate.Similarity
+	if duplicate.SamePhone {
+		score++
+	}
+	if duplicate.SameEmail {
+		score++
+	}
+	if duplicate.SameCompany {
+		score += 0.5
+	}
+	if duplicate.Birthday != "" && duplicate.Birthday == duplicate.DuplicateBirthday {
+		score += 0.5
+	}
+	return score
+}
+
+// nameKey - lower case words of name without punctuation in alphabetical order
+func nameKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(strings.ReplaceAll(name, "ё", "е")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// nameSimilarity - similarity of strings from 0 to 1 by Levenshtein distance
+func nameSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	max := len(ra)
+	if len(rb) > max {
+		max = len(rb)
+	}
+	if max == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(max)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func sharedInt64(a, b []int64) bool {
+	for i := range a {
+		for j := range b {
+			if a[i] != 0 && a[i] == b[j] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sharedString(a, b []string) bool {
+	for i := range a {
+		for j := range b {
+			if a[i] != "" && a[i] == b[j] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,774 @@
+package edc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Course member statuses
+const (
+	CourseMemberEnrolled = "enrolled"
+	CourseMemberWaiting  = "waiting"
+)
+
+// ErrCourseSessionCompleted - session is already completed
+var ErrCourseSessionCompleted = errors.New("course session is completed")
+
+// CourseSession - group of education course run by training center
+// PostID    - post category of course
+// Capacity  - maximum number of enrolled contacts, 0 for unlimited
+// Completed - educations are generated for members
+type CourseSession struct {
+	ID        int64          `sql:"id"         json:"id"         form:"id"         query:"id"`
+	Name      string         `sql:"name"       json:"name"       form:"name"       query:"name"`
+	StartDate string         `sql:"start_date" json:"start_date" form:"start_date" query:"start_date"`
+	EndDate   string         `sql:"end_date"   json:"end_date"   form:"end_date"   query:"end_date"`
+	PostID    int64          `sql:"post_id"    json:"post_id"    form:"post_id"    query:"post_id"`
+	Capacity  int64          `sql:"capacity"   json:"capacity"   form:"capacity"   query:"capacity"`
+	Completed bool           `sql:"completed"  json:"completed"  form:"completed"  query:"completed"`
+	Note      string         `sql:"note"       json:"note"       form:"note"       query:"note"`
+	Version   int64          `sql:"version"    json:"version"    form:"version"    query:"version"`
+	CreatedAt string         `sql:"created_at" json:"-"`
+	UpdatedAt string         `sql:"updated_at" json:"-"`
+	Members   []CourseMember `sql:"-"          json:"members"    form:"members"    query:"members"`
+}
+
+// CourseSessionList - struct for course session list
+type CourseSessionList struct {
+	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
+	Name      string `sql:"name"       json:"name"       form:"name"       query:"name"`
+	StartDate string `sql:"start_date" json:"start_date" form:"start_date" query:"start_date"`
+	EndDate   string `sql:"end_date"   json:"end_date"   form:"end_date"   query:"end_date"`
+	PostID    int64  `sql:"post_id"    json:"post_id"    form:"post_id"    query:"post_id"`
+	PostName  string `sql:"post_name"  json:"post_name"  form:"post_name"  query:"post_name"`
+	Capacity  int64  `sql:"capacity"   json:"capacity"   form:"capacity"   query:"capacity"`
+	Enrolled  int64  `sql:"enrolled"   json:"enrolled"   form:"enrolled"   query:"enrolled"`
+	Waiting   int64  `sql:"waiting"    json:"waiting"    form:"waiting"    query:"waiting"`
+	Completed bool   `sql:"completed"  json:"completed"  form:"completed"  query:"completed"`
+	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
+}
+
+// CourseMember - contact enrolled to course session or waiting for free seat
+// Status      - enrolled or waiting, waiting list is ordered by enrolment time
+// EducationID - education generated for member on session completion
+type CourseMember struct {
+	ID          int64  `sql:"id"           json:"id"           form:"id"           query:"id"`
+	SessionID   int64  `sql:"session_id"   json:"session_id"   form:"session_id"   query:"session_id"`
+	ContactID   int64  `sql:"contact_id"   json:"contact_id"   form:"contact_id"   query:"contact_id"`
+	ContactName string `sql:"-"            json:"contact_name" form:"contact_name" query:"contact_name"`
+	CompanyName string `sql:"-"            json:"company_name" form:"company_name" query:"company_name"`
+	Status      string `sql:"status"       json:"status"       form:"status"       query:"status"`
+	Attended    bool   `sql:"attended"     json:"attended"     form:"attended"     query:"attended"`
+	Passed      bool   `sql:"passed"       json:"passed"       form:"passed"       query:"passed"`
+	ExamResult  string `sql:"exam_result"  json:"exam_result"  form:"exam_result"  query:"exam_result"`
+	EducationID int64  `sql:"education_id" json:"education_id" form:"education_id" query:"education_id"`
+	Version     int64  `sql:"version"      json:"version"      form:"version"      query:"version"`
+}
+
+// CourseSessionGet - get one course session by id with members
+func CourseSessionGet(id int64) (CourseSession, error) {
+	var courseSession CourseSession
+	if id == 0 {
+		return courseSession, nil
+	}
+	courseSession.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			name,
+			start_date,
+			end_date,
+			post_id,
+			capacity,
+			completed,
+			note,
+			version,
+			created_at,
+			updated_at
+		FROM
+			course_sessions
+		WHERE
+			id = $1
+	`, id).Scan(&courseSession.Name, &courseSession.StartDate, &courseSession.EndDate, &courseSession.PostID, &courseSession.Capacity,
+		&courseSession.Completed, &courseSession.Note, &courseSession.Version, &courseSession.CreatedAt, &courseSession.UpdatedAt)
+	if err != nil {
+		errmsg("CourseSessionGet QueryRow", err)
+		return courseSession, err
+	}
+	courseSession.Members, err = CourseMemberGet(id)
+	return courseSession, err
+}
+
+// CourseSessionListGet - get all course sessions for list
+func CourseSessionListGet() ([]CourseSessionList, error) {
+	var courseSessions []CourseSessionList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			s.id,
+			s.name,
+			s.start_date,
+			s.end_date,
+			s.post_id,
+			COALESCE(p.name, '') AS post_name,
+			s.capacity,
+			count(m.id) FILTER (WHERE m.status = $1) AS enrolled,
+			count(m.id) FILTER (WHERE m.status = $2) AS waiting,
+			s.completed,
+			s.note
+		FROM
+			course_sessions AS s
+		LEFT JOIN
+			posts AS p ON p.id = s.post_id
+		LEFT JOIN
+			course_members AS m ON m.session_id = s.id
+		GROUP BY
+			s.id,
+			p.name
+		ORDER BY
+			s.start_date DESC
+	`, CourseMemberEnrolled, CourseMemberWaiting)
+	if err != nil {
+		errmsg("CourseSessionListGet Query", err)
+		return courseSessions, err
+	}
+	for rows.Next() {
+		var courseSession CourseSessionList
+		err := rows.Scan(&courseSession.ID, &courseSession.Name, &courseSession.StartDate, &courseSession.EndDate, &courseSession.PostID,
+			&courseSession.PostName, &courseSession.Capacity, &courseSession.Enrolled, &courseSession.Waiting, &courseSession.Completed,
+			&courseSession.Note)
+		if err != nil {
+			errmsg("CourseSessionListGet Scan", err)
+			return courseSessions, err
+		}
+		courseSessions = append(courseSessions, courseSession)
+	}
+	return courseSessions, rows.Err()
+}
+
+// CourseMemberGet - get enrolled and waiting members of course session
+func CourseMemberGet(id int64) ([]CourseMember, error) {
+	var members []CourseMember
+	if id == 0 {
+		return members, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			m.id,
+			m.session_id,
+			m.contact_id,
+			COALESCE(c.name, '') AS contact_name,
+			COALESCE(co.name, '') AS company_name,
+			m.status,
+			m.attended,
+			m.passed,
+			m.exam_result,
+			m.education_id,
+			m.version
+		FROM
+			course_members AS m
+		LEFT JOIN
+			contacts AS c ON c.id = m.contact_id
+		LEFT JOIN
+			companies AS co ON co.id = c.company_id
+		WHERE
+			m.session_id = $1
+		AND
+			c.deleted_at IS NULL
+		ORDER BY
+			m.status = $2 DESC,
+			m.id ASC
+	`, id, CourseMemberEnrolled)
+	if err != nil {
+		errmsg("CourseMemberGet Query", err)
+		return members, err
+	}
+	for rows.Next() {
+		var member CourseMember
+		err := rows.Scan(&member.ID, &member.SessionID, &member.ContactID, &member.ContactName, &member.CompanyName, &member.Status,
+			&member.Attended, &member.Passed, &member.ExamResult, &member.EducationID, &member.Version)
+		if err != nil {
+			errmsg("CourseMemberGet Scan", err)
+			return members, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// CourseSessionInsert - create new course session
+func CourseSessionInsert(courseSession CourseSession) (int64, error) {
+	return CourseSessionInsertCtx(context.Background(), courseSession)
+}
+
+// CourseSessionInsertCtx - CourseSessionInsert with context, actor of context is written to audit log
+func CourseSessionInsertCtx(ctx context.Context, courseSession CourseSession) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CourseSessionInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO course_sessions
+		(
+			name,
+			start_date,
+			end_date,
+			post_id,
+			capacity,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6,
+			$7,
+			$8
+		)
+		RETURNING
+			id
+	`, courseSession.Name, courseSession.StartDate, courseSession.EndDate, courseSession.PostID, courseSession.Capacity,
+		courseSession.Note, time.Now(), time.Now()).Scan(&courseSession.ID)
+	if err != nil {
+		errmsg("CourseSessionInsert QueryRow", err)
+	}
+	return courseSession.ID, err
+}
+
+// CourseSessionUpdate - save course session changes, waiting contacts are enrolled if capacity is increased
+func CourseSessionUpdate(courseSession CourseSession) error {
+	return CourseSessionUpdateCtx(context.Background(), courseSession)
+}
+
+// CourseSessionUpdateCtx - CourseSessionUpdate with context, actor of context is written to audit log
+func CourseSessionUpdateCtx(ctx context.Context, courseSession CourseSession) error {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CourseSessionUpdate Begin", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `
+		UPDATE course_sessions SET
+			name = $2,
+			start_date = $3,
+			end_date = $4,
+			post_id = $5,
+			capacity = $6,
+			note = $7,
+			updated_at = $8,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $9
+	`, courseSession.ID, courseSession.Name, courseSession.StartDate, courseSession.EndDate, courseSession.PostID,
+		courseSession.Capacity, courseSession.Note, time.Now(), courseSession.Version)
+	if err != nil {
+		errmsg("CourseSessionUpdate Exec", err)
+		return err
+	}
+	err = versionCheck("course_sessions", courseSession.ID, courseSession.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return CourseSessionGet(courseSession.ID)
+	})
+	if err != nil {
+		return err
+	}
+	err = courseWaitingPromote(tx, courseSession.ID)
+	if err != nil {
+		errmsg("CourseSessionUpdate courseWaitingPromote", err)
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("CourseSessionUpdate Commit", err)
+	}
+	return err
+}
+
+// CourseSessionDelete - delete course session with members by id
+func CourseSessionDelete(id int64) error {
+	return CourseSessionDeleteCtx(context.Background(), id)
+}
+
+// CourseSessionDeleteCtx - CourseSessionDelete with context, actor of context is written to audit log
+func CourseSessionDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CourseSessionDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, _, err = courseSessionLock(tx, id)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		errmsg("CourseSessionDelete courseSessionLock", err)
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			course_members
+		WHERE
+			session_id = $1
+	`, id)
+	if err != nil {
+		errmsg("CourseSessionDelete members Exec", err)
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			course_sessions
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("CourseSessionDelete Exec", err)
+	}
+	return err
+}
+
+// CourseSessionEnrol - enrol contact to course session, contact is put to waiting list if there is no free seat.
+// Returns status of member.
+func CourseSessionEnrol(id, contactID int64) (string, error) {
+	return CourseSessionEnrolCtx(context.Background(), id, contactID)
+}
+
+// CourseSessionEnrolCtx - CourseSessionEnrol with context, actor of context is written to audit log
+func CourseSessionEnrolCtx(ctx context.Context, id, contactID int64) (string, error) {
+	var status string
+	if id == 0 || contactID == 0 {
+		return status, nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CourseSessionEnrol Begin", err)
+		return status, err
+	}
+	defer tx.Rollback(ctx)
+	capacity, completed, err := courseSessionLock(tx, id)
+	if err != nil {
+		errmsg("CourseSessionEnrol courseSessionLock", err)
+		return status, err
+	}
+	if completed {
+		return status, ErrCourseSessionCompleted
+	}
+	err = tx.QueryRow(ctx, `
+		SELECT
+			status
+		FROM
+			course_members
+		WHERE
+			session_id = $1
+		AND
+			contact_id = $2
+	`, id, contactID).Scan(&status)
+	if err == nil {
+		return status, nil
+	}
+	if err != pgx.ErrNoRows {
+		errmsg("CourseSessionEnrol QueryRow", err)
+		return status, err
+	}
+	status = CourseMemberEnrolled
+	if capacity > 0 {
+		var enrolled int64
+		err = tx.QueryRow(ctx, `
+			SELECT
+				count(*)
+			FROM
+				course_members
+			WHERE
+				session_id = $1
+			AND
+				status = $2
+		`, id, CourseMemberEnrolled).Scan(&enrolled)
+		if err != nil {
+			errmsg("CourseSessionEnrol count", err)
+			return status, err
+		}
+		if enrolled >= capacity {
+			status = CourseMemberWaiting
+		}
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO course_members
+		(
+			session_id,
+			contact_id,
+			status,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5
+		)
+	`, id, contactID, status, time.Now(), time.Now())
+	if err != nil {
+		errmsg("CourseSessionEnrol Insert", err)
+		return status, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("CourseSessionEnrol Commit", err)
+	}
+	return status, err
+}
+
+// CourseSessionWithdraw - remove contact from course session, freed seat is given to first waiting contact
+func CourseSessionWithdraw(id, contactID int64) error {
+	return CourseSessionWithdrawCtx(context.Background(), id, contactID)
+}
+
+// CourseSessionWithdrawCtx - CourseSessionWithdraw with context, actor of context is written to audit log
+func CourseSessionWithdrawCtx(ctx context.Context, id, contactID int64) error {
+	if id == 0 || contactID == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CourseSessionWithdraw Begin", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	_, completed, err := courseSessionLock(tx, id)
+	if err != nil {
+		errmsg("CourseSessionWithdraw courseSessionLock", err)
+		return err
+	}
+	if completed {
+		return ErrCourseSessionCompleted
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			course_members
+		WHERE
+			session_id = $1
+		AND
+			contact_id = $2
+	`, id, contactID)
+	if err != nil {
+		errmsg("CourseSessionWithdraw Exec", err)
+		return err
+	}
+	err = courseWaitingPromote(tx, id)
+	if err != nil {
+		errmsg("CourseSessionWithdraw courseWaitingPromote", err)
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("CourseSessionWithdraw Commit", err)
+	}
+	return err
+}
+
+// CourseMemberUpdate - save attendance and exam result of enrolled member
+func CourseMemberUpdate(member CourseMember) error {
+	return CourseMemberUpdateCtx(context.Background(), member)
+}
+
+// CourseMemberUpdateCtx - CourseMemberUpdate with context, actor of context is written to audit log
+func CourseMemberUpdateCtx(ctx context.Context, member CourseMember) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CourseMemberUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		UPDATE course_members SET
+			attended = $3,
+			passed = $4,
+			exam_result = $5,
+			updated_at = $6,
+			version = version + 1
+		WHERE
+			session_id = $1
+		AND
+			contact_id = $2
+		AND
+			status = $7
+		AND
+			version = $8
+	`, member.SessionID, member.ContactID, member.Attended, member.Passed, member.ExamResult, time.Now(), CourseMemberEnrolled,
+		member.Version)
+	if err != nil {
+		errmsg("CourseMemberUpdate Exec", err)
+		return err
+	}
+	return versionCheck("course_members", member.ID, member.Version, tag.RowsAffected(), func() (interface{}, error) {
+		members, err := CourseMemberGet(member.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		for _, current := range members {
+			if current.ContactID == member.ContactID {
+				return current, nil
+			}
+		}
+		return nil, pgx.ErrNoRows
+	})
+}
+
+// CourseSessionComplete - complete course session and generate educations for enrolled members
+// who attended and passed exam. Returns number of generated educations.
+func CourseSessionComplete(id int64) (int64, error) {
+	return CourseSessionCompleteCtx(context.Background(), id)
+}
+
+// CourseSessionCompleteCtx - CourseSessionComplete with context, actor of context is written to audit log
+func CourseSessionCompleteCtx(ctx context.Context, id int64) (int64, error) {
+	var count int64
+	if id == 0 {
+		return count, nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CourseSessionComplete Begin", err)
+		return count, err
+	}
+	defer tx.Rollback(ctx)
+	_, completed, err := courseSessionLock(tx, id)
+	if err != nil {
+		errmsg("CourseSessionComplete courseSessionLock", err)
+		return count, err
+	}
+	if completed {
+		return count, ErrCourseSessionCompleted
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT
+			m.id,
+			m.contact_id,
+			COALESCE(s.start_date::text, ''),
+			COALESCE(s.end_date::text, ''),
+			s.post_id,
+			s.name
+		FROM
+			course_members AS m
+		INNER JOIN
+			course_sessions AS s ON s.id = m.session_id
+		INNER JOIN
+			contacts AS c ON c.id = m.contact_id
+		WHERE
+			m.session_id = $1
+		AND
+			c.deleted_at IS NULL
+		AND
+			m.status = $2
+		AND
+			m.attended = true
+		AND
+			m.passed = true
+		AND
+			m.education_id = 0
+		ORDER BY
+			m.id ASC
+	`, id, CourseMemberEnrolled)
+	if err != nil {
+		errmsg("CourseSessionComplete Query", err)
+		return count, err
+	}
+	var members []int64
+	var educations []Education
+	for rows.Next() {
+		var memberID int64
+		var education Education
+		err := rows.Scan(&memberID, &education.ContactID, &education.StartDate, &education.EndDate, &education.PostID, &education.Note)
+		if err != nil {
+			errmsg("CourseSessionComplete Scan", err)
+			rows.Close()
+			return count, err
+		}
+		members = append(members, memberID)
+		educations = append(educations, education)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		errmsg("CourseSessionComplete rows", rows.Err())
+		return count, rows.Err()
+	}
+	for i := range educations {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO educations
+			(
+				contact_id,
+				start_date,
+				end_date,
+				post_id,
+				note,
+				created_at,
+				updated_at
+			)
+			VALUES
+			(
+				$1,
+				NULLIF($2, '')::date,
+				NULLIF($3, '')::date,
+				$4,
+				$5,
+				$6,
+				$7
+			)
+			RETURNING
+				id
+		`, educations[i].ContactID, educations[i].StartDate, educations[i].EndDate, educations[i].PostID, educations[i].Note,
+			time.Now(), time.Now()).Scan(&educations[i].ID)
+		if err != nil {
+			errmsg("CourseSessionComplete Insert", err)
+			return count, err
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE course_members SET
+				education_id = $2,
+				updated_at = $3
+			WHERE
+				id = $1
+		`, members[i], educations[i].ID, time.Now())
+		if err != nil {
+			errmsg("CourseSessionComplete member Exec", err)
+			return count, err
+		}
+		count++
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE course_sessions SET
+			completed = true,
+			updated_at = $2
+		WHERE
+			id = $1
+	`, id, time.Now())
+	if err != nil {
+		errmsg("CourseSessionComplete Exec", err)
+		return count, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("CourseSessionComplete Commit", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// courseSessionLock - lock course session row until end of transaction
+func courseSessionLock(tx pgx.Tx, id int64) (int64, bool, error) {
+	var capacity int64
+	var completed bool
+	err := tx.QueryRow(context.Background(), `
+		SELECT
+			capacity,
+			completed
+		FROM
+			course_sessions
+		WHERE
+			id = $1
+		FOR UPDATE
+	`, id).Scan(&capacity, &completed)
+	return capacity, completed, err
+}
+
+// courseWaitingPromote - enrol waiting contacts in order of enrolment while session has free seats
+func courseWaitingPromote(tx pgx.Tx, id int64) error {
+	capacity, completed, err := courseSessionLock(tx, id)
+	if err != nil || completed {
+		return err
+	}
+	_, err = tx.Exec(context.Background(), `
+		UPDATE course_members SET
+			status = $2,
+			updated_at = $4
+		WHERE
+			id IN (
+				SELECT
+					id
+				FROM
+					course_members
+				WHERE
+					session_id = $1
+				AND
+					status = $3
+				ORDER BY
+					id ASC
+				LIMIT
+					CASE WHEN $5::bigint = 0 THEN NULL ELSE greatest($5 - (
+						SELECT
+							count(*)
+						FROM
+							course_members
+						WHERE
+							session_id = $1
+						AND
+							status = $2
+					), 0) END
+			)
+	`, id, CourseMemberEnrolled, CourseMemberWaiting, time.Now(), capacity)
+	return err
+}
+
+func courseSessionCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			course_sessions (
+				id         bigserial PRIMARY KEY,
+				name       text,
+				start_date date,
+				end_date   date,
+				post_id    bigint,
+				capacity   bigint NOT NULL DEFAULT 0,
+				completed  bool NOT NULL DEFAULT false,
+				note       text,
+				version    bigint NOT NULL DEFAULT 0,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now()
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("courseSessionCreateTable exec", err)
+	}
+	return err
+}
+
+func courseMemberCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			course_members (
+				id           bigserial PRIMARY KEY,
+				session_id   bigint,
+				contact_id   bigint,
+				status       text,
+				attended     bool NOT NULL DEFAULT false,
+				passed       bool NOT NULL DEFAULT false,
+				exam_result  text NOT NULL DEFAULT '',
+				education_id bigint NOT NULL DEFAULT 0,
+				version      bigint NOT NULL DEFAULT 0,
+				created_at   TIMESTAMP without time zone,
+				updated_at   TIMESTAMP without time zone default now(),
+				UNIQUE(session_id, contact_id)
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("courseMemberCreateTable exec", err)
+	}
+	return err
+}
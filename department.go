@@ -2,23 +2,57 @@ package edc
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
+// ErrDepartmentCycle - department can't be parent of itself, of its ancestor or belong to another company
+var ErrDepartmentCycle = errors.New("department parent makes cycle or belongs to another company")
+
 // Department - struct for department
+// CompanyID - company owning department
+// ParentID  - parent department of same company, 0 for top level department
 type Department struct {
-	ID        int64  `sql:"id"         json:"id"   form:"id"   query:"id"`
-	Name      string `sql:"name"       json:"name" form:"name" query:"name"`
-	Note      string `sql:"note"       json:"note" form:"note" query:"note"`
-	CreatedAt string `sql:"created_at" json:"-"    form:"-"    query:"-"`
-	UpdatedAt string `sql:"updated_at" json:"-"    form:"-"    query:"-"`
+	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
+	Name      string `sql:"name"       json:"name"       form:"name"       query:"name"`
+	CompanyID int64  `sql:"company_id" json:"company_id" form:"company_id" query:"company_id"`
+	ParentID  int64  `sql:"parent_id"  json:"parent_id"  form:"parent_id"  query:"parent_id"`
+	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
+	Version   int64  `sql:"version"    json:"version"    form:"version"    query:"version"`
+	CreatedAt string `sql:"created_at" json:"-"          form:"-"          query:"-"`
+	UpdatedAt string `sql:"updated_at" json:"-"          form:"-"          query:"-"`
 }
 
 // DepartmentList - struct for list of departments
 type DepartmentList struct {
-	ID   int64  `sql:"id"   json:"id"   form:"id"   query:"id"`
-	Name string `sql:"name" json:"name" form:"name" query:"name"`
-	Note string `sql:"note" json:"note" form:"note" query:"note"`
+	ID          int64  `sql:"id"           json:"id"           form:"id"           query:"id"`
+	Name        string `sql:"name"         json:"name"         form:"name"         query:"name"`
+	CompanyID   int64  `sql:"company_id"   json:"company_id"   form:"company_id"   query:"company_id"`
+	CompanyName string `sql:"company_name" json:"company_name" form:"company_name" query:"company_name"`
+	ParentID    int64  `sql:"parent_id"    json:"parent_id"    form:"parent_id"    query:"parent_id"`
+	ParentName  string `sql:"parent_name"  json:"parent_name"  form:"parent_name"  query:"parent_name"`
+	Note        string `sql:"note"         json:"note"         form:"note"         query:"note"`
+}
+
+// DepartmentChart - department with its contacts and nested departments
+type DepartmentChart struct {
+	ID       int64             `json:"id"        form:"id"        query:"id"`
+	Name     string            `json:"name"      form:"name"      query:"name"`
+	ParentID int64             `json:"parent_id" form:"parent_id" query:"parent_id"`
+	Level    int64             `json:"level"     form:"level"     query:"level"`
+	Contacts []ContactShort    `json:"contacts"  form:"contacts"  query:"contacts"`
+	Children []DepartmentChart `json:"children"  form:"children"  query:"children"`
+}
+
+// CompanyChart - org chart of company
+// Contacts - contacts of company without department
+type CompanyChart struct {
+	CompanyID   int64             `json:"company_id"   form:"company_id"   query:"company_id"`
+	CompanyName string            `json:"company_name" form:"company_name" query:"company_name"`
+	Contacts    []ContactShort    `json:"contacts"     form:"contacts"     query:"contacts"`
+	Departments []DepartmentChart `json:"departments"  form:"departments"  query:"departments"`
 }
 
 // DepartmentGet - get one department by id
@@ -31,14 +65,18 @@ func DepartmentGet(id int64) (Department, error) {
 	err := pool.QueryRow(context.Background(), `
 		SELECT
 			name,
+			company_id,
+			parent_id,
 			note,
+			version,
 			created_at,
 			updated_at
 		FROM
 			departments
 		WHERE
 			id = $1
-	`, id).Scan(&department.Name, &department.Note, time.Now(), time.Now())
+	`, id).Scan(&department.Name, &department.CompanyID, &department.ParentID, &department.Note, &department.Version, &department.CreatedAt,
+		&department.UpdatedAt)
 	if err != nil {
 		errmsg("DepartmentGet QueryRow", err)
 	}
@@ -47,25 +85,52 @@ func DepartmentGet(id int64) (Department, error) {
 
 // DepartmentListGet - get all department for list
 func DepartmentListGet() ([]DepartmentList, error) {
+	return departmentListQuery("DepartmentListGet", 0)
+}
+
+// DepartmentCompanyGet - get departments of company for list
+func DepartmentCompanyGet(id int64) ([]DepartmentList, error) {
+	if id == 0 {
+		return []DepartmentList{}, nil
+	}
+	return departmentListQuery("DepartmentCompanyGet", id)
+}
+
+func departmentListQuery(name string, companyID int64) ([]DepartmentList, error) {
 	var departments []DepartmentList
 	rows, err := pool.Query(context.Background(), `
 		SELECT
-			id,
-			name,
-			note
+			d.id,
+			d.name,
+			d.company_id,
+			COALESCE(c.name, '') AS company_name,
+			d.parent_id,
+			COALESCE(p.name, '') AS parent_name,
+			d.note
 		FROM
-			departments
+			departments AS d
+		LEFT JOIN
+			companies AS c ON c.id = d.company_id
+		LEFT JOIN
+			departments AS p ON p.id = d.parent_id
+		WHERE
+			c.deleted_at IS NULL
+		AND
+			($1::bigint = 0 OR d.company_id = $1)
 		ORDER BY
-			name ASC
-	`)
+			company_name ASC,
+			d.name ASC
+	`, companyID)
 	if err != nil {
-		errmsg("DepartmentListGet Query", err)
+		errmsg(name+" Query", err)
+		return departments, err
 	}
 	for rows.Next() {
 		var department DepartmentList
-		err := rows.Scan(&department.ID, &department.Name, &department.Note)
+		err := rows.Scan(&department.ID, &department.Name, &department.CompanyID, &department.CompanyName, &department.ParentID,
+			&department.ParentName, &department.Note)
 		if err != nil {
-			errmsg("DepartmentListGet Scan", err)
+			errmsg(name+" Scan", err)
 			return departments, err
 		}
 		departments = append(departments, department)
@@ -100,12 +165,258 @@ func DepartmentSelectGet() ([]SelectItem, error) {
 	return departments, rows.Err()
 }
 
+// DepartmentCompanySelectGet - get departments of company for select
+func DepartmentCompanySelectGet(id int64) ([]SelectItem, error) {
+	var departments []SelectItem
+	if id == 0 {
+		return departments, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			name
+		FROM
+			departments
+		WHERE
+			company_id = $1
+		ORDER BY
+			name ASC
+	`, id)
+	if err != nil {
+		errmsg("DepartmentCompanySelectGet Query", err)
+		return departments, err
+	}
+	for rows.Next() {
+		var department SelectItem
+		err := rows.Scan(&department.ID, &department.Name)
+		if err != nil {
+			errmsg("DepartmentCompanySelectGet Scan", err)
+			return departments, err
+		}
+		departments = append(departments, department)
+	}
+	return departments, rows.Err()
+}
+
+// CompanyChartGet - get org chart of company: departments with nested departments, contacts, posts and GO posts
+func CompanyChartGet(id int64) (CompanyChart, error) {
+	var chart CompanyChart
+	if id == 0 {
+		return chart, nil
+	}
+	chart.CompanyID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			name
+		FROM
+			companies
+		WHERE
+			id = $1
+	`, id).Scan(&chart.CompanyName)
+	if err != nil {
+		errmsg("CompanyChartGet QueryRow", err)
+		return chart, err
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			name,
+			parent_id
+		FROM
+			departments
+		WHERE
+			company_id = $1
+		ORDER BY
+			name ASC
+	`, id)
+	if err != nil {
+		errmsg("CompanyChartGet Query", err)
+		return chart, err
+	}
+	var departments []DepartmentChart
+	for rows.Next() {
+		var department DepartmentChart
+		err := rows.Scan(&department.ID, &department.Name, &department.ParentID)
+		if err != nil {
+			errmsg("CompanyChartGet Scan", err)
+			return chart, err
+		}
+		departments = append(departments, department)
+	}
+	if rows.Err() != nil {
+		errmsg("CompanyChartGet rows", rows.Err())
+		return chart, rows.Err()
+	}
+	rows, err = pool.Query(context.Background(), `
+		SELECT
+			c.id,
+			c.name,
+			COALESCE(c.department_id, 0) AS department_id,
+			COALESCE(d.name, '') AS department_name,
+			COALESCE(po.name, '') AS post_name,
+			COALESCE(pog.name, '') AS post_go_name
+		FROM
+			contacts AS c
+		LEFT JOIN
+			departments AS d ON d.id = c.department_id AND d.company_id = c.company_id
+		LEFT JOIN
+			posts AS po ON po.id = c.post_id
+		LEFT JOIN
+			posts AS pog ON pog.id = c.post_go_id
+		WHERE
+			c.company_id = $1
+		AND
+			c.deleted_at IS NULL
+		ORDER BY
+			c.name ASC
+	`, id)
+	if err != nil {
+		errmsg("CompanyChartGet contacts Query", err)
+		return chart, err
+	}
+	contacts := make(map[int64][]ContactShort)
+	for rows.Next() {
+		var contact ContactShort
+		var departmentID int64
+		err := rows.Scan(&contact.ID, &contact.Name, &departmentID, &contact.DepartmentName, &contact.PostName, &contact.PostGOName)
+		if err != nil {
+			errmsg("CompanyChartGet contacts Scan", err)
+			return chart, err
+		}
+		contact.CompanyName = chart.CompanyName
+		if contact.DepartmentName == "" {
+			departmentID = 0
+		}
+		contacts[departmentID] = append(contacts[departmentID], contact)
+	}
+	if rows.Err() != nil {
+		errmsg("CompanyChartGet contacts rows", rows.Err())
+		return chart, rows.Err()
+	}
+	chart.Contacts = contacts[0]
+	chart.Departments = departmentChartBuild(departments, contacts)
+	return chart, nil
+}
+
+// departmentChartBuild - build nested departments with contacts, departments with missing parent
+// and departments in cycle are top level
+func departmentChartBuild(departments []DepartmentChart, contacts map[int64][]ContactShort) []DepartmentChart {
+	ids := make(map[int64]bool, len(departments))
+	children := make(map[int64][]DepartmentChart)
+	for _, department := range departments {
+		ids[department.ID] = true
+	}
+	var roots []DepartmentChart
+	for _, department := range departments {
+		if department.ParentID == 0 || !ids[department.ParentID] {
+			roots = append(roots, department)
+		} else {
+			children[department.ParentID] = append(children[department.ParentID], department)
+		}
+	}
+	visited := make(map[int64]bool, len(departments))
+	var build func(department DepartmentChart, level int64) DepartmentChart
+	build = func(department DepartmentChart, level int64) DepartmentChart {
+		visited[department.ID] = true
+		department.Level = level
+		department.Contacts = contacts[department.ID]
+		for _, child := range children[department.ID] {
+			if !visited[child.ID] {
+				department.Children = append(department.Children, build(child, level+1))
+			}
+		}
+		return department
+	}
+	var chart []DepartmentChart
+	for _, department := range roots {
+		chart = append(chart, build(department, 0))
+	}
+	for _, department := range departments {
+		if !visited[department.ID] {
+			chart = append(chart, build(department, 0))
+		}
+	}
+	return chart
+}
+
+// departmentParentCheck - check inside transaction that parent belongs to same company and is not department itself
+// or its descendant, department and parent are locked until end of transaction so concurrent changes can't make cycle
+func departmentParentCheck(ctx context.Context, tx pgx.Tx, department Department) error {
+	if department.ParentID == 0 {
+		return nil
+	}
+	if department.ID == department.ParentID {
+		return ErrDepartmentCycle
+	}
+	_, err := tx.Exec(ctx, `
+		SELECT
+			id
+		FROM
+			departments
+		WHERE
+			id IN ($1, $2)
+		ORDER BY
+			id ASC
+		FOR UPDATE
+	`, department.ID, department.ParentID)
+	if err != nil {
+		return err
+	}
+	var valid bool
+	err = tx.QueryRow(ctx, `
+		WITH RECURSIVE subtree AS (
+			SELECT
+				id
+			FROM
+				departments
+			WHERE
+				id = $1
+			UNION
+			SELECT
+				d.id
+			FROM
+				departments AS d
+			INNER JOIN
+				subtree AS s ON d.parent_id = s.id
+		)
+		SELECT
+			EXISTS (SELECT 1 FROM departments WHERE id = $2 AND company_id = $3)
+		AND
+			NOT EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+	`, department.ID, department.ParentID, department.CompanyID).Scan(&valid)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrDepartmentCycle
+	}
+	return nil
+}
+
 // DepartmentInsert - create new department
 func DepartmentInsert(department Department) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return DepartmentInsertCtx(context.Background(), department)
+}
+
+// DepartmentInsertCtx - DepartmentInsert with context, actor of context is written to audit log
+func DepartmentInsertCtx(ctx context.Context, department Department) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("DepartmentInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = departmentParentCheck(ctx, tx, department)
+	if err != nil {
+		errmsg("DepartmentInsert departmentParentCheck", err)
+		return 0, err
+	}
+	err = tx.QueryRow(ctx, `
 		INSERT INTO departments
 		(
 			name,
+			company_id,
+			parent_id,
 			note,
 			created_at,
 			updated_at
@@ -115,39 +426,96 @@ func DepartmentInsert(department Department) (int64, error) {
 			$1,
 			$2,
 			$3,
-			$4
+			$4,
+			$5,
+			$6
 		)
 		RETURNING
 			id
-	`, department.Name, department.Note, time.Now(), time.Now()).Scan(&department.ID)
+	`, department.Name, department.CompanyID, department.ParentID, department.Note, time.Now(), time.Now()).Scan(&department.ID)
 	if err != nil {
 		errmsg("DepartmentInsert QueryRow", err)
 	}
-	return department.ID, nil
+	return department.ID, err
 }
 
 // DepartmentUpdate - save department changes
 func DepartmentUpdate(department Department) error {
-	_, err := pool.Exec(context.Background(), `
+	return DepartmentUpdateCtx(context.Background(), department)
+}
+
+// DepartmentUpdateCtx - DepartmentUpdate with context, actor of context is written to audit log
+func DepartmentUpdateCtx(ctx context.Context, department Department) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("DepartmentUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = departmentParentCheck(ctx, tx, department)
+	if err != nil {
+		errmsg("DepartmentUpdate departmentParentCheck", err)
+		return err
+	}
+	tag, err := tx.Exec(ctx, `
 		UPDATE departments SET
 			name = $2,
-			note = $3,
-			updated_at = $4
+			company_id = $3,
+			parent_id = $4,
+			note = $5,
+			updated_at = $6,
+			version = version + 1
 		WHERE
 			id = $1
-	`, department.ID, department.Name, department.Note, time.Now())
+		AND
+			version = $7
+	`, department.ID, department.Name, department.CompanyID, department.ParentID, department.Note, time.Now(), department.Version)
 	if err != nil {
 		errmsg("DepartmentUpdate Exec", err)
+		return err
 	}
-	return err
+	return versionCheck("departments", department.ID, department.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return DepartmentGet(department.ID)
+	})
 }
 
 // DepartmentDelete - delete department by id
 func DepartmentDelete(id int64) error {
+	return DepartmentDeleteCtx(context.Background(), id)
+}
+
+// DepartmentDeleteCtx - DepartmentDelete with context, actor of context is written to audit log
+func DepartmentDeleteCtx(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("DepartmentDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		UPDATE departments SET
+			parent_id = (SELECT parent_id FROM departments WHERE id = $1)
+		WHERE
+			parent_id = $1
+	`, id)
+	if err != nil {
+		errmsg("DeleteDepartment children Exec", err)
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE contacts SET
+			department_id = 0
+		WHERE
+			department_id = $1
+	`, id)
+	if err != nil {
+		errmsg("DeleteDepartment contacts Exec", err)
+		return err
+	}
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			departments
 		WHERE
@@ -165,10 +533,13 @@ func departmentCreateTable() error {
 			departments (
 				id bigserial primary key,
 				name text,
+				company_id bigint NOT NULL DEFAULT 0,
+				parent_id bigint NOT NULL DEFAULT 0,
 				note text,
+				version bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
-				UNIQUE(name)
+				UNIQUE(company_id, parent_id, name)
 			)
 	`
 	_, err := pool.Exec(context.Background(), str)
@@ -0,0 +1,488 @@
+package edc
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Desk - struct for siren control desk
+// RadioChannels - ids of radio channels controlled from desk
+type Desk struct {
+	ID            int64   `sql:"id"         json:"id"             form:"id"             query:"id"`
+	Name          string  `sql:"name"       json:"name"           form:"name"           query:"name"`
+	Address       string  `sql:"address"    json:"address"        form:"address"        query:"address"`
+	ContactID     int64   `sql:"contact_id" json:"contact_id"     form:"contact_id"     query:"contact_id"`
+	Note          string  `sql:"note"       json:"note"           form:"note"           query:"note"`
+	Version       int64   `sql:"version"    json:"version"        form:"version"        query:"version"`
+	CreatedAt     string  `sql:"created_at" json:"-"`
+	UpdatedAt     string  `sql:"updated_at" json:"-"`
+	RadioChannels []int64 `sql:"-"          json:"radio_channels" form:"radio_channels" query:"radio_channels"`
+}
+
+// DeskList - struct for desk list
+type DeskList struct {
+	ID                int64    `sql:"id"                  json:"id"                  form:"id"                  query:"id"`
+	Name              string   `sql:"name"                json:"name"                form:"name"                query:"name"`
+	Address           string   `sql:"address"             json:"address"             form:"address"             query:"address"`
+	ContactName       string   `sql:"contact_name"        json:"contact_name"        form:"contact_name"        query:"contact_name"`
+	RadioChannelNames []string `sql:"radio_channel_names" json:"radio_channel_names" form:"radio_channel_names" query:"radio_channel_names" pg:",array"`
+	Note              string   `sql:"note"                json:"note"                form:"note"                query:"note"`
+}
+
+// sirenDesks - sirens with desks they can be triggered from, directly or by radio channel
+const sirenDesks = `
+	WITH siren_desks AS (
+		SELECT
+			id AS siren_id,
+			desk_id
+		FROM
+			sirens
+		WHERE
+			desk_id > 0
+		AND
+			deleted_at IS NULL
+		UNION
+		SELECT
+			s.id AS siren_id,
+			dr.desk_id
+		FROM
+			sirens AS s
+		INNER JOIN
+			desk_radio_channels AS dr ON dr.radio_channel_id = s.radio_channel_id
+		WHERE
+			s.deleted_at IS NULL
+	)`
+
+// DeskGet - get one desk by id
+func DeskGet(id int64) (Desk, error) {
+	var desk Desk
+	if id == 0 {
+		return desk, nil
+	}
+	desk.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			d.name,
+			d.address,
+			d.contact_id,
+			d.note,
+			d.version,
+			d.created_at,
+			d.updated_at,
+			array_remove(array_agg(DISTINCT dr.radio_channel_id), NULL) AS radio_channels
+		FROM
+			desks AS d
+		LEFT JOIN
+			desk_radio_channels AS dr ON dr.desk_id = d.id
+		WHERE
+			d.id = $1
+		GROUP BY
+			d.id
+	`, id).Scan(&desk.Name, &desk.Address, &desk.ContactID, &desk.Note, &desk.Version, &desk.CreatedAt, &desk.UpdatedAt, &desk.RadioChannels)
+	if err != nil {
+		errmsg("DeskGet QueryRow", err)
+	}
+	return desk, err
+}
+
+// DeskListGet - get all desks for list
+func DeskListGet() ([]DeskList, error) {
+	var desks []DeskList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			d.id,
+			d.name,
+			d.address,
+			c.name AS contact_name,
+			array_remove(array_agg(DISTINCT r.name), NULL) AS radio_channel_names,
+			d.note
+		FROM
+			desks AS d
+		LEFT JOIN
+			contacts AS c ON c.id = d.contact_id
+		LEFT JOIN
+			desk_radio_channels AS dr ON dr.desk_id = d.id
+		LEFT JOIN
+			radio_channels AS r ON r.id = dr.radio_channel_id
+		GROUP BY
+			d.id,
+			c.name
+		ORDER BY
+			d.name ASC
+	`)
+	if err != nil {
+		errmsg("DeskListGet Query", err)
+		return desks, err
+	}
+	for rows.Next() {
+		var desk DeskList
+		err := rows.Scan(&desk.ID, &desk.Name, &desk.Address, &desk.ContactName, &desk.RadioChannelNames, &desk.Note)
+		if err != nil {
+			errmsg("DeskListGet Scan", err)
+			return desks, err
+		}
+		desks = append(desks, desk)
+	}
+	return desks, rows.Err()
+}
+
+// DeskSelectGet - get all desks for select
+func DeskSelectGet() ([]SelectItem, error) {
+	var desks []SelectItem
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			name
+		FROM
+			desks
+		ORDER BY
+			name ASC
+	`)
+	if err != nil {
+		errmsg("DeskSelectGet Query", err)
+		return desks, err
+	}
+	for rows.Next() {
+		var desk SelectItem
+		err := rows.Scan(&desk.ID, &desk.Name)
+		if err != nil {
+			errmsg("DeskSelectGet Scan", err)
+			return desks, err
+		}
+		desks = append(desks, desk)
+	}
+	return desks, rows.Err()
+}
+
+// DeskInsert - create new desk with radio channels in one transaction
+func DeskInsert(desk Desk) (int64, error) {
+	return DeskInsertCtx(context.Background(), desk)
+}
+
+// DeskInsertCtx - DeskInsert with context, actor of context is written to audit log
+func DeskInsertCtx(ctx context.Context, desk Desk) (int64, error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("DeskInsert Begin", err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO desks
+		(
+			name,
+			address,
+			contact_id,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6
+		)
+		RETURNING
+			id
+	`, desk.Name, desk.Address, desk.ContactID, desk.Note, time.Now(), time.Now()).Scan(&desk.ID)
+	if err != nil {
+		errmsg("DeskInsert QueryRow", err)
+		return 0, err
+	}
+	err = deskRadioChannelSave(ctx, tx, desk.ID, desk.RadioChannels)
+	if err != nil {
+		errmsg("DeskInsert deskRadioChannelSave", err)
+		return 0, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("DeskInsert Commit", err)
+		return 0, err
+	}
+	return desk.ID, nil
+}
+
+// DeskUpdate - save desk changes with radio channels in one transaction
+func DeskUpdate(desk Desk) error {
+	return DeskUpdateCtx(context.Background(), desk)
+}
+
+// DeskUpdateCtx - DeskUpdate with context, actor of context is written to audit log
+func DeskUpdateCtx(ctx context.Context, desk Desk) error {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("DeskUpdate Begin", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `
+		UPDATE desks SET
+			name = $2,
+			address = $3,
+			contact_id = $4,
+			note = $5,
+			updated_at = $6,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $7
+	`, desk.ID, desk.Name, desk.Address, desk.ContactID, desk.Note, time.Now(), desk.Version)
+	if err != nil {
+		errmsg("DeskUpdate Exec", err)
+		return err
+	}
+	err = versionCheck("desks", desk.ID, desk.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return DeskGet(desk.ID)
+	})
+	if err != nil {
+		return err
+	}
+	err = deskRadioChannelSave(ctx, tx, desk.ID, desk.RadioChannels)
+	if err != nil {
+		errmsg("DeskUpdate deskRadioChannelSave", err)
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("DeskUpdate Commit", err)
+	}
+	return err
+}
+
+// DeskDelete - delete desk by id with its radio channels
+func DeskDelete(id int64) error {
+	return DeskDeleteCtx(context.Background(), id)
+}
+
+// DeskDeleteCtx - DeskDelete with context, actor of context is written to audit log
+func DeskDeleteCtx(ctx context.Context, id int64) error {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("DeskDelete Begin", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	err = deskRadioChannelSave(ctx, tx, id, nil)
+	if err != nil {
+		errmsg("DeskDelete deskRadioChannelSave", err)
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			desks
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("DeskDelete Exec", err)
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("DeskDelete Commit", err)
+	}
+	return err
+}
+
+// DeskRadioChannelUpdate - update radio channels controlled from desk
+func DeskRadioChannelUpdate(id int64, radioChannels []int64) error {
+	return DeskRadioChannelUpdateCtx(context.Background(), id, radioChannels)
+}
+
+// DeskRadioChannelUpdateCtx - DeskRadioChannelUpdate with context, actor of context is written to audit log
+func DeskRadioChannelUpdateCtx(ctx context.Context, id int64, radioChannels []int64) error {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("DeskRadioChannelUpdate Begin", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	err = deskRadioChannelSave(ctx, tx, id, radioChannels)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("DeskRadioChannelUpdate Commit", err)
+	}
+	return err
+}
+
+// deskRadioChannelSave - replace radio channels of desk inside transaction
+func deskRadioChannelSave(ctx context.Context, tx pgx.Tx, id int64, radioChannels []int64) error {
+	_, err := tx.Exec(ctx, `
+		DELETE FROM
+			desk_radio_channels
+		WHERE
+			desk_id = $1
+	`, id)
+	if err != nil {
+		errmsg("deskRadioChannelSave Exec", err)
+		return err
+	}
+	for i := range radioChannels {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO desk_radio_channels
+			(
+				desk_id,
+				radio_channel_id
+			)
+			VALUES
+			(
+				$1,
+				$2
+			)
+		`, id, radioChannels[i])
+		if err != nil {
+			errmsg("deskRadioChannelSave Insert", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// SirenDeskGet - get all sirens triggered from desk
+func SirenDeskGet(id int64) ([]SirenList, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	return sirenListQuery("SirenDeskGet", sirenDesks+`
+		SELECT
+			s.id,
+			s.address,
+			t.name AS siren_type_name,
+			c.name AS contact_name,
+			array_agg(DISTINCT ph.phone) AS phones
+		FROM
+			sirens AS s
+		LEFT JOIN
+			siren_types AS t ON s.siren_type_id = t.id
+		LEFT JOIN
+			contacts AS c ON s.contact_id = c.id
+		LEFT JOIN
+			phones AS ph ON s.contact_id = ph.contact_id AND ph.fax = false
+		WHERE
+			s.deleted_at IS NULL
+		AND
+			s.id IN (SELECT siren_id FROM siren_desks WHERE desk_id = $1)
+		GROUP BY
+			s.id,
+			t.id,
+			c.id
+		ORDER BY
+			s.address ASC
+	`, id)
+}
+
+// SirenDeskFailGet - get all sirens which go silent if desk fails
+func SirenDeskFailGet(id int64) ([]SirenList, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	return sirenListQuery("SirenDeskFailGet", sirenDesks+`
+		SELECT
+			s.id,
+			s.address,
+			t.name AS siren_type_name,
+			c.name AS contact_name,
+			array_agg(DISTINCT ph.phone) AS phones
+		FROM
+			sirens AS s
+		LEFT JOIN
+			siren_types AS t ON s.siren_type_id = t.id
+		LEFT JOIN
+			contacts AS c ON s.contact_id = c.id
+		LEFT JOIN
+			phones AS ph ON s.contact_id = ph.contact_id AND ph.fax = false
+		WHERE
+			s.deleted_at IS NULL
+		AND
+			s.id IN (SELECT siren_id FROM siren_desks WHERE desk_id = $1)
+		AND
+			s.id NOT IN (SELECT siren_id FROM siren_desks WHERE desk_id <> $1)
+		GROUP BY
+			s.id,
+			t.id,
+			c.id
+		ORDER BY
+			s.address ASC
+	`, id)
+}
+
+// SirenUnreachableGet - get all sirens which can not be triggered from any desk
+func SirenUnreachableGet() ([]SirenList, error) {
+	return sirenListQuery("SirenUnreachableGet", sirenDesks+`
+		SELECT
+			s.id,
+			s.address,
+			t.name AS siren_type_name,
+			c.name AS contact_name,
+			array_agg(DISTINCT ph.phone) AS phones
+		FROM
+			sirens AS s
+		LEFT JOIN
+			siren_types AS t ON s.siren_type_id = t.id
+		LEFT JOIN
+			contacts AS c ON s.contact_id = c.id
+		LEFT JOIN
+			phones AS ph ON s.contact_id = ph.contact_id AND ph.fax = false
+		WHERE
+			s.deleted_at IS NULL
+		AND
+			s.id NOT IN (SELECT siren_id FROM siren_desks)
+		GROUP BY
+			s.id,
+			t.id,
+			c.id
+		ORDER BY
+			s.address ASC
+	`)
+}
+
+func deskCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			desks (
+				id         bigserial PRIMARY KEY,
+				name       text,
+				address    text,
+				contact_id bigint,
+				note       text,
+				version    bigint NOT NULL DEFAULT 0,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now(),
+				UNIQUE(name)
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("deskCreateTable exec", err)
+		return err
+	}
+	str = `
+		CREATE TABLE IF NOT EXISTS
+			desk_radio_channels (
+				desk_id          bigint,
+				radio_channel_id bigint,
+				PRIMARY KEY(desk_id, radio_channel_id)
+			)
+	`
+	_, err = pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("deskCreateTable desk_radio_channels exec", err)
+	}
+	return err
+}
@@ -25,8 +25,12 @@ func InitDB(
 	logsql,
 	logerr bool,
 ) error {
-	var err error
-	pool, err = pgxpool.Connect(context.Background(), dbURL)
+	config, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to parse database url: %v\n", err)
+		os.Exit(1)
+	}
+	pool, err = pgxpool.ConnectConfig(context.Background(), config)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to connection to database: %v\n", err)
 		os.Exit(1)
@@ -89,6 +93,78 @@ func allTablesInsert() error {
 		return err
 	}
 	err = certificateCreateTable()
+	if err != nil {
+		return err
+	}
+	err = sirenEventCreateTable()
+	if err != nil {
+		return err
+	}
+	err = radioChannelCreateTable()
+	if err != nil {
+		return err
+	}
+	err = deskCreateTable()
+	if err != nil {
+		return err
+	}
+	err = practiceFrequencyCreateTable()
+	if err != nil {
+		return err
+	}
+	err = practicePlanCreateTable()
+	if err != nil {
+		return err
+	}
+	err = practiceParticipantCreateTable()
+	if err != nil {
+		return err
+	}
+	err = certificateSeriesCreateTable()
+	if err != nil {
+		return err
+	}
+	err = postTrainingCreateTable()
+	if err != nil {
+		return err
+	}
+	err = courseSessionCreateTable()
+	if err != nil {
+		return err
+	}
+	err = courseMemberCreateTable()
+	if err != nil {
+		return err
+	}
+	err = contactAssignmentCreateTable()
+	if err != nil {
+		return err
+	}
+	err = mergeAuditCreateTable()
+	if err != nil {
+		return err
+	}
+	err = scopeGOPostCreateTable()
+	if err != nil {
+		return err
+	}
+	err = companyGORoleCreateTable()
+	if err != nil {
+		return err
+	}
+	err = addressCreateTable()
+	if err != nil {
+		return err
+	}
+	err = addressRegisterCreateTable()
+	if err != nil {
+		return err
+	}
+	err = auditCreateTable()
+	if err != nil {
+		return err
+	}
+	err = versionCreateTable()
 	// if err != nil {
 	// 	return err
 	// }
@@ -2,17 +2,24 @@ package edc
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrEducationCompleted - education is already completed and certificate is issued
+var ErrEducationCompleted = errors.New("education is completed")
+
 // Education - struct for education
+// Completed - course is closed and certificate is issued
 type Education struct {
-	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id" `
+	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
 	ContactID int64  `sql:"contact_id" json:"contact_id" form:"contact_id" query:"contact_id"`
 	StartDate string `sql:"start_date" json:"start_date" form:"start_date" query:"start_date"`
 	EndDate   string `sql:"end_date"   json:"end_date"   form:"end_date"   query:"end_date"`
 	PostID    int64  `sql:"post_id"    json:"post_id"    form:"post_id"    query:"post_id"`
+	Completed bool   `sql:"completed"  json:"completed"  form:"completed"  query:"completed"`
 	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
+	Version   int64  `sql:"version"    json:"version"    form:"version"    query:"version"`
 	CreatedAt string `sql:"created_at" json:"-"`
 	UpdatedAt string `sql:"updated_at" json:"-"`
 }
@@ -28,6 +35,7 @@ type EducationList struct {
 	EndStr      string `sql:"-"            json:"end_str"      form:"end_str"      query:"end_str"`
 	PostID      int64  `sql:"post_id"      json:"post_id"      form:"post_id"      query:"post_id"`
 	PostName    string `sql:"post_name"    json:"post_name"    form:"post_name"    query:"post_name"`
+	Completed   bool   `sql:"completed"    json:"completed"    form:"completed"    query:"completed"`
 	Note        string `sql:"note"         json:"note"         form:"note"         query:"note"`
 }
 
@@ -39,6 +47,21 @@ type EducationShort struct {
 	StartDate   string `sql:"start_date"   json:"start_date"   form:"start_date"   query:"start_date"`
 }
 
+// EducationHistory - education course or certificate in training history of contact
+// ID is 0 for certificate issued without education course
+type EducationHistory struct {
+	ID            int64  `sql:"id"             json:"id"             form:"id"             query:"id"`
+	StartDate     string `sql:"start_date"     json:"start_date"     form:"start_date"     query:"start_date"`
+	EndDate       string `sql:"end_date"       json:"end_date"       form:"end_date"       query:"end_date"`
+	PostID        int64  `sql:"post_id"        json:"post_id"        form:"post_id"        query:"post_id"`
+	PostName      string `sql:"post_name"      json:"post_name"      form:"post_name"      query:"post_name"`
+	Completed     bool   `sql:"completed"      json:"completed"      form:"completed"      query:"completed"`
+	CertificateID int64  `sql:"certificate_id" json:"certificate_id" form:"certificate_id" query:"certificate_id"`
+	Num           string `sql:"num"            json:"num"            form:"num"            query:"num"`
+	CertDate      string `sql:"cert_date"      json:"cert_date"      form:"cert_date"      query:"cert_date"`
+	ExpiryDate    string `sql:"expiry_date"    json:"expiry_date"    form:"expiry_date"    query:"expiry_date"`
+}
+
 // EducationGet - get education by id
 func EducationGet(id int64) (Education, error) {
 	var education Education
@@ -52,14 +75,17 @@ func EducationGet(id int64) (Education, error) {
 			start_date,
 			end_date,
 			post_id,
+			completed,
 			note,
+			version,
 			created_at,
 			updated_at
 		FROM
 			educations
 		WHERE
 			id = $1
-	`, id).Scan(&education.ContactID, &education.StartDate, &education.EndDate, &education.PostID, &education.Note, &education.CreatedAt, &education.UpdatedAt)
+	`, id).Scan(&education.ContactID, &education.StartDate, &education.EndDate, &education.PostID, &education.Completed, &education.Note,
+		&education.Version, &education.CreatedAt, &education.UpdatedAt)
 	if err != nil {
 		errmsg("EducationGet QueryRow", err)
 	}
@@ -78,6 +104,7 @@ func EducationListGet() ([]EducationList, error) {
 			e.end_date,
 			e.post_id,
 			p.name AS post_name,
+			e.completed,
 			e.note
 		FROM
 			educations AS e
@@ -85,6 +112,8 @@ func EducationListGet() ([]EducationList, error) {
 			contacts AS c ON c.id = e.contact_id
 		LEFT JOIN
 			posts AS p ON p.id = e.post_id
+		WHERE
+			e.deleted_at IS NULL
 		ORDER BY
 			start_date DESC
 	`)
@@ -95,7 +124,7 @@ func EducationListGet() ([]EducationList, error) {
 	for rows.Next() {
 		var education EducationList
 		err := rows.Scan(&education.ID, &education.ContactID, &education.ContactName, &education.StartDate,
-			&education.EndDate, &education.PostID, &education.PostName, &education.Note)
+			&education.EndDate, &education.PostID, &education.PostName, &education.Completed, &education.Note)
 		if err != nil {
 			errmsg("EducationListGet Scan", err)
 			return educations, err
@@ -123,6 +152,8 @@ func EducationNearGet() ([]EducationShort, error) {
 		LEFT JOIN
 			contacts AS c ON c.id = e.contact_id
 		WHERE
+			e.deleted_at IS NULL
+		AND
 			e.start_date > TIMESTAMP 'now'::timestamp - '1 month'::interval
 		ORDER BY
 			start_date ASC
@@ -145,7 +176,18 @@ func EducationNearGet() ([]EducationShort, error) {
 
 // EducationInsert - create new education
 func EducationInsert(education Education) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return EducationInsertCtx(context.Background(), education)
+}
+
+// EducationInsertCtx - EducationInsert with context, actor of context is written to audit log
+func EducationInsertCtx(ctx context.Context, education Education) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("EducationInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO educations
 		(
 			contact_id,
@@ -176,31 +218,243 @@ func EducationInsert(education Education) (int64, error) {
 	return education.ID, err
 }
 
-// EducationUpdate - save changes to education
+// EducationUpdate - save changes to education, course is completed only by EducationComplete
 func EducationUpdate(education Education) error {
-	_, err := pool.Exec(context.Background(), `
+	return EducationUpdateCtx(context.Background(), education)
+}
+
+// EducationUpdateCtx - EducationUpdate with context, actor of context is written to audit log
+func EducationUpdateCtx(ctx context.Context, education Education) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("EducationUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
 		UPDATE educations SET
 			contact_id = $2,
 			start_date = $3,
 			end_date = $4,
 			post_id = $5,
 			note = $6,
-			updated_at = $7
+			updated_at = $7,
+			version = version + 1
 		WHERE
 			id = $1
-	`, education.ID, education.ContactID, education.StartDate, education.EndDate, education.PostID, education.Note, time.Now())
+		AND
+			version = $8
+	`, education.ID, education.ContactID, education.StartDate, education.EndDate, education.PostID,
+		education.Note, time.Now(), education.Version)
 	if err != nil {
 		errmsg("EducationUpdate update", err)
+		return err
 	}
-	return err
+	return versionCheck("educations", education.ID, education.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return EducationGet(education.ID)
+	})
+}
+
+// EducationComplete - close education course and issue certificate in one transaction,
+// ErrEducationCompleted if course is already closed. Contact, post and company of certificate
+// are taken from education and contact if not set, certificate date defaults to end date of education or today.
+func EducationComplete(id int64, certificate Certificate) (int64, error) {
+	return EducationCompleteCtx(context.Background(), id, certificate)
+}
+
+// EducationCompleteCtx - EducationComplete with context, actor of context is written to audit log
+func EducationCompleteCtx(ctx context.Context, id int64, certificate Certificate) (int64, error) {
+	if id == 0 {
+		return 0, nil
+	}
+	var (
+		education Education
+		companyID int64
+	)
+	err := pool.QueryRow(ctx, `
+		SELECT
+			e.contact_id,
+			COALESCE(e.end_date::text, ''),
+			e.post_id,
+			COALESCE(c.company_id, 0)
+		FROM
+			educations AS e
+		LEFT JOIN
+			contacts AS c ON c.id = e.contact_id
+		WHERE
+			e.id = $1
+		AND
+			e.deleted_at IS NULL
+	`, id).Scan(&education.ContactID, &education.EndDate, &education.PostID, &companyID)
+	if err != nil {
+		errmsg("EducationComplete QueryRow", err)
+		return 0, err
+	}
+	certificate.EducationID = id
+	if certificate.ContactID == 0 {
+		certificate.ContactID = education.ContactID
+	}
+	if certificate.PostID == 0 {
+		certificate.PostID = education.PostID
+	}
+	if certificate.CompanyID == 0 {
+		certificate.CompanyID = companyID
+	}
+	if certificate.CertDate == "" {
+		certificate.CertDate = education.EndDate
+	}
+	if certificate.CertDate == "" {
+		certificate.CertDate = time.Now().Format("2006-01-02")
+	}
+	err = certificateExpiry(&certificate)
+	if err != nil {
+		errmsg("EducationComplete certificateExpiry", err)
+		return 0, err
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("EducationComplete Begin", err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `
+		UPDATE educations SET
+			end_date = COALESCE(end_date, $2::date),
+			completed = true,
+			updated_at = $3
+		WHERE
+			id = $1
+		AND
+			NOT completed
+	`, id, certificate.CertDate, time.Now())
+	if err != nil {
+		errmsg("EducationComplete Exec", err)
+		return 0, err
+	}
+	if tag.RowsAffected() != 1 {
+		return 0, ErrEducationCompleted
+	}
+	err = certificateInsert(tx, &certificate)
+	if err != nil {
+		errmsg("EducationComplete certificateInsert", err)
+		return 0, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("EducationComplete Commit", err)
+		return 0, err
+	}
+	return certificate.ID, nil
 }
 
-// EducationDelete - delete education by id
+// EducationHistoryGet - get full training history of contact: education courses with
+// issued certificates and certificates issued without course
+func EducationHistoryGet(id int64) ([]EducationHistory, error) {
+	var history []EducationHistory
+	if id == 0 {
+		return history, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			COALESCE(start_date::text, ''),
+			COALESCE(end_date::text, ''),
+			post_id,
+			post_name,
+			completed,
+			certificate_id,
+			num,
+			COALESCE(cert_date::text, ''),
+			COALESCE(expiry_date::text, '')
+		FROM (
+			SELECT
+				e.id,
+				e.start_date,
+				e.end_date,
+				COALESCE(e.post_id, 0) AS post_id,
+				COALESCE(p.name, '') AS post_name,
+				COALESCE(e.completed, false) AS completed,
+				COALESCE(c.id, 0) AS certificate_id,
+				COALESCE(c.num, '') AS num,
+				c.cert_date,
+				c.expiry_date
+			FROM
+				educations AS e
+			LEFT JOIN
+				posts AS p ON p.id = e.post_id
+			LEFT JOIN
+				certificates AS c ON c.education_id = e.id AND c.deleted_at IS NULL
+			WHERE
+				e.contact_id = $1
+			AND
+				e.deleted_at IS NULL
+			UNION ALL
+			SELECT
+				0::bigint AS id,
+				NULL::date AS start_date,
+				NULL::date AS end_date,
+				COALESCE(c.post_id, 0) AS post_id,
+				COALESCE(p.name, '') AS post_name,
+				true AS completed,
+				c.id AS certificate_id,
+				COALESCE(c.num, '') AS num,
+				c.cert_date,
+				c.expiry_date
+			FROM
+				certificates AS c
+			LEFT JOIN
+				posts AS p ON p.id = c.post_id
+			WHERE
+				c.contact_id = $1
+			AND
+				COALESCE(c.education_id, 0) = 0
+			AND
+				c.deleted_at IS NULL
+		) AS history
+		ORDER BY
+			COALESCE(start_date, cert_date) DESC NULLS LAST,
+			id DESC,
+			certificate_id DESC
+	`, id)
+	if err != nil {
+		errmsg("EducationHistoryGet Query", err)
+		return history, err
+	}
+	for rows.Next() {
+		var item EducationHistory
+		err := rows.Scan(&item.ID, &item.StartDate, &item.EndDate, &item.PostID, &item.PostName, &item.Completed,
+			&item.CertificateID, &item.Num, &item.CertDate, &item.ExpiryDate)
+		if err != nil {
+			errmsg("EducationHistoryGet Scan", err)
+			return history, err
+		}
+		history = append(history, item)
+	}
+	return history, rows.Err()
+}
+
+// EducationDelete - move education to trash
 func EducationDelete(id int64) error {
+	return EducationDeleteCtx(context.Background(), id)
+}
+
+// EducationDeleteCtx - EducationDelete with context, actor of context is written to audit log
+func EducationDeleteCtx(ctx context.Context, id int64) error {
+	return trashDelete(ctx, "educations", id)
+}
+
+// educationPurge - delete education by id with child rows
+func educationPurge(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("educationPurge auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			educations
 		WHERE
@@ -217,10 +471,14 @@ func educationCreateTable() error {
 		CREATE TABLE IF NOT EXISTS
 			educations (
 				id bigserial primary key,
+				contact_id bigint,
 				start_date date,
 				end_date date,
 				note text,
 				post_id bigint,
+				completed bool NOT NULL DEFAULT false,
+				deleted_at TIMESTAMP without time zone,
+				version bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now()
 			)
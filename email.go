@@ -17,8 +17,19 @@ type Email struct {
 
 // EmailInsert - create new email
 func EmailInsert(email Email) (int64, error) {
+	return EmailInsertCtx(context.Background(), email)
+}
+
+// EmailInsertCtx - EmailInsert with context, actor of context is written to audit log
+func EmailInsertCtx(ctx context.Context, email Email) (_ int64, err error) {
 	email.ID = 0
-	err := pool.QueryRow(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("EmailInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO emails
 		(
 			company_id,
@@ -44,7 +55,12 @@ func EmailInsert(email Email) (int64, error) {
 
 // EmailCompanyUpdate - update company emails
 func EmailCompanyUpdate(id int64, emails []string) error {
-	err := EmailCompanyDelete(id)
+	return EmailCompanyUpdateCtx(context.Background(), id, emails)
+}
+
+// EmailCompanyUpdateCtx - EmailCompanyUpdate with context, actor of context is written to audit log
+func EmailCompanyUpdateCtx(ctx context.Context, id int64, emails []string) error {
+	err := EmailCompanyDeleteCtx(ctx, id)
 	if err != nil {
 		errmsg("EmailCompanyUpdate DeleteCompanyEmails", err)
 		return err
@@ -53,7 +69,7 @@ func EmailCompanyUpdate(id int64, emails []string) error {
 		var email Email
 		email.CompanyID = id
 		email.Email = emails[i]
-		_, err = EmailInsert(email)
+		_, err = EmailInsertCtx(ctx, email)
 		if err != nil {
 			errmsg("EmailCompanyUpdate EmailInsert", err)
 			return err
@@ -64,7 +80,12 @@ func EmailCompanyUpdate(id int64, emails []string) error {
 
 // EmailContactUpdate - update contact emails
 func EmailContactUpdate(id int64, emails []string) error {
-	err := EmailContactDelete(id)
+	return EmailContactUpdateCtx(context.Background(), id, emails)
+}
+
+// EmailContactUpdateCtx - EmailContactUpdate with context, actor of context is written to audit log
+func EmailContactUpdateCtx(ctx context.Context, id int64, emails []string) error {
+	err := EmailContactDeleteCtx(ctx, id)
 	if err != nil {
 		errmsg("EmailContactUpdate EmailsContactDelete", err)
 		return err
@@ -73,7 +94,7 @@ func EmailContactUpdate(id int64, emails []string) error {
 		var email Email
 		email.ContactID = id
 		email.Email = emails[i]
-		_, err = EmailInsert(email)
+		_, err = EmailInsertCtx(ctx, email)
 		if err != nil {
 			errmsg("EmailContactUpdate EmailInsert", err)
 			return err
@@ -84,10 +105,21 @@ func EmailContactUpdate(id int64, emails []string) error {
 
 // EmailCompanyDelete - delete all emails by company id
 func EmailCompanyDelete(id int64) error {
+	return EmailCompanyDeleteCtx(context.Background(), id)
+}
+
+// EmailCompanyDeleteCtx - EmailCompanyDelete with context, actor of context is written to audit log
+func EmailCompanyDeleteCtx(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("EmailCompanyDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			emails
 		WHERE
@@ -101,10 +133,21 @@ func EmailCompanyDelete(id int64) error {
 
 // EmailContactDelete - delete all emails by contact id
 func EmailContactDelete(id int64) error {
+	return EmailContactDeleteCtx(context.Background(), id)
+}
+
+// EmailContactDeleteCtx - EmailContactDelete with context, actor of context is written to audit log
+func EmailContactDeleteCtx(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("EmailContactDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			emails
 		WHERE
@@ -0,0 +1,187 @@
+package edc
+
+import "context"
+
+// Event types
+const (
+	EventPractice    = "practice"
+	EventEducation   = "education"
+	EventCertificate = "certificate"
+)
+
+// Event - practice, education or certificate event for dashboard feed
+// Topic - practice topic, education post name or certificate number
+// Date  - date of practice, start date of education or expiry date of certificate
+type Event struct {
+	Type          string `json:"type"            form:"type"            query:"type"`
+	ID            int64  `json:"id"              form:"id"              query:"id"`
+	Date          string `json:"date"            form:"date"            query:"date"`
+	EndDate       string `json:"end_date"        form:"end_date"        query:"end_date"`
+	DateStr       string `json:"date_str"        form:"date_str"        query:"date_str"`
+	CompanyID     int64  `json:"company_id"      form:"company_id"      query:"company_id"`
+	CompanyName   string `json:"company_name"    form:"company_name"    query:"company_name"`
+	ContactID     int64  `json:"contact_id"      form:"contact_id"      query:"contact_id"`
+	ContactName   string `json:"contact_name"    form:"contact_name"    query:"contact_name"`
+	KindID        int64  `json:"kind_id"         form:"kind_id"         query:"kind_id"`
+	KindName      string `json:"kind_name"       form:"kind_name"       query:"kind_name"`
+	KindShortName string `json:"kind_short_name" form:"kind_short_name" query:"kind_short_name"`
+	Topic         string `json:"topic"           form:"topic"           query:"topic"`
+}
+
+// EventFilter - filter of events
+// Start, End - date range (format 2006-01-02), empty for open range
+// Limit      - maximum number of events, 0 for all events
+// CompanyID, ScopeID, KindID, ContactID - filters, 0 for any value.
+// Filter by kind returns only practices, filter by contact returns
+// practices attended by contact, its educations and certificates.
+type EventFilter struct {
+	Start     string `json:"start"      form:"start"      query:"start"`
+	End       string `json:"end"        form:"end"        query:"end"`
+	Limit     int64  `json:"limit"      form:"limit"      query:"limit"`
+	CompanyID int64  `json:"company_id" form:"company_id" query:"company_id"`
+	ScopeID   int64  `json:"scope_id"   form:"scope_id"   query:"scope_id"`
+	KindID    int64  `json:"kind_id"    form:"kind_id"    query:"kind_id"`
+	ContactID int64  `json:"contact_id" form:"contact_id" query:"contact_id"`
+}
+
+// EventListGet - get practices, educations and certificates merged in chronological order
+func EventListGet(filter EventFilter) ([]Event, error) {
+	var events []Event
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			type,
+			id,
+			date::text,
+			COALESCE(end_date::text, '') AS end_date,
+			company_id,
+			company_name,
+			contact_id,
+			contact_name,
+			kind_id,
+			kind_name,
+			kind_short_name,
+			topic
+		FROM (
+			SELECT
+				$8::text AS type,
+				p.id,
+				p.date_of_practice AS date,
+				p.date_of_practice AS end_date,
+				COALESCE(p.company_id, 0) AS company_id,
+				COALESCE(c.name, '') AS company_name,
+				0::bigint AS contact_id,
+				'' AS contact_name,
+				COALESCE(p.kind_id, 0) AS kind_id,
+				COALESCE(k.name, '') AS kind_name,
+				COALESCE(k.short_name, '') AS kind_short_name,
+				COALESCE(p.topic, '') AS topic
+			FROM
+				practices AS p
+			LEFT JOIN
+				companies AS c ON c.id = p.company_id
+			LEFT JOIN
+				kinds AS k ON k.id = p.kind_id
+			WHERE
+				p.deleted_at IS NULL
+			AND
+				($3::bigint = 0 OR p.company_id = $3)
+			AND
+				($4::bigint = 0 OR c.scope_id = $4)
+			AND
+				($5::bigint = 0 OR p.kind_id = $5)
+			AND
+				($6::bigint = 0 OR p.id IN (SELECT practice_id FROM practice_participants WHERE contact_id = $6))
+			UNION ALL
+			SELECT
+				$9::text AS type,
+				e.id,
+				e.start_date AS date,
+				e.end_date,
+				COALESCE(ct.company_id, 0) AS company_id,
+				COALESCE(c.name, '') AS company_name,
+				COALESCE(e.contact_id, 0) AS contact_id,
+				COALESCE(ct.name, '') AS contact_name,
+				0::bigint AS kind_id,
+				'' AS kind_name,
+				'' AS kind_short_name,
+				COALESCE(po.name, '') AS topic
+			FROM
+				educations AS e
+			LEFT JOIN
+				contacts AS ct ON ct.id = e.contact_id
+			LEFT JOIN
+				companies AS c ON c.id = ct.company_id
+			LEFT JOIN
+				posts AS po ON po.id = e.post_id
+			WHERE
+				e.deleted_at IS NULL
+			AND
+				($3::bigint = 0 OR ct.company_id = $3)
+			AND
+				($4::bigint = 0 OR c.scope_id = $4)
+			AND
+				$5::bigint = 0
+			AND
+				($6::bigint = 0 OR e.contact_id = $6)
+			UNION ALL
+			SELECT
+				$10::text AS type,
+				ce.id,
+				ce.expiry_date AS date,
+				ce.expiry_date AS end_date,
+				COALESCE(ce.company_id, 0) AS company_id,
+				COALESCE(c.name, '') AS company_name,
+				COALESCE(ce.contact_id, 0) AS contact_id,
+				COALESCE(ct.name, '') AS contact_name,
+				0::bigint AS kind_id,
+				'' AS kind_name,
+				'' AS kind_short_name,
+				COALESCE(ce.num, '') AS topic
+			FROM
+				certificates AS ce
+			LEFT JOIN
+				contacts AS ct ON ct.id = ce.contact_id
+			LEFT JOIN
+				companies AS c ON c.id = ce.company_id
+			WHERE
+				ce.deleted_at IS NULL
+			AND
+				($3::bigint = 0 OR ce.company_id = $3)
+			AND
+				($4::bigint = 0 OR c.scope_id = $4)
+			AND
+				$5::bigint = 0
+			AND
+				($6::bigint = 0 OR ce.contact_id = $6)
+		) AS events
+		WHERE
+			date IS NOT NULL
+		AND
+			($1::text = '' OR date >= $1::date)
+		AND
+			($2::text = '' OR date <= $2::date)
+		ORDER BY
+			date ASC,
+			type ASC,
+			id ASC
+		LIMIT
+			NULLIF($7::bigint, 0)
+	`, filter.Start, filter.End, filter.CompanyID, filter.ScopeID, filter.KindID, filter.ContactID, filter.Limit,
+		EventPractice, EventEducation, EventCertificate)
+	if err != nil {
+		errmsg("EventListGet Query", err)
+		return events, err
+	}
+	for rows.Next() {
+		var event Event
+		err := rows.Scan(&event.Type, &event.ID, &event.Date, &event.EndDate, &event.CompanyID, &event.CompanyName, &event.ContactID,
+			&event.ContactName, &event.KindID, &event.KindName, &event.KindShortName, &event.Topic)
+		if err != nil {
+			errmsg("EventListGet Scan", err)
+			return events, err
+		}
+		event.DateStr = setStrMonth(event.Date)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
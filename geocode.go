@@ -0,0 +1,400 @@
+package edc
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// AddressRegister - house of local address register (ФИАС/ГАР extract or OSM address dump) with coordinates
+// Source - name of imported dataset
+// Keys of locality, street and house are filled on insert and used for lookup
+type AddressRegister struct {
+	ID          int64   `sql:"id"           json:"id"           form:"id"           query:"id"`
+	Source      string  `sql:"source"       json:"source"       form:"source"       query:"source"`
+	Region      string  `sql:"region"       json:"region"       form:"region"       query:"region"`
+	District    string  `sql:"district"     json:"district"     form:"district"     query:"district"`
+	Locality    string  `sql:"locality"     json:"locality"     form:"locality"     query:"locality"`
+	Street      string  `sql:"street"       json:"street"       form:"street"       query:"street"`
+	House       string  `sql:"house"        json:"house"        form:"house"        query:"house"`
+	Building    string  `sql:"building"     json:"building"     form:"building"     query:"building"`
+	Latitude    float64 `sql:"latitude"     json:"latitude"     form:"latitude"     query:"latitude"`
+	Longitude   float64 `sql:"longitude"    json:"longitude"    form:"longitude"    query:"longitude"`
+	LocalityKey string  `sql:"locality_key" json:"-"`
+	StreetKey   string  `sql:"street_key"   json:"-"`
+	HouseKey    string  `sql:"house_key"    json:"-"`
+	CreatedAt   string  `sql:"created_at"   json:"-"`
+	UpdatedAt   string  `sql:"updated_at"   json:"-"`
+}
+
+// GeocodeObject - company, siren or hideout with address which can't be geocoded unambiguously
+// Matches - candidates from address register, empty if address is not found
+type GeocodeObject struct {
+	Type    string            `json:"type"    form:"type"    query:"type"`
+	ID      int64             `json:"id"      form:"id"      query:"id"`
+	Address string            `json:"address" form:"address" query:"address"`
+	Matches []AddressRegister `json:"matches" form:"matches" query:"matches"`
+}
+
+// GeocodeReport - result of bulk geocoding
+type GeocodeReport struct {
+	Filled    int64           `json:"filled"    form:"filled"    query:"filled"`
+	NotFound  []GeocodeObject `json:"not_found" form:"not_found" query:"not_found"`
+	Ambiguous []GeocodeObject `json:"ambiguous" form:"ambiguous" query:"ambiguous"`
+}
+
+// geocodeTables - tables with latitude and longitude filled by geocoding
+var geocodeTables = []struct {
+	table string
+	kind  string
+}{
+	{"companies", "company"},
+	{"sirens", "siren"},
+	{"hideouts", "hideout"},
+}
+
+// geocodeDistance - matches closer than distance in meters are treated as the same place
+const geocodeDistance = 50.0
+
+// AddressRegisterInsert - add houses to address register in one transaction
+func AddressRegisterInsert(houses []AddressRegister) (int64, error) {
+	return AddressRegisterInsertCtx(context.Background(), houses)
+}
+
+// AddressRegisterInsertCtx - AddressRegisterInsert with context, actor of context is written to audit log
+func AddressRegisterInsertCtx(ctx context.Context, houses []AddressRegister) (int64, error) {
+	var count int64
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("AddressRegisterInsert Begin", err)
+		return count, err
+	}
+	defer tx.Rollback(ctx)
+	for _, house := range houses {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO address_registers
+			(
+				source,
+				region,
+				district,
+				locality,
+				street,
+				house,
+				building,
+				latitude,
+				longitude,
+				locality_key,
+				street_key,
+				house_key,
+				created_at,
+				updated_at
+			)
+			VALUES
+			(
+				$1,
+				$2,
+				$3,
+				$4,
+				$5,
+				$6,
+				$7,
+				$8,
+				$9,
+				$10,
+				$11,
+				$12,
+				$13,
+				$14
+			)
+		`, house.Source, house.Region, house.District, house.Locality, house.Street, house.House, house.Building,
+			house.Latitude, house.Longitude, geocodeKey(house.Locality), geocodeKey(house.Street),
+			geocodeHouseKey(house.House, house.Building), time.Now(), time.Now())
+		if err != nil {
+			errmsg("AddressRegisterInsert Exec", err)
+			return 0, err
+		}
+		count++
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		errmsg("AddressRegisterInsert Commit", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// AddressRegisterDelete - delete all houses of imported dataset before new import
+func AddressRegisterDelete(source string) error {
+	return AddressRegisterDeleteCtx(context.Background(), source)
+}
+
+// AddressRegisterDeleteCtx - AddressRegisterDelete with context, actor of context is written to audit log
+func AddressRegisterDeleteCtx(ctx context.Context, source string) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("AddressRegisterDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			address_registers
+		WHERE
+			source = $1
+	`, source)
+	if err != nil {
+		errmsg("AddressRegisterDelete Exec", err)
+	}
+	return err
+}
+
+// GeocodeGet - find address in address register, region and district narrow search only if both sides have them
+func GeocodeGet(address Address) ([]AddressRegister, error) {
+	var houses []AddressRegister
+	if address.Locality == "" || address.House == "" {
+		return houses, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			source,
+			region,
+			district,
+			locality,
+			street,
+			house,
+			building,
+			latitude,
+			longitude
+		FROM
+			address_registers
+		WHERE
+			locality_key = $1
+		AND
+			street_key = $2
+		AND
+			house_key = $3
+		ORDER BY
+			id ASC
+	`, geocodeKey(address.Locality), geocodeKey(address.Street), geocodeHouseKey(address.House, address.Building))
+	if err != nil {
+		errmsg("GeocodeGet Query", err)
+		return houses, err
+	}
+	for rows.Next() {
+		var house AddressRegister
+		err := rows.Scan(&house.ID, &house.Source, &house.Region, &house.District, &house.Locality, &house.Street,
+			&house.House, &house.Building, &house.Latitude, &house.Longitude)
+		if err != nil {
+			errmsg("GeocodeGet Scan", err)
+			return houses, err
+		}
+		if geocodeAreaMatch(address.Region, house.Region) && geocodeAreaMatch(address.District, house.District) {
+			houses = append(houses, house)
+		}
+	}
+	return houses, rows.Err()
+}
+
+// GeocodeFill - fill empty latitude and longitude of companies, sirens and hideouts with structured address
+// from address register. Objects with several distant matches are not changed and listed as ambiguous.
+func GeocodeFill() (GeocodeReport, error) {
+	return GeocodeFillCtx(context.Background())
+}
+
+// GeocodeFillCtx - GeocodeFill with context, actor of context is written to audit log
+func GeocodeFillCtx(ctx context.Context) (_ GeocodeReport, err error) {
+	var report GeocodeReport
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("GeocodeFill auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	for _, t := range geocodeTables {
+		rows, err := tx.Query(ctx, `
+			SELECT
+				o.id,
+				a.id,
+				a.region,
+				a.district,
+				a.locality,
+				a.street,
+				a.house,
+				a.building,
+				a.display
+			FROM
+				`+pgx.Identifier{t.table}.Sanitize()+` AS o
+			INNER JOIN
+				addresses AS a ON a.id = o.address_id
+			WHERE
+				o.deleted_at IS NULL
+			AND
+				(COALESCE(o.latitude, '') = '' OR COALESCE(o.longitude, '') = '')
+			ORDER BY
+				o.id ASC
+		`)
+		if err != nil {
+			errmsg("GeocodeFill Query "+t.table, err)
+			return report, err
+		}
+		var (
+			ids       []int64
+			addresses []Address
+		)
+		for rows.Next() {
+			var (
+				id      int64
+				address Address
+			)
+			err := rows.Scan(&id, &address.ID, &address.Region, &address.District, &address.Locality, &address.Street,
+				&address.House, &address.Building, &address.Display)
+			if err != nil {
+				rows.Close()
+				errmsg("GeocodeFill Scan "+t.table, err)
+				return report, err
+			}
+			ids = append(ids, id)
+			addresses = append(addresses, address)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			errmsg("GeocodeFill rows "+t.table, rows.Err())
+			return report, rows.Err()
+		}
+		for i := range ids {
+			houses, err := GeocodeGet(addresses[i])
+			if err != nil {
+				return report, err
+			}
+			object := GeocodeObject{Type: t.kind, ID: ids[i], Address: addresses[i].Display, Matches: houses}
+			switch {
+			case len(houses) == 0:
+				report.NotFound = append(report.NotFound, object)
+				continue
+			case !geocodeSamePlace(houses):
+				report.Ambiguous = append(report.Ambiguous, object)
+				continue
+			}
+			_, err = tx.Exec(ctx, `
+				UPDATE `+pgx.Identifier{t.table}.Sanitize()+` SET
+					latitude = $2,
+					longitude = $3,
+					updated_at = $4
+				WHERE
+					id = $1
+			`, ids[i], strconv.FormatFloat(houses[0].Latitude, 'f', 6, 64),
+				strconv.FormatFloat(houses[0].Longitude, 'f', 6, 64), time.Now())
+			if err != nil {
+				errmsg("GeocodeFill Exec "+t.table, err)
+				return report, err
+			}
+			report.Filled++
+		}
+	}
+	return report, nil
+}
+
+// geocodeSamePlace - all matches are within geocodeDistance from first match
+func geocodeSamePlace(houses []AddressRegister) bool {
+	for _, house := range houses[1:] {
+		if geocodeMeters(houses[0].Latitude, houses[0].Longitude, house.Latitude, house.Longitude) > geocodeDistance {
+			return false
+		}
+	}
+	return true
+}
+
+// geocodeMeters - great-circle distance between points in meters
+func geocodeMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000.0
+	p1, p2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dp, dl := p2-p1, (lon2-lon1)*math.Pi/180
+	h := math.Sin(dp/2)*math.Sin(dp/2) + math.Cos(p1)*math.Cos(p2)*math.Sin(dl/2)*math.Sin(dl/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// geocodeAreaMatch - region or district names are equal or one of them is unknown
+func geocodeAreaMatch(a, b string) bool {
+	a, b = geocodeKey(a), geocodeKey(b)
+	return a == "" || b == "" || a == b
+}
+
+// geocodeKey - lower case words of name without type abbreviations and punctuation,
+// «г. Тверь» and «Тверь город» give the same key
+func geocodeKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(strings.ReplaceAll(name, "ё", "е")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+	var key []string
+	for _, word := range words {
+		if !geocodeTypeWord(word) {
+			key = append(key, word)
+		}
+	}
+	return strings.Join(key, " ")
+}
+
+func geocodeTypeWord(word string) bool {
+	for _, t := range addressTypes {
+		for _, w := range t.words {
+			if strings.TrimSuffix(w, ".") == word {
+				return true
+			}
+		}
+	}
+	return word == "д" || word == "п"
+}
+
+// geocodeHouseKey - house number with building without spaces and punctuation, «12а корп. 1» gives «12а/1»
+func geocodeHouseKey(house, building string) string {
+	key := strings.ToLower(strings.Join(strings.Fields(house), ""))
+	building = strings.ToLower(strings.Join(strings.Fields(building), ""))
+	if building != "" {
+		key += "/" + building
+	}
+	return key
+}
+
+func addressRegisterCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			address_registers (
+				id           bigserial PRIMARY KEY,
+				source       text NOT NULL DEFAULT '',
+				region       text NOT NULL DEFAULT '',
+				district     text NOT NULL DEFAULT '',
+				locality     text NOT NULL DEFAULT '',
+				street       text NOT NULL DEFAULT '',
+				house        text NOT NULL DEFAULT '',
+				building     text NOT NULL DEFAULT '',
+				latitude     double precision,
+				longitude    double precision,
+				locality_key text NOT NULL DEFAULT '',
+				street_key   text NOT NULL DEFAULT '',
+				house_key    text NOT NULL DEFAULT '',
+				created_at   TIMESTAMP without time zone,
+				updated_at   TIMESTAMP without time zone default now()
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("addressRegisterCreateTable exec", err)
+		return err
+	}
+	_, err = pool.Exec(context.Background(), `
+		CREATE INDEX IF NOT EXISTS
+			address_registers_key_idx
+		ON
+			address_registers (locality_key, street_key, house_key)
+	`)
+	if err != nil {
+		errmsg("addressRegisterCreateTable index", err)
+	}
+	return err
+}
@@ -9,6 +9,9 @@ import "context"
 // InvAdd        - дополнительный код инвентарного номера убежища
 // HideoutTypeID - номер типа защитного сооружения в базе данных
 // Address       - Полный адрес места расположения убежища, с указанием строения, подъезда
+// AddressID     - номер структурированного адреса в базе данных
+// Latitude      - широта
+// Longitude     - долгота
 // OwnerID       - номер собственника в базе данных
 // DesignerID    - номер проектной организации в базе данных
 // BuilderID     - номер строительной организации в базе данных
@@ -42,6 +45,9 @@ type Hideout struct {
 	InvAdd        int64  `sql:"inv_add"         json:"inv_add"         form:"inv_add"         query:"inv_add"`
 	HideoutTypeID int64  `sql:"hideout_type_id" json:"hideout_type_id" form:"hideout_type_id" query:"hideout_type_id"`
 	Address       string `sql:"address"         json:"address"         form:"address"         query:"address"`
+	AddressID     int64  `sql:"address_id"      json:"address_id"      form:"address_id"      query:"address_id"`
+	Latitude      string `sql:"latitude"        json:"latitude"        form:"latitude"        query:"latitude"`
+	Longitude     string `sql:"longitude"       json:"longitude"       form:"longitude"       query:"longitude"`
 	OwnerID       int64  `sql:"owner_id"        json:"owner_id"        form:"owner_id"        query:"owner_id"`
 	DesignerID    int64  `sql:"designer_id"     json:"designer_id"     form:"designer_id"     query:"designer_id"`
 	BuilderID     int64  `sql:"builder_id"      json:"builder_id"      form:"builder_id"      query:"builder_id"`
@@ -66,6 +72,7 @@ type Hideout struct {
 	ContactID     int64  `sql:"contact_id"      json:"contact_id"      form:"contact_id"      query:"contact_id"`
 	Condition     string `sql:"condition"       json:"condition"       form:"condition"       query:"condition"`
 	Note          string `sql:"note"            json:"note"            form:"note"            query:"note"`
+	Version       int64  `sql:"version"         json:"version"         form:"version"         query:"version"`
 	CreatedAt     string `sql:"created_at"      json:"-"`
 	UpdatedAt     string `sql:"updated_at"      json:"-"`
 }
@@ -112,6 +119,8 @@ func HideoutListGet() ([]HideoutList, error) {
 			contacts AS c ON s.contact_id = c.id
 		LEFT JOIN
 			phones AS ph ON s.contact_id = ph.contact_id AND ph.fax = false
+		WHERE
+			s.deleted_at IS NULL
 		GROUP BY
 			s.id,
 			t.id,
@@ -152,12 +161,28 @@ func HideoutListGet() ([]HideoutList, error) {
 // 	return err
 // }
 
-// HideoutDelete - delete hideout by id
+// HideoutDelete - move hideout to trash
 func HideoutDelete(id int64) error {
+	return HideoutDeleteCtx(context.Background(), id)
+}
+
+// HideoutDeleteCtx - HideoutDelete with context, actor of context is written to audit log
+func HideoutDeleteCtx(ctx context.Context, id int64) error {
+	return trashDelete(ctx, "hideouts", id)
+}
+
+// hideoutPurge - delete hideout by id with child rows
+func hideoutPurge(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("hideoutPurge auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			hideouts
 		WHERE
@@ -179,6 +204,9 @@ func hideoutCreateTable() error {
 				inv_add         bigint,
 				hideout_type_id bigint,
 				address         text,
+				address_id      bigint NOT NULL DEFAULT 0,
+				latitude        text,
+				longitude       text,
 				owner_id        bigint,
 				designer_id     bigint,
 				builder_id      bigint,
@@ -203,6 +231,8 @@ func hideoutCreateTable() error {
 				contact_id      bigint,
 				condition       text,
 				note            text,
+				deleted_at      TIMESTAMP without time zone,
+				version         bigint NOT NULL DEFAULT 0,
 				created_at      TIMESTAMP without time zone,
 				updated_at      TIMESTAMP without time zone default now(),
 				UNIQUE(num, inv_num, inv_add)
@@ -93,10 +93,21 @@ func HideoutTypeSelectGet() ([]SelectItem, error) {
 
 // HideoutTypeDelete - delete hideoutType by id
 func HideoutTypeDelete(id int64) error {
+	return HideoutTypeDeleteCtx(context.Background(), id)
+}
+
+// HideoutTypeDeleteCtx - HideoutTypeDelete with context, actor of context is written to audit log
+func HideoutTypeDeleteCtx(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("HideoutTypeDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			hideout_types
 		WHERE
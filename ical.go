@@ -0,0 +1,122 @@
+package edc
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ICalendarGet - get iCalendar (.ics) feed of practices and educations by filter
+func ICalendarGet(filter EventFilter) (string, error) {
+	events, err := EventListGet(filter)
+	if err != nil {
+		errmsg("ICalendarGet EventListGet", err)
+		return "", err
+	}
+	return icalendar(events, time.Now()), nil
+}
+
+// ICalendarCompanyGet - get iCalendar feed of practices of company and educations of its contacts
+func ICalendarCompanyGet(id int64) (string, error) {
+	if id == 0 {
+		return icalendar(nil, time.Now()), nil
+	}
+	return ICalendarGet(EventFilter{CompanyID: id})
+}
+
+// ICalendarContactGet - get iCalendar feed of practices attended by contact and its educations
+func ICalendarContactGet(id int64) (string, error) {
+	if id == 0 {
+		return icalendar(nil, time.Now()), nil
+	}
+	return ICalendarGet(EventFilter{ContactID: id})
+}
+
+func icalendar(events []Event, stamp time.Time) string {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(icalendarFold(s))
+		b.WriteString("\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//serbe//edc//RU")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	for _, event := range events {
+		if event.Type != EventPractice && event.Type != EventEducation {
+			continue
+		}
+		start, err := time.Parse("2006-01-02", event.Date)
+		if err != nil {
+			continue
+		}
+		end, err := time.Parse("2006-01-02", event.EndDate)
+		if err != nil || end.Before(start) {
+			end = start
+		}
+		var summary string
+		var description []string
+		switch event.Type {
+		case EventPractice:
+			summary = strings.TrimSpace(event.KindShortName + " " + event.CompanyName)
+			if event.Topic != "" {
+				description = append(description, "Тема: "+event.Topic)
+			}
+			if event.KindName != "" {
+				description = append(description, "Вид: "+event.KindName)
+			}
+		case EventEducation:
+			summary = strings.TrimSpace("Обучение " + event.ContactName)
+			if event.Topic != "" {
+				description = append(description, "Должность: "+event.Topic)
+			}
+			if event.ContactName != "" {
+				description = append(description, "Слушатель: "+event.ContactName)
+			}
+		}
+		if event.CompanyName != "" {
+			description = append(description, "Организация: "+event.CompanyName)
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + event.Type + "-" + strconv.FormatInt(event.ID, 10) + "@edc")
+		line("DTSTAMP:" + stamp.UTC().Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE:" + start.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + end.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + icalendarEscape(summary))
+		line("DESCRIPTION:" + icalendarEscape(strings.Join(description, "\n")))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+func icalendarEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// icalendarFold - fold content line longer than 75 octets without splitting utf-8 characters
+func icalendarFold(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := utf8.RuneLen(r)
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
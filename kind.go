@@ -11,6 +11,7 @@ type Kind struct {
 	Name      string `sql:"name"       json:"name"       form:"name"       query:"name"`
 	ShortName string `sql:"short_name" json:"short_name" form:"short_name" query:"short_name"`
 	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
+	Version   int64  `sql:"version"    json:"version"    form:"version"    query:"version"`
 	CreatedAt string `sql:"created_at" json:"-"`
 	UpdatedAt string `sql:"updated_at" json:"-"`
 }
@@ -35,13 +36,14 @@ func KindGet(id int64) (Kind, error) {
 			name,
 			short_name,
 			note,
+			version,
 			created_at,
 			updated_at
 		FROM
 			kinds
 		WHERE
 			id = $1
-	`, id).Scan(&kind.Name, &kind.ShortName, &kind.Note, &kind.CreatedAt, &kind.UpdatedAt)
+	`, id).Scan(&kind.Name, &kind.ShortName, &kind.Note, &kind.Version, &kind.CreatedAt, &kind.UpdatedAt)
 	if err != nil {
 		errmsg("KindGet QueryRow", err)
 	}
@@ -106,7 +108,18 @@ func KindSelectGet() ([]SelectItem, error) {
 
 // KindInsert - create new kind
 func KindInsert(kind Kind) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return KindInsertCtx(context.Background(), kind)
+}
+
+// KindInsertCtx - KindInsert with context, actor of context is written to audit log
+func KindInsertCtx(ctx context.Context, kind Kind) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("KindInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO educations
 		(
 			name,
@@ -134,27 +147,55 @@ func KindInsert(kind Kind) (int64, error) {
 
 // KindUpdate - save kind changes
 func KindUpdate(kind Kind) error {
-	_, err := pool.Exec(context.Background(), `
-		UPDATE educations SET
+	return KindUpdateCtx(context.Background(), kind)
+}
+
+// KindUpdateCtx - KindUpdate with context, actor of context is written to audit log
+func KindUpdateCtx(ctx context.Context, kind Kind) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("KindUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		UPDATE kinds SET
 			name = $2,
 			short_name = $3,
 			note = $4,
-			updated_at = $5
+			updated_at = $5,
+			version = version + 1
 		WHERE
 			id = $1
-	`, kind.ID, kind.Name, kind.ShortName, kind.Note, time.Now())
+		AND
+			version = $6
+	`, kind.ID, kind.Name, kind.ShortName, kind.Note, time.Now(), kind.Version)
 	if err != nil {
 		errmsg("KindUpdate Exec", err)
+		return err
 	}
-	return err
+	return versionCheck("kinds", kind.ID, kind.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return KindGet(kind.ID)
+	})
 }
 
 // KindDelete - delete kind by id
 func KindDelete(id int64) error {
+	return KindDeleteCtx(context.Background(), id)
+}
+
+// KindDeleteCtx - KindDelete with context, actor of context is written to audit log
+func KindDeleteCtx(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("KindDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			kinds
 		WHERE
@@ -174,6 +215,7 @@ func kindCreateTable() error {
 				name text,
 				short_name text,
 				note text,
+				version bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
 				UNIQUE(name)
@@ -18,8 +18,19 @@ type Phone struct {
 
 // PhoneInsert - create new phone
 func PhoneInsert(phone Phone) (int64, error) {
+	return PhoneInsertCtx(context.Background(), phone)
+}
+
+// PhoneInsertCtx - PhoneInsert with context, actor of context is written to audit log
+func PhoneInsertCtx(ctx context.Context, phone Phone) (_ int64, err error) {
 	phone.ID = 0
-	err := pool.QueryRow(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PhoneInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO phones
 		(
 			company_id,
@@ -47,7 +58,12 @@ func PhoneInsert(phone Phone) (int64, error) {
 
 // PhoneCompanyUpdate - update company phones
 func PhoneCompanyUpdate(id int64, phones []int64, fax bool) error {
-	err := PhoneCompanyDelete(id, fax)
+	return PhoneCompanyUpdateCtx(context.Background(), id, phones, fax)
+}
+
+// PhoneCompanyUpdateCtx - PhoneCompanyUpdate with context, actor of context is written to audit log
+func PhoneCompanyUpdateCtx(ctx context.Context, id int64, phones []int64, fax bool) error {
+	err := PhoneCompanyDeleteCtx(ctx, id, fax)
 	if err != nil {
 		errmsg("PhoneCompanyUpdate PhonesCompanyDelete", err)
 		return err
@@ -57,7 +73,7 @@ func PhoneCompanyUpdate(id int64, phones []int64, fax bool) error {
 		phone.CompanyID = id
 		phone.Phone = phones[i]
 		phone.Fax = fax
-		_, err = PhoneInsert(phone)
+		_, err = PhoneInsertCtx(ctx, phone)
 		if err != nil {
 			errmsg("PhoneCompanyUpdate PhoneInsert", err)
 			return err
@@ -68,7 +84,12 @@ func PhoneCompanyUpdate(id int64, phones []int64, fax bool) error {
 
 // PhoneContactUpdate - update contact phones
 func PhoneContactUpdate(id int64, phones []int64, fax bool) error {
-	err := PhoneContactDelete(id, fax)
+	return PhoneContactUpdateCtx(context.Background(), id, phones, fax)
+}
+
+// PhoneContactUpdateCtx - PhoneContactUpdate with context, actor of context is written to audit log
+func PhoneContactUpdateCtx(ctx context.Context, id int64, phones []int64, fax bool) error {
+	err := PhoneContactDeleteCtx(ctx, id, fax)
 	if err != nil {
 		errmsg("PhoneContactUpdate PhonesContactDelete", err)
 		return err
@@ -78,7 +99,7 @@ func PhoneContactUpdate(id int64, phones []int64, fax bool) error {
 		phone.ContactID = id
 		phone.Phone = phones[i]
 		phone.Fax = fax
-		_, err = PhoneInsert(phone)
+		_, err = PhoneInsertCtx(ctx, phone)
 		if err != nil {
 			errmsg("PhoneContactUpdate PhoneInsert", err)
 			return err
@@ -89,10 +110,21 @@ func PhoneContactUpdate(id int64, phones []int64, fax bool) error {
 
 // PhoneCompanyDelete - delete all unnecessary phones by company id
 func PhoneCompanyDelete(id int64, fax bool) error {
+	return PhoneCompanyDeleteCtx(context.Background(), id, fax)
+}
+
+// PhoneCompanyDeleteCtx - PhoneCompanyDelete with context, actor of context is written to audit log
+func PhoneCompanyDeleteCtx(ctx context.Context, id int64, fax bool) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PhoneCompanyDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			phones
 		WHERE
@@ -108,10 +140,21 @@ func PhoneCompanyDelete(id int64, fax bool) error {
 
 // PhoneContactDelete - delete all unnecessary phones by contact id
 func PhoneContactDelete(id int64, fax bool) error {
+	return PhoneContactDeleteCtx(context.Background(), id, fax)
+}
+
+// PhoneContactDeleteCtx - PhoneContactDelete with context, actor of context is written to audit log
+func PhoneContactDeleteCtx(ctx context.Context, id int64, fax bool) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PhoneContactDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			phones
 		WHERE
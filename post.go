@@ -6,21 +6,25 @@ import (
 )
 
 // Post - struct for post
+// Validity - default validity of certificates for post in months, 0 for unlimited
 type Post struct {
-	ID        int64  `sql:"id"         json:"id"   form:"id"   query:"id"`
-	Name      string `sql:"name"       json:"name" form:"name" query:"name"`
-	GO        bool   `sql:"go"         json:"go"   form:"go"   query:"go"`
-	Note      string `sql:"note"       json:"note" form:"note" query:"note"`
+	ID        int64  `sql:"id"         json:"id"       form:"id"       query:"id"`
+	Name      string `sql:"name"       json:"name"     form:"name"     query:"name"`
+	GO        bool   `sql:"go"         json:"go"       form:"go"       query:"go"`
+	Validity  int64  `sql:"validity"   json:"validity" form:"validity" query:"validity"`
+	Note      string `sql:"note"       json:"note"     form:"note"     query:"note"`
+	Version   int64  `sql:"version"    json:"version"  form:"version"  query:"version"`
 	CreatedAt string `sql:"created_at" json:"-"`
 	UpdatedAt string `sql:"updated_at" json:"-"`
 }
 
 // PostList - struct for post list
 type PostList struct {
-	ID   int64  `sql:"id"   json:"id"   form:"id"   query:"id"`
-	Name string `sql:"name" json:"name" form:"name" query:"name"`
-	GO   bool   `sql:"go"   json:"go"   form:"go"   query:"go"`
-	Note string `sql:"note" json:"note" form:"note" query:"note"`
+	ID       int64  `sql:"id"       json:"id"       form:"id"       query:"id"`
+	Name     string `sql:"name"     json:"name"     form:"name"     query:"name"`
+	GO       bool   `sql:"go"       json:"go"       form:"go"       query:"go"`
+	Validity int64  `sql:"validity" json:"validity" form:"validity" query:"validity"`
+	Note     string `sql:"note"     json:"note"     form:"note"     query:"note"`
 }
 
 // PostGet - get one post by id
@@ -34,14 +38,16 @@ func PostGet(id int64) (Post, error) {
 		SELECT
 			name,
 			go,
+			validity,
 			note,
+			version,
 			created_at,
 			updated_at
 		FROM
-			kinds
+			posts
 		WHERE
 			id = $1
-	`, id).Scan(&post.Name, &post.GO, &post.Note, &post.CreatedAt, &post.UpdatedAt)
+	`, id).Scan(&post.Name, &post.GO, &post.Validity, &post.Note, &post.Version, &post.CreatedAt, &post.UpdatedAt)
 	if err != nil {
 		errmsg("PostGet QueryRow", err)
 	}
@@ -56,9 +62,10 @@ func PostListGet() ([]PostList, error) {
 			id,
 			name,
 			go,
+			validity,
 			note
 		FROM
-			kinds
+			posts
 		ORDER BY
 			name ASC
 	`)
@@ -67,7 +74,7 @@ func PostListGet() ([]PostList, error) {
 	}
 	for rows.Next() {
 		var post PostList
-		err := rows.Scan(&post.ID, &post.Name, &post.GO, &post.Note)
+		err := rows.Scan(&post.ID, &post.Name, &post.GO, &post.Validity, &post.Note)
 		if err != nil {
 			errmsg("PostListGet Scan", err)
 			return posts, err
@@ -108,11 +115,23 @@ func PostSelectGet(g bool) ([]SelectItem, error) {
 
 // PostInsert - create new post
 func PostInsert(post Post) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return PostInsertCtx(context.Background(), post)
+}
+
+// PostInsertCtx - PostInsert with context, actor of context is written to audit log
+func PostInsertCtx(ctx context.Context, post Post) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PostInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO posts
 		(
 			name,
 			go,
+			validity,
 			note,
 			created_at,
 			updated_at
@@ -123,11 +142,12 @@ func PostInsert(post Post) (int64, error) {
 			$2,
 			$3,
 			$4,
-			$5
+			$5,
+			$6
 		)
 		RETURNING
 			id
-	`, post.Name, post.GO, post.Note, time.Now(), time.Now()).Scan(&post.ID)
+	`, post.Name, post.GO, post.Validity, post.Note, time.Now(), time.Now()).Scan(&post.ID)
 	if err != nil {
 		errmsg("PostInsert QueryRow", err)
 	}
@@ -136,27 +156,56 @@ func PostInsert(post Post) (int64, error) {
 
 // PostUpdate - save post changes
 func PostUpdate(post Post) error {
-	_, err := pool.Exec(context.Background(), `
+	return PostUpdateCtx(context.Background(), post)
+}
+
+// PostUpdateCtx - PostUpdate with context, actor of context is written to audit log
+func PostUpdateCtx(ctx context.Context, post Post) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PostUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
 		UPDATE posts SET
 			name = $2,
 			go = $3,
-			note = $4,
-			updated_at = $5
+			validity = $4,
+			note = $5,
+			updated_at = $6,
+			version = version + 1
 		WHERE
 			id = $1
-	`, post.ID, post.Name, post.GO, post.Note, time.Now())
+		AND
+			version = $7
+	`, post.ID, post.Name, post.GO, post.Validity, post.Note, time.Now(), post.Version)
 	if err != nil {
 		errmsg("UpdatePost update", err)
+		return err
 	}
-	return err
+	return versionCheck("posts", post.ID, post.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return PostGet(post.ID)
+	})
 }
 
 // PostDelete - delete post by id
 func PostDelete(id int64) error {
+	return PostDeleteCtx(context.Background(), id)
+}
+
+// PostDeleteCtx - PostDelete with context, actor of context is written to audit log
+func PostDeleteCtx(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PostDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			posts
 		WHERE
@@ -175,7 +224,9 @@ func postCreateTable() error {
 				id BIGSERIAL PRIMARY KEY,
 				name TEXT,
 				go BOOL NOT NULL DEFAULT FALSE,
+				validity BIGINT NOT NULL DEFAULT 0,
 				note TEXT,
+				version BIGINT NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
 				UNIQUE (name, go)
@@ -0,0 +1,410 @@
+package edc
+
+import (
+	"context"
+	"time"
+)
+
+// Training compliance statuses
+const (
+	TrainingCompliant = "compliant"
+	TrainingDueSoon   = "due"
+	TrainingOverdue   = "overdue"
+)
+
+// PostTraining - training required for contacts holding post or GO post
+// CourseID - post category of education course and certificate, 0 for same post
+// Months   - maximum number of months between trainings, 0 for training once
+type PostTraining struct {
+	ID        int64  `sql:"id"         json:"id"        form:"id"        query:"id"`
+	PostID    int64  `sql:"post_id"    json:"post_id"   form:"post_id"   query:"post_id"`
+	CourseID  int64  `sql:"course_id"  json:"course_id" form:"course_id" query:"course_id"`
+	Months    int64  `sql:"months"     json:"months"    form:"months"    query:"months"`
+	Note      string `sql:"note"       json:"note"      form:"note"      query:"note"`
+	Version   int64  `sql:"version"    json:"version"   form:"version"   query:"version"`
+	CreatedAt string `sql:"created_at" json:"-"`
+	UpdatedAt string `sql:"updated_at" json:"-"`
+}
+
+// PostTrainingList - struct for post training list
+type PostTrainingList struct {
+	ID         int64  `sql:"id"          json:"id"          form:"id"          query:"id"`
+	PostID     int64  `sql:"post_id"     json:"post_id"     form:"post_id"     query:"post_id"`
+	PostName   string `sql:"post_name"   json:"post_name"   form:"post_name"   query:"post_name"`
+	GO         bool   `sql:"go"          json:"go"          form:"go"          query:"go"`
+	CourseID   int64  `sql:"course_id"   json:"course_id"   form:"course_id"   query:"course_id"`
+	CourseName string `sql:"course_name" json:"course_name" form:"course_name" query:"course_name"`
+	Months     int64  `sql:"months"      json:"months"      form:"months"      query:"months"`
+	Note       string `sql:"note"        json:"note"        form:"note"        query:"note"`
+}
+
+// PostTrainingCompliance - last and next due training of contact
+// LastDate - latest end date of completed education or date of certificate, empty if never trained
+// Status   - compliant, due or overdue
+type PostTrainingCompliance struct {
+	CompanyID   int64  `json:"company_id"   form:"company_id"   query:"company_id"`
+	CompanyName string `json:"company_name" form:"company_name" query:"company_name"`
+	ContactID   int64  `json:"contact_id"   form:"contact_id"   query:"contact_id"`
+	ContactName string `json:"contact_name" form:"contact_name" query:"contact_name"`
+	PostID      int64  `json:"post_id"      form:"post_id"      query:"post_id"`
+	PostName    string `json:"post_name"    form:"post_name"    query:"post_name"`
+	GO          bool   `json:"go"           form:"go"           query:"go"`
+	CourseID    int64  `json:"course_id"    form:"course_id"    query:"course_id"`
+	CourseName  string `json:"course_name"  form:"course_name"  query:"course_name"`
+	Months      int64  `json:"months"       form:"months"       query:"months"`
+	LastDate    string `json:"last_date"    form:"last_date"    query:"last_date"`
+	NextDue     string `json:"next_due"     form:"next_due"     query:"next_due"`
+	Status      string `json:"status"       form:"status"       query:"status"`
+}
+
+// PostTrainingCompany - training compliance of contacts of company
+type PostTrainingCompany struct {
+	CompanyID   int64                    `json:"company_id"   form:"company_id"   query:"company_id"`
+	CompanyName string                   `json:"company_name" form:"company_name" query:"company_name"`
+	Compliant   []PostTrainingCompliance `json:"compliant"    form:"compliant"    query:"compliant"`
+	DueSoon     []PostTrainingCompliance `json:"due_soon"     form:"due_soon"     query:"due_soon"`
+	Overdue     []PostTrainingCompliance `json:"overdue"      form:"overdue"      query:"overdue"`
+}
+
+// PostTrainingGet - get one post training by id
+func PostTrainingGet(id int64) (PostTraining, error) {
+	var postTraining PostTraining
+	if id == 0 {
+		return postTraining, nil
+	}
+	postTraining.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			post_id,
+			course_id,
+			months,
+			note,
+			version,
+			created_at,
+			updated_at
+		FROM
+			post_trainings
+		WHERE
+			id = $1
+	`, id).Scan(&postTraining.PostID, &postTraining.CourseID, &postTraining.Months, &postTraining.Note,
+		&postTraining.Version, &postTraining.CreatedAt, &postTraining.UpdatedAt)
+	if err != nil {
+		errmsg("PostTrainingGet QueryRow", err)
+	}
+	return postTraining, err
+}
+
+// PostTrainingListGet - get all post trainings for list
+func PostTrainingListGet() ([]PostTrainingList, error) {
+	return postTrainingListQuery("PostTrainingListGet", 0)
+}
+
+// PostTrainingPostGet - get trainings required for post
+func PostTrainingPostGet(id int64) ([]PostTrainingList, error) {
+	if id == 0 {
+		return []PostTrainingList{}, nil
+	}
+	return postTrainingListQuery("PostTrainingPostGet", id)
+}
+
+func postTrainingListQuery(name string, postID int64) ([]PostTrainingList, error) {
+	var postTrainings []PostTrainingList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			t.id,
+			t.post_id,
+			COALESCE(p.name, '') AS post_name,
+			COALESCE(p.go, false) AS go,
+			t.course_id,
+			COALESCE(cp.name, p.name, '') AS course_name,
+			t.months,
+			t.note
+		FROM
+			post_trainings AS t
+		LEFT JOIN
+			posts AS p ON p.id = t.post_id
+		LEFT JOIN
+			posts AS cp ON cp.id = t.course_id
+		WHERE
+			$1::bigint = 0 OR t.post_id = $1
+		ORDER BY
+			post_name ASC,
+			course_name ASC
+	`, postID)
+	if err != nil {
+		errmsg(name+" Query", err)
+		return postTrainings, err
+	}
+	for rows.Next() {
+		var postTraining PostTrainingList
+		err := rows.Scan(&postTraining.ID, &postTraining.PostID, &postTraining.PostName, &postTraining.GO, &postTraining.CourseID,
+			&postTraining.CourseName, &postTraining.Months, &postTraining.Note)
+		if err != nil {
+			errmsg(name+" Scan", err)
+			return postTrainings, err
+		}
+		postTrainings = append(postTrainings, postTraining)
+	}
+	return postTrainings, rows.Err()
+}
+
+// PostTrainingComplianceGet - get training compliance of contacts by post and GO post grouped by company.
+// CompanyID - 0 for all companies
+// Days      - training is due soon if next due date is within days from today
+func PostTrainingComplianceGet(companyID, days int64) ([]PostTrainingCompany, error) {
+	var companies []PostTrainingCompany
+	rows, err := pool.Query(context.Background(), `
+		WITH requirements AS (
+			SELECT
+				c.company_id,
+				c.id AS contact_id,
+				c.name AS contact_name,
+				t.post_id,
+				CASE WHEN t.course_id = 0 THEN t.post_id ELSE t.course_id END AS course_id,
+				t.months
+			FROM
+				contacts AS c
+			INNER JOIN
+				post_trainings AS t ON t.post_id = c.post_id OR t.post_id = c.post_go_id
+			WHERE
+				c.deleted_at IS NULL
+			AND
+				($1::bigint = 0 OR c.company_id = $1)
+		), trainings AS (
+			SELECT
+				contact_id,
+				post_id,
+				end_date AS date
+			FROM
+				educations
+			WHERE
+				end_date <= current_date
+			AND
+				(completed = true OR end_date < current_date)
+			AND
+				deleted_at IS NULL
+			UNION ALL
+			SELECT
+				contact_id,
+				post_id,
+				cert_date AS date
+			FROM
+				certificates
+			WHERE
+				cert_date <= current_date
+			AND
+				deleted_at IS NULL
+		), compliances AS (
+			SELECT
+				r.company_id,
+				r.contact_id,
+				r.contact_name,
+				r.post_id,
+				r.course_id,
+				r.months,
+				max(t.date) AS last_date
+			FROM
+				requirements AS r
+			LEFT JOIN
+				trainings AS t ON t.contact_id = r.contact_id AND t.post_id = r.course_id
+			GROUP BY
+				r.company_id,
+				r.contact_id,
+				r.contact_name,
+				r.post_id,
+				r.course_id,
+				r.months
+		), dues AS (
+			SELECT
+				*,
+				CASE WHEN months > 0 THEN (last_date + make_interval(months => months::int))::date END AS next_due
+			FROM
+				compliances
+		)
+		SELECT
+			COALESCE(d.company_id, 0),
+			COALESCE(co.name, ''),
+			d.contact_id,
+			COALESCE(d.contact_name, ''),
+			d.post_id,
+			COALESCE(p.name, ''),
+			COALESCE(p.go, false),
+			d.course_id,
+			COALESCE(cp.name, ''),
+			d.months,
+			COALESCE(d.last_date::text, ''),
+			COALESCE(d.next_due::text, ''),
+			CASE
+				WHEN d.last_date IS NULL OR d.next_due < current_date THEN $3::text
+				WHEN d.next_due <= current_date + $2::int THEN $4::text
+				ELSE $5::text
+			END
+		FROM
+			dues AS d
+		LEFT JOIN
+			companies AS co ON co.id = d.company_id
+		LEFT JOIN
+			posts AS p ON p.id = d.post_id
+		LEFT JOIN
+			posts AS cp ON cp.id = d.course_id
+		ORDER BY
+			co.name ASC,
+			d.company_id ASC,
+			d.contact_name ASC,
+			p.name ASC
+	`, companyID, days, TrainingOverdue, TrainingDueSoon, TrainingCompliant)
+	if err != nil {
+		errmsg("PostTrainingComplianceGet Query", err)
+		return companies, err
+	}
+	for rows.Next() {
+		var compliance PostTrainingCompliance
+		err := rows.Scan(&compliance.CompanyID, &compliance.CompanyName, &compliance.ContactID, &compliance.ContactName, &compliance.PostID,
+			&compliance.PostName, &compliance.GO, &compliance.CourseID, &compliance.CourseName, &compliance.Months, &compliance.LastDate,
+			&compliance.NextDue, &compliance.Status)
+		if err != nil {
+			errmsg("PostTrainingComplianceGet Scan", err)
+			return companies, err
+		}
+		if len(companies) == 0 || companies[len(companies)-1].CompanyID != compliance.CompanyID {
+			companies = append(companies, PostTrainingCompany{CompanyID: compliance.CompanyID, CompanyName: compliance.CompanyName})
+		}
+		company := &companies[len(companies)-1]
+		switch compliance.Status {
+		case TrainingOverdue:
+			company.Overdue = append(company.Overdue, compliance)
+		case TrainingDueSoon:
+			company.DueSoon = append(company.DueSoon, compliance)
+		default:
+			company.Compliant = append(company.Compliant, compliance)
+		}
+	}
+	return companies, rows.Err()
+}
+
+// PostTrainingInsert - create new post training
+func PostTrainingInsert(postTraining PostTraining) (int64, error) {
+	return PostTrainingInsertCtx(context.Background(), postTraining)
+}
+
+// PostTrainingInsertCtx - PostTrainingInsert with context, actor of context is written to audit log
+func PostTrainingInsertCtx(ctx context.Context, postTraining PostTraining) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PostTrainingInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO post_trainings
+		(
+			post_id,
+			course_id,
+			months,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6
+		)
+		RETURNING
+			id
+	`, postTraining.PostID, postTraining.CourseID, postTraining.Months, postTraining.Note,
+		time.Now(), time.Now()).Scan(&postTraining.ID)
+	if err != nil {
+		errmsg("PostTrainingInsert QueryRow", err)
+	}
+	return postTraining.ID, err
+}
+
+// PostTrainingUpdate - save post training changes
+func PostTrainingUpdate(postTraining PostTraining) error {
+	return PostTrainingUpdateCtx(context.Background(), postTraining)
+}
+
+// PostTrainingUpdateCtx - PostTrainingUpdate with context, actor of context is written to audit log
+func PostTrainingUpdateCtx(ctx context.Context, postTraining PostTraining) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PostTrainingUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		UPDATE post_trainings SET
+			post_id = $2,
+			course_id = $3,
+			months = $4,
+			note = $5,
+			updated_at = $6,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $7
+	`, postTraining.ID, postTraining.PostID, postTraining.CourseID, postTraining.Months, postTraining.Note, time.Now(), postTraining.Version)
+	if err != nil {
+		errmsg("PostTrainingUpdate Exec", err)
+		return err
+	}
+	return versionCheck("post_trainings", postTraining.ID, postTraining.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return PostTrainingGet(postTraining.ID)
+	})
+}
+
+// PostTrainingDelete - delete post training by id
+func PostTrainingDelete(id int64) error {
+	return PostTrainingDeleteCtx(context.Background(), id)
+}
+
+// PostTrainingDeleteCtx - PostTrainingDelete with context, actor of context is written to audit log
+func PostTrainingDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PostTrainingDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			post_trainings
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("PostTrainingDelete Exec", err)
+	}
+	return err
+}
+
+func postTrainingCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			post_trainings (
+				id         bigserial PRIMARY KEY,
+				post_id    bigint,
+				course_id  bigint NOT NULL DEFAULT 0,
+				months     bigint NOT NULL DEFAULT 0,
+				note       text,
+				version    bigint NOT NULL DEFAULT 0,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now(),
+				UNIQUE(post_id, course_id)
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("postTrainingCreateTable exec", err)
+	}
+	return err
+}
@@ -6,15 +6,28 @@ import (
 )
 
 // Practice - struct for practice
+// Participants - number of participants
+// Equipment    - equipment involved in practice
+// Rating       - outcome rating of practice
+// Remarks      - remarks on practice results
+// Deadline     - deadline to eliminate remarks
+// Members      - contacts took part in practice
 type Practice struct {
-	ID             int64  `sql:"id"               json:"id"               form:"id"               query:"id"`
-	CompanyID      int64  `sql:"company_id"       json:"company_id"       form:"company_id"       query:"company_id"`
-	KindID         int64  `sql:"kind_id"          json:"kind_id"          form:"kind_id"          query:"kind_id"`
-	Topic          string `sql:"topic"            json:"topic"            form:"topic"            query:"topic"`
-	DateOfPractice string `sql:"date_of_practice" json:"date_of_practice" form:"date_of_practice" query:"date_of_practice"`
-	Note           string `sql:"note"             json:"note"             form:"note"             query:"note"`
-	CreatedAt      string `sql:"created_at"       json:"-"`
-	UpdatedAt      string `sql:"updated_at"       json:"-"`
+	ID             int64                 `sql:"id"               json:"id"               form:"id"               query:"id"`
+	CompanyID      int64                 `sql:"company_id"       json:"company_id"       form:"company_id"       query:"company_id"`
+	KindID         int64                 `sql:"kind_id"          json:"kind_id"          form:"kind_id"          query:"kind_id"`
+	Topic          string                `sql:"topic"            json:"topic"            form:"topic"            query:"topic"`
+	DateOfPractice string                `sql:"date_of_practice" json:"date_of_practice" form:"date_of_practice" query:"date_of_practice"`
+	Note           string                `sql:"note"             json:"note"             form:"note"             query:"note"`
+	Participants   int64                 `sql:"participants"     json:"participants"     form:"participants"     query:"participants"`
+	Equipment      string                `sql:"equipment"        json:"equipment"        form:"equipment"        query:"equipment"`
+	Rating         int64                 `sql:"rating"           json:"rating"           form:"rating"           query:"rating"`
+	Remarks        string                `sql:"remarks"          json:"remarks"          form:"remarks"          query:"remarks"`
+	Deadline       string                `sql:"deadline"         json:"deadline"         form:"deadline"         query:"deadline"`
+	Version        int64                 `sql:"version"          json:"version"          form:"version"          query:"version"`
+	CreatedAt      string                `sql:"created_at"       json:"-"`
+	UpdatedAt      string                `sql:"updated_at"       json:"-"`
+	Members        []PracticeParticipant `sql:"-"                json:"members"          form:"members"          query:"members"`
 }
 
 // PracticeList is struct for practice list
@@ -28,6 +41,10 @@ type PracticeList struct {
 	Topic          string `sql:"topic"            json:"topic"            form:"topic"            query:"topic"`
 	DateOfPractice string `sql:"date_of_practice" json:"date_of_practice" form:"date_of_practice" query:"date_of_practice"`
 	DateStr        string `sql:"-"                json:"date_str"         form:"date_str"         query:"date_str"`
+	Participants   int64  `sql:"participants"     json:"participants"     form:"participants"     query:"participants"`
+	Rating         int64  `sql:"rating"           json:"rating"           form:"rating"           query:"rating"`
+	Remarks        string `sql:"remarks"          json:"remarks"          form:"remarks"          query:"remarks"`
+	Deadline       string `sql:"deadline"         json:"deadline"         form:"deadline"         query:"deadline"`
 }
 
 // PracticeShort - short struct for practice
@@ -54,6 +71,12 @@ func PracticeGet(id int64) (Practice, error) {
 			topic,
 			date_of_practice,
 			note,
+			participants,
+			equipment,
+			rating,
+			remarks,
+			COALESCE(deadline::text, '') AS deadline,
+			version,
 			created_at,
 			updated_at
 		FROM
@@ -61,11 +84,16 @@ func PracticeGet(id int64) (Practice, error) {
 		WHERE
 			id = $1
 	`, id).Scan(&practice.CompanyID, &practice.KindID, &practice.Topic, &practice.DateOfPractice, &practice.Note,
-		&practice.CreatedAt, &practice.UpdatedAt)
+		&practice.Participants, &practice.Equipment, &practice.Rating, &practice.Remarks, &practice.Deadline,
+		&practice.Version, &practice.CreatedAt, &practice.UpdatedAt)
 	if err != nil {
 		errmsg("PracticeGet QueryRow", err)
 		return practice, err
 	}
+	practice.Members, err = PracticeParticipantGet(id)
+	if err != nil {
+		errmsg("PracticeGet PracticeParticipantGet", err)
+	}
 	return practice, err
 }
 
@@ -87,6 +115,8 @@ func PracticeListGet() ([]PracticeList, error) {
 			companies AS c ON c.id = p.company_id
 		LEFT JOIN
 			kinds AS k ON k.id = p.kind_id
+		WHERE
+			p.deleted_at IS NULL
 		ORDER BY
 			date_of_practice DESC`)
 	if err != nil {
@@ -100,11 +130,16 @@ func PracticeListGet() ([]PracticeList, error) {
 
 // PracticeCompanyGet - get all practices of company
 func PracticeCompanyGet(id int64) ([]PracticeList, error) {
+	return practiceCompanyQuery("PracticeCompanyGet", id, false)
+}
+
+// practiceCompanyQuery - get practices of company or of company and all its branches
+func practiceCompanyQuery(name string, id int64, subtree bool) ([]PracticeList, error) {
 	var practices []PracticeList
 	if id == 0 {
 		return practices, nil
 	}
-	rows, err := pool.Query(context.Background(), `
+	rows, err := pool.Query(context.Background(), companySubtree+`
 		SELECT
 			p.id,
 			p.company_id,
@@ -113,7 +148,11 @@ func PracticeCompanyGet(id int64) ([]PracticeList, error) {
 			k.name AS kind_name,
 			k.short_name AS kind_short_name,
 			p.date_of_practice,
-			p.topic
+			p.topic,
+			p.participants,
+			p.rating,
+			p.remarks,
+			COALESCE(p.deadline::text, '') AS deadline
 		FROM
 			practices AS p
 		LEFT JOIN
@@ -121,20 +160,23 @@ func PracticeCompanyGet(id int64) ([]PracticeList, error) {
 		LEFT JOIN
 			kinds AS k ON k.id = p.kind_id
 		WHERE
-			p.company_id = $1
+			p.deleted_at IS NULL
+		AND
+			(p.company_id = $1 OR ($2::bool AND p.company_id IN (SELECT id FROM subtree)))
 		ORDER BY
 			date_of_practice DESC
-	`, id)
+	`, id, subtree)
 	if err != nil {
-		errmsg("GetPracticeCompany query", err)
+		errmsg(name+" Query", err)
 		return practices, err
 	}
 	for rows.Next() {
 		var practice PracticeList
 		err := rows.Scan(&practice.ID, &practice.CompanyID, &practice.CompanyName,
-			&practice.KindID, &practice.KindName, &practice.KindShortName, &practice.DateOfPractice, &practice.Topic)
+			&practice.KindID, &practice.KindName, &practice.KindShortName, &practice.DateOfPractice, &practice.Topic,
+			&practice.Participants, &practice.Rating, &practice.Remarks, &practice.Deadline)
 		if err != nil {
-			errmsg("GetPracticeCompany select", err)
+			errmsg(name+" Scan", err)
 			return practices, err
 		}
 		practice.DateStr = setStrMonth(practice.DateOfPractice)
@@ -146,7 +188,7 @@ func PracticeCompanyGet(id int64) ([]PracticeList, error) {
 // PracticeNearGet - get 10 nearest practices
 func PracticeNearGet() ([]PracticeShort, error) {
 	var practices []PracticeShort
-	_, err := pool.Query(context.Background(), `
+	rows, err := pool.Query(context.Background(), `
 		SELECT
 			p.id,
 			p.company_id,
@@ -161,19 +203,43 @@ func PracticeNearGet() ([]PracticeShort, error) {
 		LEFT JOIN
 			kinds AS k ON k.id = p.kind_id
 		WHERE
+			p.deleted_at IS NULL
+		AND
 			p.date_of_practice > TIMESTAMP 'now'::timestamp - '1 month'::interval
 		ORDER BY
 			date_of_practice ASC
 		LIMIT 10`)
 	if err != nil {
 		errmsg("GetPracticeNear query", err)
+		return practices, err
 	}
-	return practices, err
+	for rows.Next() {
+		var practice PracticeShort
+		err := rows.Scan(&practice.ID, &practice.CompanyID, &practice.CompanyName, &practice.KindID,
+			&practice.KindShortName, &practice.DateOfPractice)
+		if err != nil {
+			errmsg("GetPracticeNear Scan", err)
+			return practices, err
+		}
+		practices = append(practices, practice)
+	}
+	return practices, rows.Err()
 }
 
 // PracticeInsert - create new practice
 func PracticeInsert(practice Practice) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return PracticeInsertCtx(context.Background(), practice)
+}
+
+// PracticeInsertCtx - PracticeInsert with context, actor of context is written to audit log
+func PracticeInsertCtx(ctx context.Context, practice Practice) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PracticeInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO practices
 		(
 			company_id,
@@ -181,6 +247,11 @@ func PracticeInsert(practice Practice) (int64, error) {
 			topic,
 			date_of_practice,
 			note,
+			participants,
+			equipment,
+			rating,
+			remarks,
+			deadline,
 			created_at,
 			updated_at
 		)
@@ -192,44 +263,99 @@ func PracticeInsert(practice Practice) (int64, error) {
 			$4,
 			$5,
 			$6,
-			$7
+			$7,
+			$8,
+			$9,
+			NULLIF($10, '')::date,
+			$11,
+			$12
 		)
 		RETURNING
 			id
 	`, practice.CompanyID, practice.KindID, practice.Topic, practice.DateOfPractice,
-		practice.Note, time.Now(), time.Now()).Scan(&practice.ID)
+		practice.Note, practice.Participants, practice.Equipment, practice.Rating, practice.Remarks, practice.Deadline,
+		time.Now(), time.Now()).Scan(&practice.ID)
 	if err != nil {
 		errmsg("PracticeInsert QueryRow", err)
+		return practice.ID, err
 	}
+	err = practiceParticipantSave(ctx, tx, practice.ID, practice.Members)
 	return practice.ID, err
 }
 
 // PracticeUpdate - save practice changes
 func PracticeUpdate(practice Practice) error {
-	_, err := pool.Exec(context.Background(), `
+	return PracticeUpdateCtx(context.Background(), practice)
+}
+
+// PracticeUpdateCtx - PracticeUpdate with context, actor of context is written to audit log
+func PracticeUpdateCtx(ctx context.Context, practice Practice) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PracticeUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
 		UPDATE practices SET
 			company_id = $2,
 			kind_id = $3,
 			topic = $4,
 			date_of_practice = $5,
 			note = $6,
-			updated_at = $7
+			participants = $7,
+			equipment = $8,
+			rating = $9,
+			remarks = $10,
+			deadline = NULLIF($11, '')::date,
+			updated_at = $12,
+			version = version + 1
 		WHERE
 			id = $1
+		AND
+			version = $13
 	`, practice.ID, practice.CompanyID, practice.KindID, practice.Topic, practice.DateOfPractice,
-		practice.Note, time.Now())
+		practice.Note, practice.Participants, practice.Equipment, practice.Rating, practice.Remarks, practice.Deadline,
+		time.Now(), practice.Version)
 	if err != nil {
 		errmsg("PracticeUpdate Exec", err)
+		return err
 	}
-	return err
+	err = versionCheck("practices", practice.ID, practice.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return PracticeGet(practice.ID)
+	})
+	if err != nil {
+		return err
+	}
+	return practiceParticipantSave(ctx, tx, practice.ID, practice.Members)
 }
 
-// PracticeDelete - delete practice by id
+// PracticeDelete - move practice to trash, participants are kept until purge
 func PracticeDelete(id int64) error {
+	return PracticeDeleteCtx(context.Background(), id)
+}
+
+// PracticeDeleteCtx - PracticeDelete with context, actor of context is written to audit log
+func PracticeDeleteCtx(ctx context.Context, id int64) error {
+	return trashDelete(ctx, "practices", id)
+}
+
+// practicePurge - delete practice by id with child rows
+func practicePurge(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("practicePurge auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = practiceParticipantSave(ctx, tx, id, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			practices
 		WHERE
@@ -251,6 +377,13 @@ func practiceCreateTable() error {
 				topic text,
 				date_of_practice date,
 				note text,
+				participants bigint NOT NULL DEFAULT 0,
+				equipment text NOT NULL DEFAULT '',
+				rating bigint NOT NULL DEFAULT 0,
+				remarks text NOT NULL DEFAULT '',
+				deadline date,
+				deleted_at TIMESTAMP without time zone,
+				version bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now()
 			)
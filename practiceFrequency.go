@@ -0,0 +1,342 @@
+package edc
+
+import (
+	"context"
+	"time"
+)
+
+// PracticeFrequency - required frequency of practices of kind
+// ScopeID - 0 for all scopes, otherwise overrides frequency for companies of scope
+// Months  - maximum number of months between practices
+type PracticeFrequency struct {
+	ID        int64  `sql:"id"         json:"id"       form:"id"       query:"id"`
+	KindID    int64  `sql:"kind_id"    json:"kind_id"  form:"kind_id"  query:"kind_id"`
+	ScopeID   int64  `sql:"scope_id"   json:"scope_id" form:"scope_id" query:"scope_id"`
+	Months    int64  `sql:"months"     json:"months"   form:"months"   query:"months"`
+	Note      string `sql:"note"       json:"note"     form:"note"     query:"note"`
+	Version   int64  `sql:"version"    json:"version"  form:"version"  query:"version"`
+	CreatedAt string `sql:"created_at" json:"-"`
+	UpdatedAt string `sql:"updated_at" json:"-"`
+}
+
+// PracticeFrequencyList - struct for practice frequency list
+type PracticeFrequencyList struct {
+	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
+	KindID    int64  `sql:"kind_id"    json:"kind_id"    form:"kind_id"    query:"kind_id"`
+	KindName  string `sql:"kind_name"  json:"kind_name"  form:"kind_name"  query:"kind_name"`
+	ScopeID   int64  `sql:"scope_id"   json:"scope_id"   form:"scope_id"   query:"scope_id"`
+	ScopeName string `sql:"scope_name" json:"scope_name" form:"scope_name" query:"scope_name"`
+	Months    int64  `sql:"months"     json:"months"     form:"months"     query:"months"`
+	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
+}
+
+// PracticeCompliance - last and next due practice of kind for company
+// LastPractice - empty if company never held practice of kind
+// Overdue      - next due date passed or company never held practice of kind
+type PracticeCompliance struct {
+	CompanyID     int64  `json:"company_id"      form:"company_id"      query:"company_id"`
+	CompanyName   string `json:"company_name"    form:"company_name"    query:"company_name"`
+	ScopeName     string `json:"scope_name"      form:"scope_name"      query:"scope_name"`
+	KindID        int64  `json:"kind_id"         form:"kind_id"         query:"kind_id"`
+	KindName      string `json:"kind_name"       form:"kind_name"       query:"kind_name"`
+	KindShortName string `json:"kind_short_name" form:"kind_short_name" query:"kind_short_name"`
+	Months        int64  `json:"months"          form:"months"          query:"months"`
+	LastPractice  string `json:"last_practice"   form:"last_practice"   query:"last_practice"`
+	NextDue       string `json:"next_due"        form:"next_due"        query:"next_due"`
+	Overdue       bool   `json:"overdue"         form:"overdue"         query:"overdue"`
+	Never         bool   `json:"never"           form:"never"           query:"never"`
+}
+
+// PracticeFrequencyGet - get one practice frequency by id
+func PracticeFrequencyGet(id int64) (PracticeFrequency, error) {
+	var practiceFrequency PracticeFrequency
+	if id == 0 {
+		return practiceFrequency, nil
+	}
+	practiceFrequency.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			kind_id,
+			scope_id,
+			months,
+			note,
+			version,
+			created_at,
+			updated_at
+		FROM
+			practice_frequencies
+		WHERE
+			id = $1
+	`, id).Scan(&practiceFrequency.KindID, &practiceFrequency.ScopeID, &practiceFrequency.Months, &practiceFrequency.Note,
+		&practiceFrequency.Version, &practiceFrequency.CreatedAt, &practiceFrequency.UpdatedAt)
+	if err != nil {
+		errmsg("PracticeFrequencyGet QueryRow", err)
+	}
+	return practiceFrequency, err
+}
+
+// PracticeFrequencyListGet - get all practice frequencies for list
+func PracticeFrequencyListGet() ([]PracticeFrequencyList, error) {
+	var practiceFrequencies []PracticeFrequencyList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			f.id,
+			f.kind_id,
+			k.name AS kind_name,
+			f.scope_id,
+			COALESCE(s.name, '') AS scope_name,
+			f.months,
+			f.note
+		FROM
+			practice_frequencies AS f
+		LEFT JOIN
+			kinds AS k ON k.id = f.kind_id
+		LEFT JOIN
+			scopes AS s ON s.id = f.scope_id
+		ORDER BY
+			k.name ASC,
+			scope_name ASC
+	`)
+	if err != nil {
+		errmsg("PracticeFrequencyListGet Query", err)
+		return practiceFrequencies, err
+	}
+	for rows.Next() {
+		var practiceFrequency PracticeFrequencyList
+		err := rows.Scan(&practiceFrequency.ID, &practiceFrequency.KindID, &practiceFrequency.KindName, &practiceFrequency.ScopeID,
+			&practiceFrequency.ScopeName, &practiceFrequency.Months, &practiceFrequency.Note)
+		if err != nil {
+			errmsg("PracticeFrequencyListGet Scan", err)
+			return practiceFrequencies, err
+		}
+		practiceFrequencies = append(practiceFrequencies, practiceFrequency)
+	}
+	return practiceFrequencies, rows.Err()
+}
+
+// PracticeComplianceGet - get last and next due practices of every required kind for all companies
+func PracticeComplianceGet() ([]PracticeCompliance, error) {
+	return practiceComplianceQuery("PracticeComplianceGet", false)
+}
+
+// PracticeOverdueGet - get companies which are overdue or never held required practice
+func PracticeOverdueGet() ([]PracticeCompliance, error) {
+	return practiceComplianceQuery("PracticeOverdueGet", true)
+}
+
+func practiceComplianceQuery(name string, overdueOnly bool) ([]PracticeCompliance, error) {
+	var compliances []PracticeCompliance
+	rows, err := pool.Query(context.Background(), `
+		WITH frequencies AS (
+			SELECT DISTINCT ON (c.id, f.kind_id)
+				c.id AS company_id,
+				f.kind_id,
+				f.months
+			FROM
+				companies AS c
+			INNER JOIN
+				practice_frequencies AS f ON f.scope_id = c.scope_id OR f.scope_id = 0
+			WHERE
+				c.deleted_at IS NULL
+			ORDER BY
+				c.id,
+				f.kind_id,
+				f.scope_id DESC
+		), compliances AS (
+			SELECT
+				f.company_id,
+				c.name AS company_name,
+				COALESCE(s.name, '') AS scope_name,
+				f.kind_id,
+				k.name AS kind_name,
+				k.short_name AS kind_short_name,
+				f.months,
+				max(p.date_of_practice) AS last_practice
+			FROM
+				frequencies AS f
+			INNER JOIN
+				companies AS c ON c.id = f.company_id
+			LEFT JOIN
+				scopes AS s ON s.id = c.scope_id
+			LEFT JOIN
+				kinds AS k ON k.id = f.kind_id
+			LEFT JOIN
+				practices AS p ON p.company_id = f.company_id AND p.kind_id = f.kind_id AND p.date_of_practice <= current_date
+					AND p.deleted_at IS NULL
+			GROUP BY
+				f.company_id,
+				c.name,
+				s.name,
+				f.kind_id,
+				k.name,
+				k.short_name,
+				f.months
+		)
+		SELECT
+			company_id,
+			company_name,
+			scope_name,
+			kind_id,
+			kind_name,
+			kind_short_name,
+			months,
+			COALESCE(last_practice::text, '') AS last_practice,
+			COALESCE((last_practice + make_interval(months => months::int))::date::text, '') AS next_due,
+			last_practice IS NULL OR last_practice + make_interval(months => months::int) < current_date AS overdue,
+			last_practice IS NULL AS never
+		FROM
+			compliances
+		WHERE
+			$1 = false
+		OR
+			last_practice IS NULL
+		OR
+			last_practice + make_interval(months => months::int) < current_date
+		ORDER BY
+			company_name ASC,
+			kind_name ASC
+	`, overdueOnly)
+	if err != nil {
+		errmsg(name+" Query", err)
+		return compliances, err
+	}
+	for rows.Next() {
+		var compliance PracticeCompliance
+		err := rows.Scan(&compliance.CompanyID, &compliance.CompanyName, &compliance.ScopeName, &compliance.KindID, &compliance.KindName,
+			&compliance.KindShortName, &compliance.Months, &compliance.LastPractice, &compliance.NextDue, &compliance.Overdue, &compliance.Never)
+		if err != nil {
+			errmsg(name+" Scan", err)
+			return compliances, err
+		}
+		compliances = append(compliances, compliance)
+	}
+	return compliances, rows.Err()
+}
+
+// PracticeFrequencyInsert - create new practice frequency
+func PracticeFrequencyInsert(practiceFrequency PracticeFrequency) (int64, error) {
+	return PracticeFrequencyInsertCtx(context.Background(), practiceFrequency)
+}
+
+// PracticeFrequencyInsertCtx - PracticeFrequencyInsert with context, actor of context is written to audit log
+func PracticeFrequencyInsertCtx(ctx context.Context, practiceFrequency PracticeFrequency) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PracticeFrequencyInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO practice_frequencies
+		(
+			kind_id,
+			scope_id,
+			months,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6
+		)
+		RETURNING
+			id
+	`, practiceFrequency.KindID, practiceFrequency.ScopeID, practiceFrequency.Months, practiceFrequency.Note,
+		time.Now(), time.Now()).Scan(&practiceFrequency.ID)
+	if err != nil {
+		errmsg("PracticeFrequencyInsert QueryRow", err)
+	}
+	return practiceFrequency.ID, err
+}
+
+// PracticeFrequencyUpdate - save practice frequency changes
+func PracticeFrequencyUpdate(practiceFrequency PracticeFrequency) error {
+	return PracticeFrequencyUpdateCtx(context.Background(), practiceFrequency)
+}
+
+// PracticeFrequencyUpdateCtx - PracticeFrequencyUpdate with context, actor of context is written to audit log
+func PracticeFrequencyUpdateCtx(ctx context.Context, practiceFrequency PracticeFrequency) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PracticeFrequencyUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		UPDATE practice_frequencies SET
+			kind_id = $2,
+			scope_id = $3,
+			months = $4,
+			note = $5,
+			updated_at = $6,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $7
+	`, practiceFrequency.ID, practiceFrequency.KindID, practiceFrequency.ScopeID, practiceFrequency.Months, practiceFrequency.Note,
+		time.Now(), practiceFrequency.Version)
+	if err != nil {
+		errmsg("PracticeFrequencyUpdate Exec", err)
+		return err
+	}
+	return versionCheck("practice_frequencies", practiceFrequency.ID, practiceFrequency.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return PracticeFrequencyGet(practiceFrequency.ID)
+	})
+}
+
+// PracticeFrequencyDelete - delete practice frequency by id
+func PracticeFrequencyDelete(id int64) error {
+	return PracticeFrequencyDeleteCtx(context.Background(), id)
+}
+
+// PracticeFrequencyDeleteCtx - PracticeFrequencyDelete with context, actor of context is written to audit log
+func PracticeFrequencyDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PracticeFrequencyDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			practice_frequencies
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("PracticeFrequencyDelete Exec", err)
+	}
+	return err
+}
+
+func practiceFrequencyCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			practice_frequencies (
+				id         bigserial PRIMARY KEY,
+				kind_id    bigint,
+				scope_id   bigint NOT NULL DEFAULT 0,
+				months     bigint,
+				note       text,
+				version    bigint NOT NULL DEFAULT 0,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now(),
+				UNIQUE(kind_id, scope_id)
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("practiceFrequencyCreateTable exec", err)
+	}
+	return err
+}
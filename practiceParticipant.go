@@ -0,0 +1,209 @@
+package edc
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// PracticeParticipant - contact took part in practice
+type PracticeParticipant struct {
+	PracticeID  int64  `sql:"practice_id"  json:"practice_id"  form:"practice_id"  query:"practice_id"`
+	ContactID   int64  `sql:"contact_id"   json:"contact_id"   form:"contact_id"   query:"contact_id"`
+	ContactName string `sql:"-"            json:"contact_name" form:"contact_name" query:"contact_name"`
+	Role        string `sql:"role"         json:"role"         form:"role"         query:"role"`
+}
+
+// PracticeContact - practice attended by contact
+type PracticeContact struct {
+	ID             int64  `sql:"id"               json:"id"               form:"id"               query:"id"`
+	CompanyID      int64  `sql:"company_id"       json:"company_id"       form:"company_id"       query:"company_id"`
+	CompanyName    string `sql:"company_name"     json:"company_name"     form:"company_name"     query:"company_name"`
+	KindID         int64  `sql:"kind_id"          json:"kind_id"          form:"kind_id"          query:"kind_id"`
+	KindName       string `sql:"kind_name"        json:"kind_name"        form:"kind_name"        query:"kind_name"`
+	KindShortName  string `sql:"kind_short_name"  json:"kind_short_name"  form:"kind_short_name"  query:"kind_short_name"`
+	Topic          string `sql:"topic"            json:"topic"            form:"topic"            query:"topic"`
+	DateOfPractice string `sql:"date_of_practice" json:"date_of_practice" form:"date_of_practice" query:"date_of_practice"`
+	DateStr        string `sql:"-"                json:"date_str"         form:"date_str"         query:"date_str"`
+	Role           string `sql:"role"             json:"role"             form:"role"             query:"role"`
+	Rating         int64  `sql:"rating"           json:"rating"           form:"rating"           query:"rating"`
+}
+
+// PracticeParticipantGet - get all participants of practice
+func PracticeParticipantGet(id int64) ([]PracticeParticipant, error) {
+	var participants []PracticeParticipant
+	if id == 0 {
+		return participants, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			pp.practice_id,
+			pp.contact_id,
+			c.name AS contact_name,
+			pp.role
+		FROM
+			practice_participants AS pp
+		LEFT JOIN
+			contacts AS c ON c.id = pp.contact_id
+		WHERE
+			pp.practice_id = $1
+		ORDER BY
+			c.name ASC
+	`, id)
+	if err != nil {
+		errmsg("PracticeParticipantGet Query", err)
+		return participants, err
+	}
+	for rows.Next() {
+		var participant PracticeParticipant
+		err := rows.Scan(&participant.PracticeID, &participant.ContactID, &participant.ContactName, &participant.Role)
+		if err != nil {
+			errmsg("PracticeParticipantGet Scan", err)
+			return participants, err
+		}
+		participants = append(participants, participant)
+	}
+	return participants, rows.Err()
+}
+
+// PracticeContactGet - get history of practices attended by contact
+func PracticeContactGet(id int64) ([]PracticeContact, error) {
+	var practices []PracticeContact
+	if id == 0 {
+		return practices, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			p.id,
+			p.company_id,
+			c.name AS company_name,
+			p.kind_id,
+			k.name AS kind_name,
+			k.short_name AS kind_short_name,
+			p.topic,
+			p.date_of_practice,
+			pp.role,
+			p.rating
+		FROM
+			practice_participants AS pp
+		INNER JOIN
+			practices AS p ON p.id = pp.practice_id
+		LEFT JOIN
+			companies AS c ON c.id = p.company_id
+		LEFT JOIN
+			kinds AS k ON k.id = p.kind_id
+		WHERE
+			pp.contact_id = $1
+		AND
+			p.deleted_at IS NULL
+		ORDER BY
+			p.date_of_practice DESC
+	`, id)
+	if err != nil {
+		errmsg("PracticeContactGet Query", err)
+		return practices, err
+	}
+	for rows.Next() {
+		var practice PracticeContact
+		err := rows.Scan(&practice.ID, &practice.CompanyID, &practice.CompanyName, &practice.KindID, &practice.KindName,
+			&practice.KindShortName, &practice.Topic, &practice.DateOfPractice, &practice.Role, &practice.Rating)
+		if err != nil {
+			errmsg("PracticeContactGet Scan", err)
+			return practices, err
+		}
+		practice.DateStr = setStrMonth(practice.DateOfPractice)
+		practices = append(practices, practice)
+	}
+	return practices, rows.Err()
+}
+
+// PracticeParticipantUpdate - update participants of practice
+func PracticeParticipantUpdate(id int64, participants []PracticeParticipant) error {
+	return PracticeParticipantUpdateCtx(context.Background(), id, participants)
+}
+
+// PracticeParticipantUpdateCtx - PracticeParticipantUpdate with context, actor of context is written to audit log
+func PracticeParticipantUpdateCtx(ctx context.Context, id int64, participants []PracticeParticipant) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PracticeParticipantUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	return practiceParticipantSave(ctx, tx, id, participants)
+}
+
+// practiceParticipantSave - delete removed participants of practice, insert new ones and update changed roles
+// inside transaction of practice change
+func practiceParticipantSave(ctx context.Context, tx pgx.Tx, id int64, participants []PracticeParticipant) error {
+	contactIDs := make([]int64, 0, len(participants))
+	for i := range participants {
+		contactIDs = append(contactIDs, participants[i].ContactID)
+	}
+	_, err := tx.Exec(ctx, `
+		DELETE FROM
+			practice_participants
+		WHERE
+			practice_id = $1
+		AND
+			NOT (contact_id = ANY($2::bigint[]))
+	`, id, contactIDs)
+	if err != nil {
+		errmsg("practiceParticipantSave Exec", err)
+		return err
+	}
+	for i := range participants {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO practice_participants
+			(
+				practice_id,
+				contact_id,
+				role,
+				created_at,
+				updated_at
+			)
+			VALUES
+			(
+				$1,
+				$2,
+				$3,
+				$4,
+				$5
+			)
+			ON CONFLICT (practice_id, contact_id) DO UPDATE SET
+				role = EXCLUDED.role,
+				updated_at = EXCLUDED.updated_at
+			WHERE
+				practice_participants.role IS DISTINCT FROM EXCLUDED.role
+		`, id, participants[i].ContactID, participants[i].Role, time.Now(), time.Now())
+		if err != nil {
+			errmsg("practiceParticipantSave Insert", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func practiceParticipantCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			practice_participants (
+				id          bigserial PRIMARY KEY,
+				practice_id bigint,
+				contact_id  bigint,
+				role        text,
+				created_at  TIMESTAMP without time zone,
+				updated_at  TIMESTAMP without time zone default now(),
+				UNIQUE(practice_id, contact_id)
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("practiceParticipantCreateTable exec", err)
+	}
+	return err
+}
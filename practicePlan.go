@@ -0,0 +1,488 @@
+package edc
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Practice plan statuses
+const (
+	PracticePlanPlanned   = "planned"
+	PracticePlanHeld      = "held"
+	PracticePlanMoved     = "moved"
+	PracticePlanCancelled = "cancelled"
+)
+
+// PracticePlan - planned practice of company
+// PlanDate   - planned date, first day of month if only month is planned
+// PracticeID - id of practice held by plan, 0 to match practice automatically
+type PracticePlan struct {
+	ID         int64  `sql:"id"          json:"id"          form:"id"          query:"id"`
+	CompanyID  int64  `sql:"company_id"  json:"company_id"  form:"company_id"  query:"company_id"`
+	KindID     int64  `sql:"kind_id"     json:"kind_id"     form:"kind_id"     query:"kind_id"`
+	PlanDate   string `sql:"plan_date"   json:"plan_date"   form:"plan_date"   query:"plan_date"`
+	Cancelled  bool   `sql:"cancelled"   json:"cancelled"   form:"cancelled"   query:"cancelled"`
+	PracticeID int64  `sql:"practice_id" json:"practice_id" form:"practice_id" query:"practice_id"`
+	Note       string `sql:"note"        json:"note"        form:"note"        query:"note"`
+	Version    int64  `sql:"version"     json:"version"     form:"version"     query:"version"`
+	CreatedAt  string `sql:"created_at"  json:"-"`
+	UpdatedAt  string `sql:"updated_at"  json:"-"`
+}
+
+// PracticePlanList - struct for practice plan list with actual status
+type PracticePlanList struct {
+	ID            int64  `json:"id"              form:"id"              query:"id"`
+	CompanyID     int64  `json:"company_id"      form:"company_id"      query:"company_id"`
+	CompanyName   string `json:"company_name"    form:"company_name"    query:"company_name"`
+	ScopeID       int64  `json:"scope_id"        form:"scope_id"        query:"scope_id"`
+	ScopeName     string `json:"scope_name"      form:"scope_name"      query:"scope_name"`
+	KindID        int64  `json:"kind_id"         form:"kind_id"         query:"kind_id"`
+	KindName      string `json:"kind_name"       form:"kind_name"       query:"kind_name"`
+	KindShortName string `json:"kind_short_name" form:"kind_short_name" query:"kind_short_name"`
+	PlanDate      string `json:"plan_date"       form:"plan_date"       query:"plan_date"`
+	PracticeID    int64  `json:"practice_id"     form:"practice_id"     query:"practice_id"`
+	PracticeDate  string `json:"practice_date"   form:"practice_date"   query:"practice_date"`
+	Status        string `json:"status"          form:"status"          query:"status"`
+	Note          string `json:"note"            form:"note"            query:"note"`
+	planDate      time.Time
+	cancelled     bool
+}
+
+// PracticePlanTotal - count of practice plans by status
+// Month, KindID and ScopeID are 0 when totals are not broken down by them
+type PracticePlanTotal struct {
+	Month     int64  `json:"month"      form:"month"      query:"month"`
+	KindID    int64  `json:"kind_id"    form:"kind_id"    query:"kind_id"`
+	KindName  string `json:"kind_name"  form:"kind_name"  query:"kind_name"`
+	ScopeID   int64  `json:"scope_id"   form:"scope_id"   query:"scope_id"`
+	ScopeName string `json:"scope_name" form:"scope_name" query:"scope_name"`
+	Planned   int64  `json:"planned"    form:"planned"    query:"planned"`
+	Held      int64  `json:"held"       form:"held"       query:"held"`
+	Moved     int64  `json:"moved"      form:"moved"      query:"moved"`
+	Cancelled int64  `json:"cancelled"  form:"cancelled"  query:"cancelled"`
+	Pending   int64  `json:"pending"    form:"pending"    query:"pending"`
+}
+
+// PracticePlanReport - annual practice plan versus actuals report
+// Rows - totals by month, kind and scope
+type PracticePlanReport struct {
+	Year   int64               `json:"year"   form:"year"   query:"year"`
+	Rows   []PracticePlanTotal `json:"rows"   form:"rows"   query:"rows"`
+	Months []PracticePlanTotal `json:"months" form:"months" query:"months"`
+	Kinds  []PracticePlanTotal `json:"kinds"  form:"kinds"  query:"kinds"`
+	Scopes []PracticePlanTotal `json:"scopes" form:"scopes" query:"scopes"`
+	Total  PracticePlanTotal   `json:"total"  form:"total"  query:"total"`
+}
+
+type practiceActual struct {
+	id        int64
+	companyID int64
+	kindID    int64
+	date      time.Time
+}
+
+// PracticePlanGet - get one practice plan by id
+func PracticePlanGet(id int64) (PracticePlan, error) {
+	var practicePlan PracticePlan
+	if id == 0 {
+		return practicePlan, nil
+	}
+	practicePlan.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			company_id,
+			kind_id,
+			plan_date,
+			cancelled,
+			practice_id,
+			note,
+			version,
+			created_at,
+			updated_at
+		FROM
+			practice_plans
+		WHERE
+			id = $1
+	`, id).Scan(&practicePlan.CompanyID, &practicePlan.KindID, &practicePlan.PlanDate, &practicePlan.Cancelled, &practicePlan.PracticeID,
+		&practicePlan.Note, &practicePlan.Version, &practicePlan.CreatedAt, &practicePlan.UpdatedAt)
+	if err != nil {
+		errmsg("PracticePlanGet QueryRow", err)
+	}
+	return practicePlan, err
+}
+
+// PracticePlanListGet - get all practice plans of year with status compared to held practices
+func PracticePlanListGet(year int64) ([]PracticePlanList, error) {
+	var practicePlans []PracticePlanList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			pp.id,
+			pp.company_id,
+			COALESCE(c.name, '') AS company_name,
+			COALESCE(c.scope_id, 0) AS scope_id,
+			COALESCE(s.name, '') AS scope_name,
+			pp.kind_id,
+			COALESCE(k.name, '') AS kind_name,
+			COALESCE(k.short_name, '') AS kind_short_name,
+			pp.plan_date,
+			pp.cancelled,
+			pp.practice_id,
+			pp.note
+		FROM
+			practice_plans AS pp
+		LEFT JOIN
+			companies AS c ON c.id = pp.company_id
+		LEFT JOIN
+			scopes AS s ON s.id = c.scope_id
+		LEFT JOIN
+			kinds AS k ON k.id = pp.kind_id
+		WHERE
+			date_part('year', pp.plan_date) = $1
+		AND
+			c.deleted_at IS NULL
+		ORDER BY
+			pp.plan_date ASC,
+			pp.id ASC
+	`, year)
+	if err != nil {
+		errmsg("PracticePlanListGet Query", err)
+		return practicePlans, err
+	}
+	for rows.Next() {
+		var practicePlan PracticePlanList
+		err := rows.Scan(&practicePlan.ID, &practicePlan.CompanyID, &practicePlan.CompanyName, &practicePlan.ScopeID, &practicePlan.ScopeName,
+			&practicePlan.KindID, &practicePlan.KindName, &practicePlan.KindShortName, &practicePlan.planDate, &practicePlan.cancelled,
+			&practicePlan.PracticeID, &practicePlan.Note)
+		if err != nil {
+			errmsg("PracticePlanListGet Scan", err)
+			return practicePlans, err
+		}
+		practicePlan.PlanDate = practicePlan.planDate.Format("2006-01-02")
+		practicePlans = append(practicePlans, practicePlan)
+	}
+	if err := rows.Err(); err != nil {
+		errmsg("PracticePlanListGet Rows", err)
+		return practicePlans, err
+	}
+	actuals, err := practiceActualGet(year)
+	if err != nil {
+		errmsg("PracticePlanListGet practiceActualGet", err)
+		return practicePlans, err
+	}
+	practicePlanMatch(practicePlans, actuals)
+	return practicePlans, nil
+}
+
+// practiceActualGet - get practices held in year and practices linked to plans of year
+func practiceActualGet(year int64) ([]practiceActual, error) {
+	var actuals []practiceActual
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			company_id,
+			kind_id,
+			date_of_practice
+		FROM
+			practices
+		WHERE
+			deleted_at IS NULL
+		AND
+			(
+				date_part('year', date_of_practice) = $1
+			OR
+				id IN (SELECT practice_id FROM practice_plans WHERE date_part('year', plan_date) = $1)
+			)
+		ORDER BY
+			date_of_practice ASC,
+			id ASC
+	`, year)
+	if err != nil {
+		errmsg("practiceActualGet Query", err)
+		return actuals, err
+	}
+	for rows.Next() {
+		var actual practiceActual
+		err := rows.Scan(&actual.id, &actual.companyID, &actual.kindID, &actual.date)
+		if err != nil {
+			errmsg("practiceActualGet Scan", err)
+			return actuals, err
+		}
+		actuals = append(actuals, actual)
+	}
+	return actuals, rows.Err()
+}
+
+// practicePlanMatch - set status of plans. Practice held in planned month is held,
+// practice held in another month of the year is moved. Every practice matches one plan.
+func practicePlanMatch(plans []PracticePlanList, actuals []practiceActual) {
+	used := make(map[int64]bool)
+	byID := make(map[int64]practiceActual)
+	for _, actual := range actuals {
+		byID[actual.id] = actual
+	}
+	setActual := func(plan *PracticePlanList, actual practiceActual) {
+		used[actual.id] = true
+		plan.PracticeID = actual.id
+		plan.PracticeDate = actual.date.Format("2006-01-02")
+		if actual.date.Year() == plan.planDate.Year() && actual.date.Month() == plan.planDate.Month() {
+			plan.Status = PracticePlanHeld
+		} else {
+			plan.Status = PracticePlanMoved
+		}
+	}
+	for i := range plans {
+		plans[i].Status = PracticePlanPlanned
+		if plans[i].cancelled {
+			plans[i].Status = PracticePlanCancelled
+			continue
+		}
+		if actual, ok := byID[plans[i].PracticeID]; ok && plans[i].PracticeID != 0 {
+			setActual(&plans[i], actual)
+		} else {
+			plans[i].PracticeID = 0
+		}
+	}
+	find := func(plan PracticePlanList, sameMonth bool) (practiceActual, bool) {
+		var (
+			found    practiceActual
+			ok       bool
+			distance time.Duration
+		)
+		for _, actual := range actuals {
+			if used[actual.id] || actual.companyID != plan.CompanyID || actual.kindID != plan.KindID ||
+				actual.date.Year() != plan.planDate.Year() {
+				continue
+			}
+			if sameMonth && actual.date.Month() != plan.planDate.Month() {
+				continue
+			}
+			d := actual.date.Sub(plan.planDate)
+			if d < 0 {
+				d = -d
+			}
+			if !ok || d < distance {
+				found, ok, distance = actual, true, d
+			}
+		}
+		return found, ok
+	}
+	for _, sameMonth := range []bool{true, false} {
+		for i := range plans {
+			if plans[i].Status != PracticePlanPlanned {
+				continue
+			}
+			if actual, ok := find(plans[i], sameMonth); ok {
+				setActual(&plans[i], actual)
+			}
+		}
+	}
+}
+
+// PracticePlanReportGet - get annual report of practice plan versus actual practices
+func PracticePlanReportGet(year int64) (PracticePlanReport, error) {
+	report := PracticePlanReport{Year: year}
+	plans, err := PracticePlanListGet(year)
+	if err != nil {
+		errmsg("PracticePlanReportGet PracticePlanListGet", err)
+		return report, err
+	}
+	rows := make(map[[3]int64]*PracticePlanTotal)
+	months := make(map[int64]*PracticePlanTotal)
+	kinds := make(map[int64]*PracticePlanTotal)
+	scopes := make(map[int64]*PracticePlanTotal)
+	for _, plan := range plans {
+		month := int64(plan.planDate.Month())
+		key := [3]int64{month, plan.KindID, plan.ScopeID}
+		if rows[key] == nil {
+			rows[key] = &PracticePlanTotal{Month: month, KindID: plan.KindID, KindName: plan.KindName, ScopeID: plan.ScopeID, ScopeName: plan.ScopeName}
+		}
+		if months[month] == nil {
+			months[month] = &PracticePlanTotal{Month: month}
+		}
+		if kinds[plan.KindID] == nil {
+			kinds[plan.KindID] = &PracticePlanTotal{KindID: plan.KindID, KindName: plan.KindName}
+		}
+		if scopes[plan.ScopeID] == nil {
+			scopes[plan.ScopeID] = &PracticePlanTotal{ScopeID: plan.ScopeID, ScopeName: plan.ScopeName}
+		}
+		for _, total := range []*PracticePlanTotal{rows[key], months[month], kinds[plan.KindID], scopes[plan.ScopeID], &report.Total} {
+			total.add(plan.Status)
+		}
+	}
+	for _, total := range rows {
+		report.Rows = append(report.Rows, *total)
+	}
+	for _, total := range months {
+		report.Months = append(report.Months, *total)
+	}
+	for _, total := range kinds {
+		report.Kinds = append(report.Kinds, *total)
+	}
+	for _, total := range scopes {
+		report.Scopes = append(report.Scopes, *total)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Month != b.Month {
+			return a.Month < b.Month
+		}
+		if a.KindName != b.KindName {
+			return a.KindName < b.KindName
+		}
+		return a.ScopeName < b.ScopeName
+	})
+	sort.Slice(report.Months, func(i, j int) bool { return report.Months[i].Month < report.Months[j].Month })
+	sort.Slice(report.Kinds, func(i, j int) bool { return report.Kinds[i].KindName < report.Kinds[j].KindName })
+	sort.Slice(report.Scopes, func(i, j int) bool { return report.Scopes[i].ScopeName < report.Scopes[j].ScopeName })
+	return report, nil
+}
+
+func (total *PracticePlanTotal) add(status string) {
+	total.Planned++
+	switch status {
+	case PracticePlanHeld:
+		total.Held++
+	case PracticePlanMoved:
+		total.Moved++
+	case PracticePlanCancelled:
+		total.Cancelled++
+	default:
+		total.Pending++
+	}
+}
+
+// PracticePlanInsert - create new practice plan
+func PracticePlanInsert(practicePlan PracticePlan) (int64, error) {
+	return PracticePlanInsertCtx(context.Background(), practicePlan)
+}
+
+// PracticePlanInsertCtx - PracticePlanInsert with context, actor of context is written to audit log
+func PracticePlanInsertCtx(ctx context.Context, practicePlan PracticePlan) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PracticePlanInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO practice_plans
+		(
+			company_id,
+			kind_id,
+			plan_date,
+			cancelled,
+			practice_id,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6,
+			$7,
+			$8
+		)
+		RETURNING
+			id
+	`, practicePlan.CompanyID, practicePlan.KindID, practicePlan.PlanDate, practicePlan.Cancelled, practicePlan.PracticeID,
+		practicePlan.Note, time.Now(), time.Now()).Scan(&practicePlan.ID)
+	if err != nil {
+		errmsg("PracticePlanInsert QueryRow", err)
+	}
+	return practicePlan.ID, err
+}
+
+// PracticePlanUpdate - save practice plan changes
+func PracticePlanUpdate(practicePlan PracticePlan) error {
+	return PracticePlanUpdateCtx(context.Background(), practicePlan)
+}
+
+// PracticePlanUpdateCtx - PracticePlanUpdate with context, actor of context is written to audit log
+func PracticePlanUpdateCtx(ctx context.Context, practicePlan PracticePlan) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PracticePlanUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		UPDATE practice_plans SET
+			company_id = $2,
+			kind_id = $3,
+			plan_date = $4,
+			cancelled = $5,
+			practice_id = $6,
+			note = $7,
+			updated_at = $8,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $9
+	`, practicePlan.ID, practicePlan.CompanyID, practicePlan.KindID, practicePlan.PlanDate, practicePlan.Cancelled,
+		practicePlan.PracticeID, practicePlan.Note, time.Now(), practicePlan.Version)
+	if err != nil {
+		errmsg("PracticePlanUpdate Exec", err)
+		return err
+	}
+	return versionCheck("practice_plans", practicePlan.ID, practicePlan.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return PracticePlanGet(practicePlan.ID)
+	})
+}
+
+// PracticePlanDelete - delete practice plan by id
+func PracticePlanDelete(id int64) error {
+	return PracticePlanDeleteCtx(context.Background(), id)
+}
+
+// PracticePlanDeleteCtx - PracticePlanDelete with context, actor of context is written to audit log
+func PracticePlanDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("PracticePlanDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			practice_plans
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("PracticePlanDelete Exec", err)
+	}
+	return err
+}
+
+func practicePlanCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			practice_plans (
+				id          bigserial PRIMARY KEY,
+				company_id  bigint,
+				kind_id     bigint,
+				plan_date   date,
+				cancelled   bool NOT NULL DEFAULT false,
+				practice_id bigint NOT NULL DEFAULT 0,
+				note        text,
+				version     bigint NOT NULL DEFAULT 0,
+				created_at  TIMESTAMP without time zone,
+				updated_at  TIMESTAMP without time zone default now()
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("practicePlanCreateTable exec", err)
+	}
+	return err
+}
@@ -0,0 +1,312 @@
+package edc
+
+import (
+	"context"
+	"time"
+)
+
+// RadioChannel - struct for radio channel used to trigger sirens
+type RadioChannel struct {
+	ID        int64  `sql:"id"         json:"id"        form:"id"        query:"id"`
+	Name      string `sql:"name"       json:"name"      form:"name"      query:"name"`
+	Frequency string `sql:"frequency"  json:"frequency" form:"frequency" query:"frequency"`
+	Note      string `sql:"note"       json:"note"      form:"note"      query:"note"`
+	Version   int64  `sql:"version"    json:"version"   form:"version"   query:"version"`
+	CreatedAt string `sql:"created_at" json:"-"`
+	UpdatedAt string `sql:"updated_at" json:"-"`
+}
+
+// RadioChannelList - struct for radio channel list
+type RadioChannelList struct {
+	ID        int64    `sql:"id"         json:"id"         form:"id"         query:"id"`
+	Name      string   `sql:"name"       json:"name"       form:"name"       query:"name"`
+	Frequency string   `sql:"frequency"  json:"frequency"  form:"frequency"  query:"frequency"`
+	DeskNames []string `sql:"desk_names" json:"desk_names" form:"desk_names" query:"desk_names" pg:",array"`
+	Note      string   `sql:"note"       json:"note"       form:"note"       query:"note"`
+}
+
+// RadioChannelSirens - struct for radio channel with sirens triggered by it
+type RadioChannelSirens struct {
+	ID     int64       `sql:"id"   json:"id"     form:"id"     query:"id"`
+	Name   string      `sql:"name" json:"name"   form:"name"   query:"name"`
+	Sirens []SirenList `sql:"-"    json:"sirens" form:"sirens" query:"sirens"`
+}
+
+// RadioChannelGet - get one radio channel by id
+func RadioChannelGet(id int64) (RadioChannel, error) {
+	var radioChannel RadioChannel
+	if id == 0 {
+		return radioChannel, nil
+	}
+	radioChannel.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			name,
+			frequency,
+			note,
+			version,
+			created_at,
+			updated_at
+		FROM
+			radio_channels
+		WHERE
+			id = $1
+	`, id).Scan(&radioChannel.Name, &radioChannel.Frequency, &radioChannel.Note, &radioChannel.Version, &radioChannel.CreatedAt, &radioChannel.UpdatedAt)
+	if err != nil {
+		errmsg("RadioChannelGet QueryRow", err)
+	}
+	return radioChannel, err
+}
+
+// RadioChannelListGet - get all radio channels for list
+func RadioChannelListGet() ([]RadioChannelList, error) {
+	var radioChannels []RadioChannelList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			r.id,
+			r.name,
+			r.frequency,
+			array_remove(array_agg(DISTINCT d.name), NULL) AS desk_names,
+			r.note
+		FROM
+			radio_channels AS r
+		LEFT JOIN
+			desk_radio_channels AS dr ON dr.radio_channel_id = r.id
+		LEFT JOIN
+			desks AS d ON d.id = dr.desk_id
+		GROUP BY
+			r.id
+		ORDER BY
+			r.name ASC
+	`)
+	if err != nil {
+		errmsg("RadioChannelListGet Query", err)
+		return radioChannels, err
+	}
+	for rows.Next() {
+		var radioChannel RadioChannelList
+		err := rows.Scan(&radioChannel.ID, &radioChannel.Name, &radioChannel.Frequency, &radioChannel.DeskNames, &radioChannel.Note)
+		if err != nil {
+			errmsg("RadioChannelListGet Scan", err)
+			return radioChannels, err
+		}
+		radioChannels = append(radioChannels, radioChannel)
+	}
+	return radioChannels, rows.Err()
+}
+
+// RadioChannelSelectGet - get all radio channels for select
+func RadioChannelSelectGet() ([]SelectItem, error) {
+	var radioChannels []SelectItem
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			name
+		FROM
+			radio_channels
+		ORDER BY
+			name ASC
+	`)
+	if err != nil {
+		errmsg("RadioChannelSelectGet Query", err)
+		return radioChannels, err
+	}
+	for rows.Next() {
+		var radioChannel SelectItem
+		err := rows.Scan(&radioChannel.ID, &radioChannel.Name)
+		if err != nil {
+			errmsg("RadioChannelSelectGet Scan", err)
+			return radioChannels, err
+		}
+		radioChannels = append(radioChannels, radioChannel)
+	}
+	return radioChannels, rows.Err()
+}
+
+// RadioChannelSirensGet - get all radio channels with sirens grouped for activation
+func RadioChannelSirensGet() ([]RadioChannelSirens, error) {
+	var radioChannels []RadioChannelSirens
+	channels, err := RadioChannelSelectGet()
+	if err != nil {
+		errmsg("RadioChannelSirensGet RadioChannelSelectGet", err)
+		return radioChannels, err
+	}
+	for i := range channels {
+		sirens, err := SirenRadioChannelGet(channels[i].ID)
+		if err != nil {
+			errmsg("RadioChannelSirensGet SirenRadioChannelGet", err)
+			return radioChannels, err
+		}
+		radioChannels = append(radioChannels, RadioChannelSirens{
+			ID:     channels[i].ID,
+			Name:   channels[i].Name,
+			Sirens: sirens,
+		})
+	}
+	return radioChannels, nil
+}
+
+// SirenRadioChannelGet - get all sirens triggered by radio channel
+func SirenRadioChannelGet(id int64) ([]SirenList, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	return sirenListQuery("SirenRadioChannelGet", `
+		SELECT
+			s.id,
+			s.address,
+			t.name AS siren_type_name,
+			c.name AS contact_name,
+			array_agg(DISTINCT ph.phone) AS phones
+		FROM
+			sirens AS s
+		LEFT JOIN
+			siren_types AS t ON s.siren_type_id = t.id
+		LEFT JOIN
+			contacts AS c ON s.contact_id = c.id
+		LEFT JOIN
+			phones AS ph ON s.contact_id = ph.contact_id AND ph.fax = false
+		WHERE
+			s.deleted_at IS NULL
+		AND
+			s.radio_channel_id = $1
+		GROUP BY
+			s.id,
+			t.id,
+			c.id
+		ORDER BY
+			s.address ASC
+	`, id)
+}
+
+// RadioChannelInsert - create new radio channel
+func RadioChannelInsert(radioChannel RadioChannel) (int64, error) {
+	return RadioChannelInsertCtx(context.Background(), radioChannel)
+}
+
+// RadioChannelInsertCtx - RadioChannelInsert with context, actor of context is written to audit log
+func RadioChannelInsertCtx(ctx context.Context, radioChannel RadioChannel) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("RadioChannelInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO radio_channels
+		(
+			name,
+			frequency,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5
+		)
+		RETURNING
+			id
+	`, radioChannel.Name, radioChannel.Frequency, radioChannel.Note, time.Now(), time.Now()).Scan(&radioChannel.ID)
+	if err != nil {
+		errmsg("RadioChannelInsert QueryRow", err)
+	}
+	return radioChannel.ID, err
+}
+
+// RadioChannelUpdate - save radio channel changes
+func RadioChannelUpdate(radioChannel RadioChannel) error {
+	return RadioChannelUpdateCtx(context.Background(), radioChannel)
+}
+
+// RadioChannelUpdateCtx - RadioChannelUpdate with context, actor of context is written to audit log
+func RadioChannelUpdateCtx(ctx context.Context, radioChannel RadioChannel) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("RadioChannelUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		UPDATE radio_channels SET
+			name = $2,
+			frequency = $3,
+			note = $4,
+			updated_at = $5,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $6
+	`, radioChannel.ID, radioChannel.Name, radioChannel.Frequency, radioChannel.Note, time.Now(), radioChannel.Version)
+	if err != nil {
+		errmsg("RadioChannelUpdate Exec", err)
+		return err
+	}
+	return versionCheck("radio_channels", radioChannel.ID, radioChannel.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return RadioChannelGet(radioChannel.ID)
+	})
+}
+
+// RadioChannelDelete - delete radio channel by id
+func RadioChannelDelete(id int64) error {
+	return RadioChannelDeleteCtx(context.Background(), id)
+}
+
+// RadioChannelDeleteCtx - RadioChannelDelete with context, actor of context is written to audit log
+func RadioChannelDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("RadioChannelDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			radio_channels
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("RadioChannelDelete Exec", err)
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			desk_radio_channels
+		WHERE
+			radio_channel_id = $1
+	`, id)
+	if err != nil {
+		errmsg("RadioChannelDelete desk_radio_channels Exec", err)
+	}
+	return err
+}
+
+func radioChannelCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			radio_channels (
+				id         bigserial PRIMARY KEY,
+				name       text,
+				frequency  text,
+				note       text,
+				version    bigint NOT NULL DEFAULT 0,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now(),
+				UNIQUE(name)
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("radioChannelCreateTable exec", err)
+	}
+	return err
+}
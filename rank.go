@@ -7,9 +7,10 @@ import (
 
 // Rank - struct for rank
 type Rank struct {
-	ID        int64  `sql:"id"         json:"id"   form:"id"   query:"id"`
-	Name      string `sql:"name"       json:"name" form:"name" query:"name"`
-	Note      string `sql:"note"       json:"note" form:"note" query:"note"`
+	ID        int64  `sql:"id"         json:"id"      form:"id"      query:"id"`
+	Name      string `sql:"name"       json:"name"    form:"name"    query:"name"`
+	Note      string `sql:"note"       json:"note"    form:"note"    query:"note"`
+	Version   int64  `sql:"version"    json:"version" form:"version" query:"version"`
 	CreatedAt string `sql:"created_at" json:"-"`
 	UpdatedAt string `sql:"updated_at" json:"-"`
 }
@@ -32,13 +33,14 @@ func RankGet(id int64) (Rank, error) {
 		SELECT
 			name,
 			note,
+			version,
 			created_at,
 			updated_at
 		FROM
 			ranks
 		WHERE
 			id = $1
-	`, id).Scan(&rank.Name, &rank.Note, &rank.CreatedAt, &rank.UpdatedAt)
+	`, id).Scan(&rank.Name, &rank.Note, &rank.Version, &rank.CreatedAt, &rank.UpdatedAt)
 	if err != nil {
 		errmsg("RankGet QueryRow", err)
 	}
@@ -102,7 +104,18 @@ func RankSelectGet() ([]SelectItem, error) {
 
 // RankInsert - create new rank
 func RankInsert(rank Rank) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return RankInsertCtx(context.Background(), rank)
+}
+
+// RankInsertCtx - RankInsert with context, actor of context is written to audit log
+func RankInsertCtx(ctx context.Context, rank Rank) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("RankInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO ranks
 		(
 			name,
@@ -128,26 +141,54 @@ func RankInsert(rank Rank) (int64, error) {
 
 // RankUpdate - save rank changes
 func RankUpdate(rank Rank) error {
-	_, err := pool.Exec(context.Background(), `
+	return RankUpdateCtx(context.Background(), rank)
+}
+
+// RankUpdateCtx - RankUpdate with context, actor of context is written to audit log
+func RankUpdateCtx(ctx context.Context, rank Rank) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("RankUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
 		UPDATE ranks SET
 			name = $2,
 			note = $3,
-			updated_at = $4
+			updated_at = $4,
+			version = version + 1
 		WHERE
 			id = $1
-	`, rank.ID, rank.Name, rank.Note, time.Now())
+		AND
+			version = $5
+	`, rank.ID, rank.Name, rank.Note, time.Now(), rank.Version)
 	if err != nil {
 		errmsg("UpdateRank update", err)
+		return err
 	}
-	return err
+	return versionCheck("ranks", rank.ID, rank.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return RankGet(rank.ID)
+	})
 }
 
 // RankDelete - delete rank by id
 func RankDelete(id int64) error {
+	return RankDeleteCtx(context.Background(), id)
+}
+
+// RankDeleteCtx - RankDelete with context, actor of context is written to audit log
+func RankDeleteCtx(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("RankDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			ranks
 		WHERE
@@ -166,6 +207,7 @@ func rankCreateTable() error {
 				id bigserial primary key,
 				name text,
 				note text,
+				version bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
 				UNIQUE (name)
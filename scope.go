@@ -6,9 +6,10 @@ import "time"
 
 // Scope - struct for scope
 type Scope struct {
-	ID        int64  `sql:"id"         json:"id"   form:"id"   query:"id"`
-	Name      string `sql:"name"       json:"name" form:"name" query:"name"`
-	Note      string `sql:"note"       json:"note" form:"note" query:"note"`
+	ID        int64  `sql:"id"         json:"id"      form:"id"      query:"id"`
+	Name      string `sql:"name"       json:"name"    form:"name"    query:"name"`
+	Note      string `sql:"note"       json:"note"    form:"note"    query:"note"`
+	Version   int64  `sql:"version"    json:"version" form:"version" query:"version"`
 	CreatedAt string `sql:"created_at" json:"-"`
 	UpdatedAt string `sql:"updated_at" json:"-"`
 }
@@ -31,6 +32,7 @@ func ScopeGet(id int64) (Scope, error) {
 		SELECT
 			name,
 			note,
+			version,
 			created_at,
 			updated_at
 		FROM
@@ -101,7 +103,18 @@ func ScopeSelectGet() ([]SelectItem, error) {
 
 // ScopeInsert - create new scope
 func ScopeInsert(scope Scope) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return ScopeInsertCtx(context.Background(), scope)
+}
+
+// ScopeInsertCtx - ScopeInsert with context, actor of context is written to audit log
+func ScopeInsertCtx(ctx context.Context, scope Scope) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("ScopeInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO scopes
 		(
 			name,
@@ -127,26 +140,54 @@ func ScopeInsert(scope Scope) (int64, error) {
 
 // ScopeUpdate - save scope changes
 func ScopeUpdate(scope Scope) error {
-	_, err := pool.Exec(context.Background(), `
+	return ScopeUpdateCtx(context.Background(), scope)
+}
+
+// ScopeUpdateCtx - ScopeUpdate with context, actor of context is written to audit log
+func ScopeUpdateCtx(ctx context.Context, scope Scope) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("ScopeUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
 		UPDATE scopes SET
 			name = $2,
 			note = $3,
-			updated_at = $4
+			updated_at = $4,
+			version = version + 1
 		WHERE
 			id = $1
-	`, scope.ID, scope.Name, scope.Note, time.Now())
+		AND
+			version = $5
+	`, scope.ID, scope.Name, scope.Note, time.Now(), scope.Version)
 	if err != nil {
 		errmsg("ScopeUpdate Exec", err)
+		return err
 	}
-	return err
+	return versionCheck("scopes", scope.ID, scope.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return ScopeGet(scope.ID)
+	})
 }
 
 // ScopeDelete - delete scope by id
 func ScopeDelete(id int64) error {
+	return ScopeDeleteCtx(context.Background(), id)
+}
+
+// ScopeDeleteCtx - ScopeDelete with context, actor of context is written to audit log
+func ScopeDeleteCtx(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("ScopeDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			scopes
 		WHERE
@@ -165,6 +206,7 @@ func scopeCreateTable() error {
 				id bigserial primary key,
 				name text,
 				note text,
+				version bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
 				UNIQUE (name)
@@ -0,0 +1,529 @@
+package edc
+
+import (
+	"context"
+	"time"
+)
+
+// GO role statuses
+const (
+	GORoleHeld     = "held"
+	GORoleVacant   = "vacant"
+	GORoleExternal = "external"
+)
+
+// ScopeGOPost - GO post required for companies of scope
+type ScopeGOPost struct {
+	ID        int64  `sql:"id"         json:"id"       form:"id"       query:"id"`
+	ScopeID   int64  `sql:"scope_id"   json:"scope_id" form:"scope_id" query:"scope_id"`
+	PostID    int64  `sql:"post_id"    json:"post_id"  form:"post_id"  query:"post_id"`
+	Note      string `sql:"note"       json:"note"     form:"note"     query:"note"`
+	Version   int64  `sql:"version"    json:"version"  form:"version"  query:"version"`
+	CreatedAt string `sql:"created_at" json:"-"`
+	UpdatedAt string `sql:"updated_at" json:"-"`
+}
+
+// ScopeGOPostList - struct for list of required GO posts
+type ScopeGOPostList struct {
+	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
+	ScopeID   int64  `sql:"scope_id"   json:"scope_id"   form:"scope_id"   query:"scope_id"`
+	ScopeName string `sql:"scope_name" json:"scope_name" form:"scope_name" query:"scope_name"`
+	PostID    int64  `sql:"post_id"    json:"post_id"    form:"post_id"    query:"post_id"`
+	PostName  string `sql:"post_name"  json:"post_name"  form:"post_name"  query:"post_name"`
+	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
+}
+
+// CompanyGORole - GO post of company held by contact of another company
+type CompanyGORole struct {
+	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
+	CompanyID int64  `sql:"company_id" json:"company_id" form:"company_id" query:"company_id"`
+	PostID    int64  `sql:"post_id"    json:"post_id"    form:"post_id"    query:"post_id"`
+	ContactID int64  `sql:"contact_id" json:"contact_id" form:"contact_id" query:"contact_id"`
+	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
+	CreatedAt string `sql:"created_at" json:"-"`
+	UpdatedAt string `sql:"updated_at" json:"-"`
+}
+
+// GOHolder - contact holding GO post
+// External - contact works in another company
+type GOHolder struct {
+	ContactID   int64   `json:"contact_id"   form:"contact_id"   query:"contact_id"`
+	ContactName string  `json:"contact_name" form:"contact_name" query:"contact_name"`
+	CompanyID   int64   `json:"company_id"   form:"company_id"   query:"company_id"`
+	CompanyName string  `json:"company_name" form:"company_name" query:"company_name"`
+	Phones      []int64 `json:"phones"       form:"phones"       query:"phones"`
+	External    bool    `json:"external"     form:"external"     query:"external"`
+}
+
+// GORole - required GO post of company with its holders
+// Status - held, vacant or external if all holders work in another company
+type GORole struct {
+	PostID   int64      `json:"post_id"   form:"post_id"   query:"post_id"`
+	PostName string     `json:"post_name" form:"post_name" query:"post_name"`
+	Status   string     `json:"status"    form:"status"    query:"status"`
+	Holders  []GOHolder `json:"holders"   form:"holders"   query:"holders"`
+}
+
+// GOCoverage - coverage of required GO posts of company
+type GOCoverage struct {
+	CompanyID   int64    `json:"company_id"   form:"company_id"   query:"company_id"`
+	CompanyName string   `json:"company_name" form:"company_name" query:"company_name"`
+	ScopeName   string   `json:"scope_name"   form:"scope_name"   query:"scope_name"`
+	Vacant      int64    `json:"vacant"       form:"vacant"       query:"vacant"`
+	External    int64    `json:"external"     form:"external"     query:"external"`
+	Roles       []GORole `json:"roles"        form:"roles"        query:"roles"`
+}
+
+// ScopeGOPostGet - get one required GO post by id
+func ScopeGOPostGet(id int64) (ScopeGOPost, error) {
+	var scopeGOPost ScopeGOPost
+	if id == 0 {
+		return scopeGOPost, nil
+	}
+	scopeGOPost.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			scope_id,
+			post_id,
+			note,
+			version,
+			created_at,
+			updated_at
+		FROM
+			scope_go_posts
+		WHERE
+			id = $1
+	`, id).Scan(&scopeGOPost.ScopeID, &scopeGOPost.PostID, &scopeGOPost.Note, &scopeGOPost.Version, &scopeGOPost.CreatedAt, &scopeGOPost.UpdatedAt)
+	if err != nil {
+		errmsg("ScopeGOPostGet QueryRow", err)
+	}
+	return scopeGOPost, err
+}
+
+// ScopeGOPostListGet - get all required GO posts for list
+func ScopeGOPostListGet() ([]ScopeGOPostList, error) {
+	var scopeGOPosts []ScopeGOPostList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			r.id,
+			r.scope_id,
+			COALESCE(s.name, '') AS scope_name,
+			r.post_id,
+			COALESCE(p.name, '') AS post_name,
+			r.note
+		FROM
+			scope_go_posts AS r
+		LEFT JOIN
+			scopes AS s ON s.id = r.scope_id
+		LEFT JOIN
+			posts AS p ON p.id = r.post_id
+		ORDER BY
+			scope_name ASC,
+			post_name ASC
+	`)
+	if err != nil {
+		errmsg("ScopeGOPostListGet Query", err)
+		return scopeGOPosts, err
+	}
+	for rows.Next() {
+		var scopeGOPost ScopeGOPostList
+		err := rows.Scan(&scopeGOPost.ID, &scopeGOPost.ScopeID, &scopeGOPost.ScopeName, &scopeGOPost.PostID, &scopeGOPost.PostName,
+			&scopeGOPost.Note)
+		if err != nil {
+			errmsg("ScopeGOPostListGet Scan", err)
+			return scopeGOPosts, err
+		}
+		scopeGOPosts = append(scopeGOPosts, scopeGOPost)
+	}
+	return scopeGOPosts, rows.Err()
+}
+
+// GOCoverageGet - get holders of required GO posts with phones, vacant posts and posts held by contacts
+// of another company, 0 for all companies
+func GOCoverageGet(companyID int64) ([]GOCoverage, error) {
+	var coverages []GOCoverage
+	rows, err := pool.Query(context.Background(), `
+		WITH required AS (
+			SELECT
+				c.id AS company_id,
+				c.name AS company_name,
+				COALESCE(s.name, '') AS scope_name,
+				r.post_id
+			FROM
+				companies AS c
+			INNER JOIN
+				scope_go_posts AS r ON r.scope_id = c.scope_id
+			LEFT JOIN
+				scopes AS s ON s.id = c.scope_id
+			WHERE
+				c.deleted_at IS NULL
+			AND
+				($1::bigint = 0 OR c.id = $1)
+		), holders AS (
+			SELECT
+				company_id,
+				post_go_id AS post_id,
+				id AS contact_id
+			FROM
+				contacts
+			WHERE
+				COALESCE(post_go_id, 0) <> 0
+			AND
+				deleted_at IS NULL
+			UNION
+			SELECT
+				company_id,
+				post_id,
+				contact_id
+			FROM
+				company_go_roles
+			WHERE
+				contact_id IN (SELECT id FROM contacts WHERE deleted_at IS NULL)
+		)
+		SELECT
+			r.company_id,
+			r.company_name,
+			r.scope_name,
+			r.post_id,
+			COALESCE(p.name, '') AS post_name,
+			COALESCE(h.contact_id, 0) AS contact_id,
+			COALESCE(ct.name, '') AS contact_name,
+			COALESCE(ct.company_id, 0) AS contact_company_id,
+			COALESCE(hc.name, '') AS contact_company_name,
+			array_remove(array_agg(DISTINCT ph.phone), NULL) AS phones
+		FROM
+			required AS r
+		LEFT JOIN
+			posts AS p ON p.id = r.post_id
+		LEFT JOIN
+			holders AS h ON h.company_id = r.company_id AND h.post_id = r.post_id
+		LEFT JOIN
+			contacts AS ct ON ct.id = h.contact_id
+		LEFT JOIN
+			companies AS hc ON hc.id = ct.company_id
+		LEFT JOIN
+			phones AS ph ON ph.contact_id = ct.id AND ph.fax = false
+		GROUP BY
+			r.company_id,
+			r.company_name,
+			r.scope_name,
+			r.post_id,
+			p.name,
+			h.contact_id,
+			ct.name,
+			ct.company_id,
+			hc.name
+		ORDER BY
+			r.company_name ASC,
+			r.company_id ASC,
+			post_name ASC,
+			r.post_id ASC,
+			contact_name ASC
+	`, companyID)
+	if err != nil {
+		errmsg("GOCoverageGet Query", err)
+		return coverages, err
+	}
+	for rows.Next() {
+		var (
+			coverage GOCoverage
+			role     GORole
+			holder   GOHolder
+		)
+		err := rows.Scan(&coverage.CompanyID, &coverage.CompanyName, &coverage.ScopeName, &role.PostID, &role.PostName,
+			&holder.ContactID, &holder.ContactName, &holder.CompanyID, &holder.CompanyName, &holder.Phones)
+		if err != nil {
+			errmsg("GOCoverageGet Scan", err)
+			return coverages, err
+		}
+		if len(coverages) == 0 || coverages[len(coverages)-1].CompanyID != coverage.CompanyID {
+			coverages = append(coverages, coverage)
+		}
+		company := &coverages[len(coverages)-1]
+		if len(company.Roles) == 0 || company.Roles[len(company.Roles)-1].PostID != role.PostID {
+			company.Roles = append(company.Roles, role)
+		}
+		last := &company.Roles[len(company.Roles)-1]
+		if holder.ContactID != 0 {
+			holder.External = holder.CompanyID != company.CompanyID
+			last.Holders = append(last.Holders, holder)
+		}
+	}
+	if rows.Err() != nil {
+		errmsg("GOCoverageGet rows", rows.Err())
+		return coverages, rows.Err()
+	}
+	for i := range coverages {
+		for j := range coverages[i].Roles {
+			role := &coverages[i].Roles[j]
+			role.Status = goRoleStatus(role.Holders)
+			switch role.Status {
+			case GORoleVacant:
+				coverages[i].Vacant++
+			case GORoleExternal:
+				coverages[i].External++
+			}
+		}
+	}
+	return coverages, nil
+}
+
+func goRoleStatus(holders []GOHolder) string {
+	if len(holders) == 0 {
+		return GORoleVacant
+	}
+	for _, holder := range holders {
+		if !holder.External {
+			return GORoleHeld
+		}
+	}
+	return GORoleExternal
+}
+
+// ScopeGOPostInsert - create new required GO post
+func ScopeGOPostInsert(scopeGOPost ScopeGOPost) (int64, error) {
+	return ScopeGOPostInsertCtx(context.Background(), scopeGOPost)
+}
+
+// ScopeGOPostInsertCtx - ScopeGOPostInsert with context, actor of context is written to audit log
+func ScopeGOPostInsertCtx(ctx context.Context, scopeGOPost ScopeGOPost) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("ScopeGOPostInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO scope_go_posts
+		(
+			scope_id,
+			post_id,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5
+		)
+		RETURNING
+			id
+	`, scopeGOPost.ScopeID, scopeGOPost.PostID, scopeGOPost.Note, time.Now(), time.Now()).Scan(&scopeGOPost.ID)
+	if err != nil {
+		errmsg("ScopeGOPostInsert QueryRow", err)
+	}
+	return scopeGOPost.ID, err
+}
+
+// ScopeGOPostUpdate - save required GO post changes
+func ScopeGOPostUpdate(scopeGOPost ScopeGOPost) error {
+	return ScopeGOPostUpdateCtx(context.Background(), scopeGOPost)
+}
+
+// ScopeGOPostUpdateCtx - ScopeGOPostUpdate with context, actor of context is written to audit log
+func ScopeGOPostUpdateCtx(ctx context.Context, scopeGOPost ScopeGOPost) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("ScopeGOPostUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		UPDATE scope_go_posts SET
+			scope_id = $2,
+			post_id = $3,
+			note = $4,
+			updated_at = $5,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $6
+	`, scopeGOPost.ID, scopeGOPost.ScopeID, scopeGOPost.PostID, scopeGOPost.Note, time.Now(), scopeGOPost.Version)
+	if err != nil {
+		errmsg("ScopeGOPostUpdate Exec", err)
+		return err
+	}
+	return versionCheck("scope_go_posts", scopeGOPost.ID, scopeGOPost.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return ScopeGOPostGet(scopeGOPost.ID)
+	})
+}
+
+// ScopeGOPostDelete - delete required GO post by id
+func ScopeGOPostDelete(id int64) error {
+	return ScopeGOPostDeleteCtx(context.Background(), id)
+}
+
+// ScopeGOPostDeleteCtx - ScopeGOPostDelete with context, actor of context is written to audit log
+func ScopeGOPostDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("ScopeGOPostDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			scope_go_posts
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("ScopeGOPostDelete Exec", err)
+	}
+	return err
+}
+
+// CompanyGORoleGet - get GO posts of company held by contacts of another company
+func CompanyGORoleGet(id int64) ([]CompanyGORole, error) {
+	var roles []CompanyGORole
+	if id == 0 {
+		return roles, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			id,
+			company_id,
+			post_id,
+			contact_id,
+			note
+		FROM
+			company_go_roles
+		WHERE
+			company_id = $1
+		ORDER BY
+			id ASC
+	`, id)
+	if err != nil {
+		errmsg("CompanyGORoleGet Query", err)
+		return roles, err
+	}
+	for rows.Next() {
+		var role CompanyGORole
+		err := rows.Scan(&role.ID, &role.CompanyID, &role.PostID, &role.ContactID, &role.Note)
+		if err != nil {
+			errmsg("CompanyGORoleGet Scan", err)
+			return roles, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// CompanyGORoleInsert - assign GO post of company to contact of another company
+func CompanyGORoleInsert(role CompanyGORole) (int64, error) {
+	return CompanyGORoleInsertCtx(context.Background(), role)
+}
+
+// CompanyGORoleInsertCtx - CompanyGORoleInsert with context, actor of context is written to audit log
+func CompanyGORoleInsertCtx(ctx context.Context, role CompanyGORole) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CompanyGORoleInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO company_go_roles
+		(
+			company_id,
+			post_id,
+			contact_id,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6
+		)
+		RETURNING
+			id
+	`, role.CompanyID, role.PostID, role.ContactID, role.Note, time.Now(), time.Now()).Scan(&role.ID)
+	if err != nil {
+		errmsg("CompanyGORoleInsert QueryRow", err)
+	}
+	return role.ID, err
+}
+
+// CompanyGORoleDelete - delete assignment of GO post by id
+func CompanyGORoleDelete(id int64) error {
+	return CompanyGORoleDeleteCtx(context.Background(), id)
+}
+
+// CompanyGORoleDeleteCtx - CompanyGORoleDelete with context, actor of context is written to audit log
+func CompanyGORoleDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("CompanyGORoleDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			company_go_roles
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("CompanyGORoleDelete Exec", err)
+	}
+	return err
+}
+
+func scopeGOPostCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			scope_go_posts (
+				id         bigserial PRIMARY KEY,
+				scope_id   bigint,
+				post_id    bigint,
+				note       text,
+				version    bigint NOT NULL DEFAULT 0,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now(),
+				UNIQUE(scope_id, post_id)
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("scopeGOPostCreateTable exec", err)
+	}
+	return err
+}
+
+func companyGORoleCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			company_go_roles (
+				id         bigserial PRIMARY KEY,
+				company_id bigint,
+				post_id    bigint,
+				contact_id bigint,
+				note       text,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now(),
+				UNIQUE(company_id, post_id, contact_id)
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("companyGORoleCreateTable exec", err)
+	}
+	return err
+}
@@ -6,23 +6,28 @@ import (
 )
 
 // Siren - struct for siren
+// Stage - activation queue (очередь оповещения) of siren in warning plan
 type Siren struct {
-	ID          int64  `sql:"id"            json:"id"            form:"id"            query:"id"`
-	NumID       int64  `sql:"num_id"        json:"num_id"        form:"num_id"        query:"num_id"`
-	NumPass     string `sql:"num_pass"      json:"num_pass"      form:"num_pass"      query:"num_pass"`
-	SirenTypeID int64  `sql:"siren_type_id" json:"siren_type_id" form:"siren_type_id" query:"siren_type_id"`
-	Address     string `sql:"address"       json:"address"       form:"address"       query:"address"`
-	Radio       string `sql:"radio"         json:"radio"         form:"radio"         query:"radio"`
-	Desk        string `sql:"desk"          json:"desk"          form:"desk"          query:"desk"`
-	ContactID   int64  `sql:"contact_id"    json:"contact_id"    form:"contact_id"    query:"contact_id"`
-	CompanyID   int64  `sql:"company_id"    json:"company_id"    form:"company_id"    query:"company_id"`
-	Latitude    string `sql:"latitude"      json:"latitude"      form:"latitude"      query:"latitude"`
-	Longitude   string `sql:"longitude"     json:"longitude"     form:"longitude"     query:"longitude"`
-	Stage       int64  `sql:"stage"         json:"stage"         form:"stage"         query:"stage"`
-	Own         string `sql:"own"           json:"own"           form:"own"           query:"own"`
-	Note        string `sql:"note"          json:"note"          form:"note"          query:"note"`
-	CreatedAt   string `sql:"created_at"    json:"-"`
-	UpdatedAt   string `sql:"updated_at"    json:"-"`
+	ID             int64  `sql:"id"               json:"id"               form:"id"               query:"id"`
+	NumID          int64  `sql:"num_id"           json:"num_id"           form:"num_id"           query:"num_id"`
+	NumPass        string `sql:"num_pass"         json:"num_pass"         form:"num_pass"         query:"num_pass"`
+	SirenTypeID    int64  `sql:"siren_type_id"    json:"siren_type_id"    form:"siren_type_id"    query:"siren_type_id"`
+	Address        string `sql:"address"          json:"address"          form:"address"          query:"address"`
+	AddressID      int64  `sql:"address_id"       json:"address_id"       form:"address_id"       query:"address_id"`
+	Radio          string `sql:"radio"            json:"radio"            form:"radio"            query:"radio"`
+	Desk           string `sql:"desk"             json:"desk"             form:"desk"             query:"desk"`
+	RadioChannelID int64  `sql:"radio_channel_id" json:"radio_channel_id" form:"radio_channel_id" query:"radio_channel_id"`
+	DeskID         int64  `sql:"desk_id"          json:"desk_id"          form:"desk_id"          query:"desk_id"`
+	ContactID      int64  `sql:"contact_id"       json:"contact_id"       form:"contact_id"       query:"contact_id"`
+	CompanyID      int64  `sql:"company_id"       json:"company_id"       form:"company_id"       query:"company_id"`
+	Latitude       string `sql:"latitude"         json:"latitude"         form:"latitude"         query:"latitude"`
+	Longitude      string `sql:"longitude"        json:"longitude"        form:"longitude"        query:"longitude"`
+	Stage          int64  `sql:"stage"            json:"stage"            form:"stage"            query:"stage"`
+	Own            string `sql:"own"              json:"own"              form:"own"              query:"own"`
+	Note           string `sql:"note"             json:"note"             form:"note"             query:"note"`
+	Version        int64  `sql:"version"          json:"version"          form:"version"          query:"version"`
+	CreatedAt      string `sql:"created_at"       json:"-"`
+	UpdatedAt      string `sql:"updated_at"       json:"-"`
 }
 
 // SirenList - struct for siren list
@@ -56,6 +61,10 @@ func SirenGet(id int64) (Siren, error) {
 			stage,
 			own,
 			note,
+			radio_channel_id,
+			desk_id,
+			address_id,
+			version,
 			created_at,
 			updated_at
 		FROM
@@ -63,7 +72,8 @@ func SirenGet(id int64) (Siren, error) {
 		WHERE
 			id = $1
 	`, id).Scan(&siren.NumID, &siren.NumPass, &siren.SirenTypeID, &siren.Address, &siren.Radio, &siren.Desk, &siren.ContactID, &siren.CompanyID,
-		&siren.Latitude, &siren.Longitude, &siren.Stage, &siren.Own, &siren.Note, &siren.CreatedAt, &siren.UpdatedAt)
+		&siren.Latitude, &siren.Longitude, &siren.Stage, &siren.Own, &siren.Note, &siren.RadioChannelID, &siren.DeskID, &siren.AddressID,
+		&siren.Version, &siren.CreatedAt, &siren.UpdatedAt)
 	if err != nil {
 		errmsg("SirenGet QueryRow", err)
 	}
@@ -88,6 +98,8 @@ func SirenListGet() ([]SirenList, error) {
 			contacts AS c ON s.contact_id = c.id
 		LEFT JOIN
 			phones AS ph ON s.contact_id = ph.contact_id AND ph.fax = false
+		WHERE
+			s.deleted_at IS NULL
 		GROUP BY
 			s.id,
 			t.id,
@@ -110,9 +122,45 @@ func SirenListGet() ([]SirenList, error) {
 	return sirens, rows.Err()
 }
 
+// sirenListQuery - get sirens for list by query returning SirenList columns
+func sirenListQuery(name, query string, args ...interface{}) ([]SirenList, error) {
+	var sirens []SirenList
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		errmsg(name+" Query", err)
+		return sirens, err
+	}
+	for rows.Next() {
+		var siren SirenList
+		err := rows.Scan(&siren.ID, &siren.Address, &siren.SirenTypeName, &siren.ContactName, &siren.Phones)
+		if err != nil {
+			errmsg(name+" Scan", err)
+			return sirens, err
+		}
+		sirens = append(sirens, siren)
+	}
+	return sirens, rows.Err()
+}
+
 // SirenInsert - create new siren
 func SirenInsert(siren Siren) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return SirenInsertCtx(context.Background(), siren)
+}
+
+// SirenInsertCtx - SirenInsert with context, actor of context is written to audit log
+func SirenInsertCtx(ctx context.Context, siren Siren) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("SirenInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	siren.AddressID, err = addressResolve(ctx, tx, "sirens", 0, siren.Address)
+	if err != nil {
+		errmsg("SirenInsert addressResolve", err)
+		return 0, err
+	}
+	err = tx.QueryRow(ctx, `
 		INSERT INTO sirens
 		(
 			num_id,
@@ -128,6 +176,9 @@ func SirenInsert(siren Siren) (int64, error) {
 			stage,
 			own,
 			note,
+			radio_channel_id,
+			desk_id,
+			address_id,
 			created_at,
 			updated_at
 		)
@@ -147,12 +198,16 @@ func SirenInsert(siren Siren) (int64, error) {
 			$12,
 			$13,
 			$14,
-			$15
+			$15,
+			$16,
+			$17,
+			$18
 		)
 		RETURNING
 			id
 	`, siren.NumID, siren.NumPass, siren.SirenTypeID, siren.Address, siren.Radio, siren.Desk, siren.ContactID, siren.CompanyID,
-		siren.Latitude, siren.Longitude, siren.Stage, siren.Own, siren.Note, time.Now(), time.Now()).Scan(&siren.ID)
+		siren.Latitude, siren.Longitude, siren.Stage, siren.Own, siren.Note, siren.RadioChannelID, siren.DeskID, siren.AddressID,
+		time.Now(), time.Now()).Scan(&siren.ID)
 	if err != nil {
 		errmsg("SirenInsert QueryRow", err)
 	}
@@ -161,7 +216,18 @@ func SirenInsert(siren Siren) (int64, error) {
 
 // SirenUpdate - save siren changes
 func SirenUpdate(siren Siren) error {
-	_, err := pool.Exec(context.Background(), `
+	return SirenUpdateCtx(context.Background(), siren)
+}
+
+// SirenUpdateCtx - SirenUpdate with context, actor of context is written to audit log
+func SirenUpdateCtx(ctx context.Context, siren Siren) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("SirenUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
 		UPDATE sirens SET
 			num_id = $2,
 			num_pass = $3,
@@ -176,23 +242,56 @@ func SirenUpdate(siren Siren) error {
 			stage = $12,
 			own = $13,
 			note = $14,
-			updated_at = $15
+			radio_channel_id = $15,
+			desk_id = $16,
+			address_id = CASE WHEN address IS NOT DISTINCT FROM $5 THEN address_id ELSE 0 END,
+			updated_at = $17,
+			version = version + 1
 		WHERE
 			id = $1
+		AND
+			version = $18
 	`, siren.ID, siren.NumID, siren.NumPass, siren.SirenTypeID, siren.Address, siren.Radio, siren.Desk, siren.ContactID, siren.CompanyID,
-		siren.Latitude, siren.Longitude, siren.Stage, siren.Own, siren.Note, time.Now())
+		siren.Latitude, siren.Longitude, siren.Stage, siren.Own, siren.Note, siren.RadioChannelID, siren.DeskID, time.Now(), siren.Version)
 	if err != nil {
 		errmsg("SirenUpdate Exec", err)
+		return err
+	}
+	err = versionCheck("sirens", siren.ID, siren.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return SirenGet(siren.ID)
+	})
+	if err != nil {
+		return err
+	}
+	err = addressLink(ctx, tx, "sirens", siren.ID, siren.Address)
+	if err != nil {
+		errmsg("SirenUpdate addressLink", err)
 	}
 	return err
 }
 
-// SirenDelete - delete siren by id
+// SirenDelete - move siren to trash
 func SirenDelete(id int64) error {
+	return SirenDeleteCtx(context.Background(), id)
+}
+
+// SirenDeleteCtx - SirenDelete with context, actor of context is written to audit log
+func SirenDeleteCtx(ctx context.Context, id int64) error {
+	return trashDelete(ctx, "sirens", id)
+}
+
+// sirenPurge - delete siren by id with child rows
+func sirenPurge(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("sirenPurge auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			sirens
 		WHERE
@@ -213,6 +312,7 @@ func sirenCreateTable() error {
 				num_pass   text,
 				type_id    bigint,
 				address    text,
+				address_id bigint NOT NULL DEFAULT 0,
 				radio      text,
 				desk       text,
 				contact_id bigint,
@@ -222,6 +322,10 @@ func sirenCreateTable() error {
 				stage      bigint,
 				own        text,
 				note        text,
+				radio_channel_id bigint,
+				desk_id    bigint,
+				deleted_at TIMESTAMP without time zone,
+				version    bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
 				UNIQUE(num_id, num_pass, type_id)
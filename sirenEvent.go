@@ -0,0 +1,448 @@
+package edc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Siren event types
+const (
+	SirenEventCheck       = "check"
+	SirenEventFailure     = "failure"
+	SirenEventRepair      = "repair"
+	SirenEventReplacement = "replacement"
+)
+
+// ErrSirenEventType - event type is not one of siren event types
+var ErrSirenEventType = errors.New("unknown siren event type")
+
+// SirenEvent - struct for siren journal event
+// Result - true if siren is in working order after event
+type SirenEvent struct {
+	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
+	SirenID   int64  `sql:"siren_id"   json:"siren_id"   form:"siren_id"   query:"siren_id"`
+	EventDate string `sql:"event_date" json:"event_date" form:"event_date" query:"event_date"`
+	EventType string `sql:"event_type" json:"event_type" form:"event_type" query:"event_type"`
+	Result    bool   `sql:"result"     json:"result"     form:"result"     query:"result"`
+	ContactID int64  `sql:"contact_id" json:"contact_id" form:"contact_id" query:"contact_id"`
+	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
+	Version   int64  `sql:"version"    json:"version"    form:"version"    query:"version"`
+	CreatedAt string `sql:"created_at" json:"-"`
+	UpdatedAt string `sql:"updated_at" json:"-"`
+}
+
+// SirenEventList - struct for siren event list
+type SirenEventList struct {
+	ID           int64  `sql:"id"            json:"id"            form:"id"            query:"id"`
+	SirenID      int64  `sql:"siren_id"      json:"siren_id"      form:"siren_id"      query:"siren_id"`
+	SirenAddress string `sql:"siren_address" json:"siren_address" form:"siren_address" query:"siren_address"`
+	EventDate    string `sql:"event_date"    json:"event_date"    form:"event_date"    query:"event_date"`
+	EventType    string `sql:"event_type"    json:"event_type"    form:"event_type"    query:"event_type"`
+	Result       bool   `sql:"result"        json:"result"        form:"result"        query:"result"`
+	ContactID    int64  `sql:"contact_id"    json:"contact_id"    form:"contact_id"    query:"contact_id"`
+	ContactName  string `sql:"contact_name"  json:"contact_name"  form:"contact_name"  query:"contact_name"`
+	Note         string `sql:"note"          json:"note"          form:"note"          query:"note"`
+}
+
+// sirenEventTypeCheck - check event type is one of siren event types
+func sirenEventTypeCheck(eventType string) error {
+	switch eventType {
+	case SirenEventCheck, SirenEventFailure, SirenEventRepair, SirenEventReplacement:
+		return nil
+	}
+	return ErrSirenEventType
+}
+
+// SirenEventGet - get one siren event by id
+func SirenEventGet(id int64) (SirenEvent, error) {
+	var sirenEvent SirenEvent
+	if id == 0 {
+		return sirenEvent, nil
+	}
+	sirenEvent.ID = id
+	err := pool.QueryRow(context.Background(), `
+		SELECT
+			siren_id,
+			event_date,
+			event_type,
+			result,
+			contact_id,
+			note,
+			version,
+			created_at,
+			updated_at
+		FROM
+			siren_events
+		WHERE
+			id = $1
+	`, id).Scan(&sirenEvent.SirenID, &sirenEvent.EventDate, &sirenEvent.EventType, &sirenEvent.Result, &sirenEvent.ContactID,
+		&sirenEvent.Note, &sirenEvent.Version, &sirenEvent.CreatedAt, &sirenEvent.UpdatedAt)
+	if err != nil {
+		errmsg("SirenEventGet QueryRow", err)
+	}
+	return sirenEvent, err
+}
+
+// SirenEventListGet - get all siren events for list
+func SirenEventListGet() ([]SirenEventList, error) {
+	var sirenEvents []SirenEventList
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			e.id,
+			e.siren_id,
+			s.address AS siren_address,
+			e.event_date,
+			e.event_type,
+			e.result,
+			e.contact_id,
+			c.name AS contact_name,
+			e.note
+		FROM
+			siren_events AS e
+		LEFT JOIN
+			sirens AS s ON s.id = e.siren_id
+		LEFT JOIN
+			contacts AS c ON c.id = e.contact_id
+		WHERE
+			s.deleted_at IS NULL
+		ORDER BY
+			e.event_date DESC
+	`)
+	if err != nil {
+		errmsg("SirenEventListGet Query", err)
+		return sirenEvents, err
+	}
+	for rows.Next() {
+		var sirenEvent SirenEventList
+		err := rows.Scan(&sirenEvent.ID, &sirenEvent.SirenID, &sirenEvent.SirenAddress, &sirenEvent.EventDate, &sirenEvent.EventType,
+			&sirenEvent.Result, &sirenEvent.ContactID, &sirenEvent.ContactName, &sirenEvent.Note)
+		if err != nil {
+			errmsg("SirenEventListGet Scan", err)
+			return sirenEvents, err
+		}
+		sirenEvents = append(sirenEvents, sirenEvent)
+	}
+	return sirenEvents, rows.Err()
+}
+
+// SirenEventSirenGet - get history of siren events by siren id
+func SirenEventSirenGet(id int64) ([]SirenEventList, error) {
+	var sirenEvents []SirenEventList
+	if id == 0 {
+		return sirenEvents, nil
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			e.id,
+			e.siren_id,
+			s.address AS siren_address,
+			e.event_date,
+			e.event_type,
+			e.result,
+			e.contact_id,
+			c.name AS contact_name,
+			e.note
+		FROM
+			siren_events AS e
+		LEFT JOIN
+			sirens AS s ON s.id = e.siren_id
+		LEFT JOIN
+			contacts AS c ON c.id = e.contact_id
+		WHERE
+			e.siren_id = $1
+		ORDER BY
+			e.event_date DESC,
+			e.id DESC
+	`, id)
+	if err != nil {
+		errmsg("SirenEventSirenGet Query", err)
+		return sirenEvents, err
+	}
+	for rows.Next() {
+		var sirenEvent SirenEventList
+		err := rows.Scan(&sirenEvent.ID, &sirenEvent.SirenID, &sirenEvent.SirenAddress, &sirenEvent.EventDate, &sirenEvent.EventType,
+			&sirenEvent.Result, &sirenEvent.ContactID, &sirenEvent.ContactName, &sirenEvent.Note)
+		if err != nil {
+			errmsg("SirenEventSirenGet Scan", err)
+			return sirenEvents, err
+		}
+		sirenEvents = append(sirenEvents, sirenEvent)
+	}
+	return sirenEvents, rows.Err()
+}
+
+// SirenFailedGet - get all sirens failed at last check
+func SirenFailedGet() ([]SirenList, error) {
+	return sirenListQuery("SirenFailedGet", `
+		SELECT
+			s.id,
+			s.address,
+			t.name AS siren_type_name,
+			c.name AS contact_name,
+			array_agg(DISTINCT ph.phone) AS phones
+		FROM
+			sirens AS s
+		INNER JOIN (
+			SELECT DISTINCT ON (siren_id)
+				siren_id,
+				result
+			FROM
+				siren_events
+			WHERE
+				event_type = $1
+			ORDER BY
+				siren_id,
+				event_date DESC,
+				id DESC
+		) AS e ON e.siren_id = s.id AND e.result = false
+		LEFT JOIN
+			siren_types AS t ON s.siren_type_id = t.id
+		LEFT JOIN
+			contacts AS c ON s.contact_id = c.id
+		LEFT JOIN
+			phones AS ph ON s.contact_id = ph.contact_id AND ph.fax = false
+		WHERE
+			s.deleted_at IS NULL
+		GROUP BY
+			s.id,
+			t.id,
+			c.id
+		ORDER BY
+			s.address ASC
+	`, SirenEventCheck)
+}
+
+// SirenAvailabilityGet - get percentage of time the siren was in working order
+// between start and end dates (format 2006-01-02). Siren state is taken from
+// the last event before start, siren is considered working without events.
+func SirenAvailabilityGet(id int64, start, end string) (float64, error) {
+	if id == 0 {
+		return 0, nil
+	}
+	startDate, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		errmsg("SirenAvailabilityGet Parse start", err)
+		return 0, err
+	}
+	endDate, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		errmsg("SirenAvailabilityGet Parse end", err)
+		return 0, err
+	}
+	if !endDate.After(startDate) {
+		return 0, nil
+	}
+	working := true
+	err = pool.QueryRow(context.Background(), `
+		SELECT
+			result
+		FROM
+			siren_events
+		WHERE
+			siren_id = $1
+		AND
+			event_date < $2
+		ORDER BY
+			event_date DESC,
+			id DESC
+		LIMIT 1
+	`, id, startDate).Scan(&working)
+	if err != nil && err != pgx.ErrNoRows {
+		errmsg("SirenAvailabilityGet QueryRow", err)
+		return 0, err
+	}
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			event_date,
+			result
+		FROM
+			siren_events
+		WHERE
+			siren_id = $1
+		AND
+			event_date >= $2
+		AND
+			event_date < $3
+		ORDER BY
+			event_date ASC,
+			id ASC
+	`, id, startDate, endDate)
+	if err != nil {
+		errmsg("SirenAvailabilityGet Query", err)
+		return 0, err
+	}
+	var up time.Duration
+	last := startDate
+	for rows.Next() {
+		var (
+			date   time.Time
+			result bool
+		)
+		err := rows.Scan(&date, &result)
+		if err != nil {
+			errmsg("SirenAvailabilityGet Scan", err)
+			return 0, err
+		}
+		if working {
+			up += date.Sub(last)
+		}
+		last = date
+		working = result
+	}
+	if err := rows.Err(); err != nil {
+		errmsg("SirenAvailabilityGet Rows", err)
+		return 0, err
+	}
+	if working {
+		up += endDate.Sub(last)
+	}
+	return float64(up) * 100 / float64(endDate.Sub(startDate)), nil
+}
+
+// SirenEventInsert - create new siren event
+func SirenEventInsert(sirenEvent SirenEvent) (int64, error) {
+	return SirenEventInsertCtx(context.Background(), sirenEvent)
+}
+
+// SirenEventInsertCtx - SirenEventInsert with context, actor of context is written to audit log
+func SirenEventInsertCtx(ctx context.Context, sirenEvent SirenEvent) (_ int64, err error) {
+	err = sirenEventTypeCheck(sirenEvent.EventType)
+	if err != nil {
+		errmsg("SirenEventInsert sirenEventTypeCheck", err)
+		return
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("SirenEventInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO siren_events
+		(
+			siren_id,
+			event_date,
+			event_type,
+			result,
+			contact_id,
+			note,
+			created_at,
+			updated_at
+		)
+		VALUES
+		(
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6,
+			$7,
+			$8
+		)
+		RETURNING
+			id
+	`, sirenEvent.SirenID, sirenEvent.EventDate, sirenEvent.EventType, sirenEvent.Result, sirenEvent.ContactID,
+		sirenEvent.Note, time.Now(), time.Now()).Scan(&sirenEvent.ID)
+	if err != nil {
+		errmsg("SirenEventInsert QueryRow", err)
+	}
+	return sirenEvent.ID, err
+}
+
+// SirenEventUpdate - save siren event changes
+func SirenEventUpdate(sirenEvent SirenEvent) error {
+	return SirenEventUpdateCtx(context.Background(), sirenEvent)
+}
+
+// SirenEventUpdateCtx - SirenEventUpdate with context, actor of context is written to audit log
+func SirenEventUpdateCtx(ctx context.Context, sirenEvent SirenEvent) (err error) {
+	err = sirenEventTypeCheck(sirenEvent.EventType)
+	if err != nil {
+		errmsg("SirenEventUpdate sirenEventTypeCheck", err)
+		return
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("SirenEventUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
+		UPDATE siren_events SET
+			siren_id = $2,
+			event_date = $3,
+			event_type = $4,
+			result = $5,
+			contact_id = $6,
+			note = $7,
+			updated_at = $8,
+			version = version + 1
+		WHERE
+			id = $1
+		AND
+			version = $9
+	`, sirenEvent.ID, sirenEvent.SirenID, sirenEvent.EventDate, sirenEvent.EventType, sirenEvent.Result, sirenEvent.ContactID,
+		sirenEvent.Note, time.Now(), sirenEvent.Version)
+	if err != nil {
+		errmsg("SirenEventUpdate Exec", err)
+		return err
+	}
+	return versionCheck("siren_events", sirenEvent.ID, sirenEvent.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return SirenEventGet(sirenEvent.ID)
+	})
+}
+
+// SirenEventDelete - delete siren event by id
+func SirenEventDelete(id int64) error {
+	return SirenEventDeleteCtx(context.Background(), id)
+}
+
+// SirenEventDeleteCtx - SirenEventDelete with context, actor of context is written to audit log
+func SirenEventDeleteCtx(ctx context.Context, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("SirenEventDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		DELETE FROM
+			siren_events
+		WHERE
+			id = $1
+	`, id)
+	if err != nil {
+		errmsg("SirenEventDelete Exec", err)
+	}
+	return err
+}
+
+func sirenEventCreateTable() error {
+	str := `
+		CREATE TABLE IF NOT EXISTS
+			siren_events (
+				id         bigserial PRIMARY KEY,
+				siren_id   bigint,
+				event_date date,
+				event_type text,
+				result     bool NOT NULL DEFAULT true,
+				contact_id bigint,
+				note       text,
+				version    bigint NOT NULL DEFAULT 0,
+				created_at TIMESTAMP without time zone,
+				updated_at TIMESTAMP without time zone default now()
+			)
+	`
+	_, err := pool.Exec(context.Background(), str)
+	if err != nil {
+		errmsg("sirenEventCreateTable exec", err)
+	}
+	return err
+}
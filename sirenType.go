@@ -7,10 +7,11 @@ import (
 
 // SirenType - struct for sirenType
 type SirenType struct {
-	ID        int64  `sql:"id"         json:"id"            form:"id"     query:"id"`
-	Name      string `sql:"name"       json:"name"          form:"name"   query:"name"`
-	Radius    int64  `sql:"radius"     json:"radius,string" form:"radius" query:"radius"`
-	Note      string `sql:"note"       json:"note"          form:"note"   query:"note"`
+	ID        int64  `sql:"id"         json:"id"            form:"id"      query:"id"`
+	Name      string `sql:"name"       json:"name"          form:"name"    query:"name"`
+	Radius    int64  `sql:"radius"     json:"radius,string" form:"radius"  query:"radius"`
+	Note      string `sql:"note"       json:"note"          form:"note"    query:"note"`
+	Version   int64  `sql:"version"    json:"version"       form:"version" query:"version"`
 	CreatedAt string `sql:"created_at" json:"-"`
 	UpdatedAt string `sql:"updated_at" json:"-"`
 }
@@ -35,13 +36,14 @@ func SirenTypeGet(id int64) (SirenType, error) {
 			name,
 			radius,
 			note,
+			version,
 			created_at,
 			updated_at
 		FROM
 			siren_types
 		WHERE
 			id = $1
-	`, id).Scan(&sirenType.Name, &sirenType.Radius, &sirenType.Note, &sirenType.CreatedAt, &sirenType.UpdatedAt)
+	`, id).Scan(&sirenType.Name, &sirenType.Radius, &sirenType.Note, &sirenType.Version, &sirenType.CreatedAt, &sirenType.UpdatedAt)
 	if err != nil {
 		errmsg("SirenTypeGet QueryRow", err)
 	}
@@ -106,7 +108,18 @@ func SirenTypeSelectGet() ([]SelectItem, error) {
 
 // SirenTypeInsert - create new sirenType
 func SirenTypeInsert(sirenType SirenType) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return SirenTypeInsertCtx(context.Background(), sirenType)
+}
+
+// SirenTypeInsertCtx - SirenTypeInsert with context, actor of context is written to audit log
+func SirenTypeInsertCtx(ctx context.Context, sirenType SirenType) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("SirenTypeInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	err = tx.QueryRow(ctx, `
 		INSERT INTO siren_types
 		(
 			name,
@@ -134,27 +147,55 @@ func SirenTypeInsert(sirenType SirenType) (int64, error) {
 
 // SirenTypeUpdate - save sirenType changes
 func SirenTypeUpdate(sirenType SirenType) error {
-	_, err := pool.Exec(context.Background(), `
+	return SirenTypeUpdateCtx(context.Background(), sirenType)
+}
+
+// SirenTypeUpdateCtx - SirenTypeUpdate with context, actor of context is written to audit log
+func SirenTypeUpdateCtx(ctx context.Context, sirenType SirenType) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("SirenTypeUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
 		UPDATE siren_types SET
 			name = $2,
 			radius = $3,
 			note = $4,
-			updated_at = $5
+			updated_at = $5,
+			version = version + 1
 		WHERE
 			id = $1
-	`, sirenType.Name, sirenType.Radius, sirenType.Note, time.Now())
+		AND
+			version = $6
+	`, sirenType.Name, sirenType.Radius, sirenType.Note, time.Now(), sirenType.Version)
 	if err != nil {
 		errmsg("SirenTypeUpdate Exec", err)
+		return err
 	}
-	return err
+	return versionCheck("siren_types", sirenType.ID, sirenType.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return SirenTypeGet(sirenType.ID)
+	})
 }
 
 // SirenTypeDelete - delete sirenType by id
 func SirenTypeDelete(id int64) error {
+	return SirenTypeDeleteCtx(context.Background(), id)
+}
+
+// SirenTypeDeleteCtx - SirenTypeDelete with context, actor of context is written to audit log
+func SirenTypeDeleteCtx(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("SirenTypeDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			siren_types
 		WHERE
@@ -174,6 +215,7 @@ func sirenTypeCreateTable() error {
 				name       text,
 				radius     bigint,
 				note       text,
+				version    bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
 				UNIQUE(name, radius)
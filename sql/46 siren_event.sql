@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS
+    siren_events (
+        id         bigserial PRIMARY KEY,
+        siren_id   bigint,
+        event_date date,
+        event_type text,
+        result     bool NOT NULL DEFAULT true,
+        contact_id bigint,
+        note       text,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now()
+    );
+
+ALTER TABLE siren_events OWNER TO eddsuser;
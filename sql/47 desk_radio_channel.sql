@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS
+    radio_channels (
+        id         bigserial PRIMARY KEY,
+        name       text,
+        frequency  text,
+        note       text,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now(),
+        UNIQUE(name)
+    );
+
+CREATE TABLE IF NOT EXISTS
+    desks (
+        id         bigserial PRIMARY KEY,
+        name       text,
+        address    text,
+        contact_id bigint,
+        note       text,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now(),
+        UNIQUE(name)
+    );
+
+CREATE TABLE IF NOT EXISTS
+    desk_radio_channels (
+        desk_id          bigint,
+        radio_channel_id bigint,
+        PRIMARY KEY(desk_id, radio_channel_id)
+    );
+
+ALTER TABLE radio_channels OWNER TO eddsuser;
+ALTER TABLE desks OWNER TO eddsuser;
+ALTER TABLE desk_radio_channels OWNER TO eddsuser;
+
+ALTER TABLE sirens ADD COLUMN radio_channel_id bigint;
+ALTER TABLE sirens ADD COLUMN desk_id bigint;
+
+INSERT INTO radio_channels (name, created_at, updated_at)
+    SELECT DISTINCT trim(radio), now(), now() FROM sirens WHERE trim(radio) <> ''
+    ON CONFLICT DO NOTHING;
+INSERT INTO desks (name, created_at, updated_at)
+    SELECT DISTINCT trim(desk), now(), now() FROM sirens WHERE trim(desk) <> ''
+    ON CONFLICT DO NOTHING;
+
+UPDATE sirens AS s SET radio_channel_id = r.id FROM radio_channels AS r WHERE trim(s.radio) = r.name;
+UPDATE sirens AS s SET desk_id = d.id FROM desks AS d WHERE trim(s.desk) = d.name;
+UPDATE sirens SET radio_channel_id = 0 WHERE radio_channel_id IS NULL;
+UPDATE sirens SET desk_id = 0 WHERE desk_id IS NULL;
+
+INSERT INTO desk_radio_channels (desk_id, radio_channel_id)
+    SELECT DISTINCT desk_id, radio_channel_id FROM sirens WHERE desk_id > 0 AND radio_channel_id > 0
+    ON CONFLICT DO NOTHING;
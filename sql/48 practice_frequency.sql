@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS
+    practice_frequencies (
+        id         bigserial PRIMARY KEY,
+        kind_id    bigint,
+        scope_id   bigint NOT NULL DEFAULT 0,
+        months     bigint,
+        note       text,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now(),
+        UNIQUE(kind_id, scope_id)
+    );
+
+ALTER TABLE practice_frequencies OWNER TO eddsuser;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS
+    practice_plans (
+        id          bigserial PRIMARY KEY,
+        company_id  bigint,
+        kind_id     bigint,
+        plan_date   date,
+        cancelled   bool NOT NULL DEFAULT false,
+        practice_id bigint NOT NULL DEFAULT 0,
+        note        text,
+        created_at  TIMESTAMP without time zone,
+        updated_at  TIMESTAMP without time zone default now()
+    );
+
+ALTER TABLE practice_plans OWNER TO eddsuser;
@@ -0,0 +1,18 @@
+ALTER TABLE practices ADD COLUMN participants bigint NOT NULL DEFAULT 0;
+ALTER TABLE practices ADD COLUMN equipment text;
+ALTER TABLE practices ADD COLUMN rating bigint NOT NULL DEFAULT 0;
+ALTER TABLE practices ADD COLUMN remarks text;
+ALTER TABLE practices ADD COLUMN deadline date;
+
+CREATE TABLE IF NOT EXISTS
+    practice_participants (
+        id          bigserial PRIMARY KEY,
+        practice_id bigint,
+        contact_id  bigint,
+        role        text,
+        created_at  TIMESTAMP without time zone,
+        updated_at  TIMESTAMP without time zone default now(),
+        UNIQUE(practice_id, contact_id)
+    );
+
+ALTER TABLE practice_participants OWNER TO eddsuser;
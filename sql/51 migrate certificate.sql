@@ -0,0 +1,4 @@
+ALTER TABLE posts ADD COLUMN validity bigint NOT NULL DEFAULT 0;
+ALTER TABLE certificates ADD COLUMN post_id bigint;
+ALTER TABLE certificates ADD COLUMN validity bigint NOT NULL DEFAULT 0;
+ALTER TABLE certificates ADD COLUMN expiry_date date;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS
+    certificate_series (
+        id         bigserial PRIMARY KEY,
+        name       text,
+        pattern    text,
+        note       text,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now(),
+        UNIQUE(name)
+    );
+
+CREATE TABLE IF NOT EXISTS
+    certificate_series_counters (
+        series_id bigint,
+        period    bigint,
+        value     bigint NOT NULL DEFAULT 0,
+        PRIMARY KEY(series_id, period)
+    );
+
+ALTER TABLE certificate_series OWNER TO eddsuser;
+ALTER TABLE certificate_series_counters OWNER TO eddsuser;
+
+ALTER TABLE certificates ADD COLUMN series_id bigint NOT NULL DEFAULT 0;
+ALTER TABLE certificates ADD COLUMN period bigint NOT NULL DEFAULT 0;
+ALTER TABLE certificates ADD COLUMN seq bigint NOT NULL DEFAULT 0;
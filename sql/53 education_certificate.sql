@@ -0,0 +1,5 @@
+ALTER TABLE educations ADD COLUMN completed bool NOT NULL DEFAULT false;
+
+ALTER TABLE certificates ADD COLUMN education_id bigint NOT NULL DEFAULT 0;
+
+UPDATE educations SET completed = true WHERE end_date < now();
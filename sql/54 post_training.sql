@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS
+    post_trainings (
+        id         bigserial PRIMARY KEY,
+        post_id    bigint,
+        course_id  bigint NOT NULL DEFAULT 0,
+        months     bigint NOT NULL DEFAULT 0,
+        note       text,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now(),
+        UNIQUE(post_id, course_id)
+    );
+
+ALTER TABLE post_trainings OWNER TO eddsuser;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS
+    course_sessions (
+        id         bigserial PRIMARY KEY,
+        name       text,
+        start_date date,
+        end_date   date,
+        post_id    bigint,
+        capacity   bigint NOT NULL DEFAULT 0,
+        completed  bool NOT NULL DEFAULT false,
+        note       text,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now()
+    );
+
+CREATE TABLE IF NOT EXISTS
+    course_members (
+        id           bigserial PRIMARY KEY,
+        session_id   bigint,
+        contact_id   bigint,
+        status       text,
+        attended     bool NOT NULL DEFAULT false,
+        passed       bool NOT NULL DEFAULT false,
+        exam_result  text NOT NULL DEFAULT '',
+        education_id bigint NOT NULL DEFAULT 0,
+        created_at   TIMESTAMP without time zone,
+        updated_at   TIMESTAMP without time zone default now(),
+        UNIQUE(session_id, contact_id)
+    );
+
+ALTER TABLE course_sessions OWNER TO eddsuser;
+
+ALTER TABLE course_members OWNER TO eddsuser;
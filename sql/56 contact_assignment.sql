@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS
+    contact_assignments (
+        id         bigserial PRIMARY KEY,
+        contact_id bigint,
+        company_id bigint NOT NULL DEFAULT 0,
+        post_id    bigint NOT NULL DEFAULT 0,
+        post_go_id bigint NOT NULL DEFAULT 0,
+        rank_id    bigint NOT NULL DEFAULT 0,
+        start_date date,
+        end_date   date,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now()
+    );
+
+CREATE INDEX IF NOT EXISTS contact_assignments_contact_id_idx ON contact_assignments (contact_id);
+
+CREATE INDEX IF NOT EXISTS contact_assignments_company_id_idx ON contact_assignments (company_id);
+
+INSERT INTO contact_assignments (contact_id, company_id, post_id, post_go_id, rank_id, created_at, updated_at)
+SELECT
+    id,
+    COALESCE(company_id, 0),
+    COALESCE(post_id, 0),
+    COALESCE(post_go_id, 0),
+    COALESCE(rank_id, 0),
+    now(),
+    now()
+FROM
+    contacts
+WHERE
+    COALESCE(company_id, 0) <> 0
+OR
+    COALESCE(post_id, 0) <> 0
+OR
+    COALESCE(post_go_id, 0) <> 0
+OR
+    COALESCE(rank_id, 0) <> 0;
+
+ALTER TABLE contact_assignments OWNER TO eddsuser;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS
+    merge_audits (
+        id           bigserial PRIMARY KEY,
+        entity       text,
+        survivor_id  bigint,
+        duplicate_id bigint,
+        merged       jsonb,
+        created_at   TIMESTAMP without time zone default now()
+    );
+
+ALTER TABLE merge_audits OWNER TO eddsuser;
@@ -0,0 +1,3 @@
+ALTER TABLE companies ADD COLUMN parent_id bigint NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS companies_parent_id_idx ON companies (parent_id);
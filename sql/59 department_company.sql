@@ -0,0 +1,39 @@
+ALTER TABLE departments ADD COLUMN company_id bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE departments ADD COLUMN parent_id bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE departments DROP CONSTRAINT IF EXISTS departments_name_key;
+
+INSERT INTO departments (name, company_id, note, created_at, updated_at)
+SELECT DISTINCT ON (d.name, c.company_id)
+    d.name,
+    c.company_id,
+    d.note,
+    now(),
+    now()
+FROM
+    contacts AS c
+INNER JOIN
+    departments AS d ON d.id = c.department_id
+WHERE
+    d.company_id = 0
+AND
+    COALESCE(c.company_id, 0) <> 0;
+
+UPDATE contacts AS c SET
+    department_id = nd.id
+FROM
+    departments AS d,
+    departments AS nd
+WHERE
+    d.id = c.department_id
+AND
+    d.company_id = 0
+AND
+    nd.company_id = c.company_id
+AND
+    nd.name = d.name;
+
+ALTER TABLE departments ADD CONSTRAINT departments_company_id_parent_id_name_key UNIQUE (company_id, parent_id, name);
+
+CREATE INDEX IF NOT EXISTS departments_company_id_idx ON departments (company_id);
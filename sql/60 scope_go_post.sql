@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS
+    scope_go_posts (
+        id         bigserial PRIMARY KEY,
+        scope_id   bigint,
+        post_id    bigint,
+        note       text,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now(),
+        UNIQUE(scope_id, post_id)
+    );
+
+CREATE TABLE IF NOT EXISTS
+    company_go_roles (
+        id         bigserial PRIMARY KEY,
+        company_id bigint,
+        post_id    bigint,
+        contact_id bigint,
+        note       text,
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now(),
+        UNIQUE(company_id, post_id, contact_id)
+    );
+
+ALTER TABLE scope_go_posts OWNER TO eddsuser;
+
+ALTER TABLE company_go_roles OWNER TO eddsuser;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS
+    addresses (
+        id         bigserial PRIMARY KEY,
+        region     text NOT NULL DEFAULT '',
+        district   text NOT NULL DEFAULT '',
+        locality   text NOT NULL DEFAULT '',
+        street     text NOT NULL DEFAULT '',
+        house      text NOT NULL DEFAULT '',
+        building   text NOT NULL DEFAULT '',
+        entrance   text NOT NULL DEFAULT '',
+        display    text NOT NULL DEFAULT '',
+        created_at TIMESTAMP without time zone,
+        updated_at TIMESTAMP without time zone default now()
+    );
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS address_id bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE sirens ADD COLUMN IF NOT EXISTS address_id bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE hideouts ADD COLUMN IF NOT EXISTS address_id bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE tccs ADD COLUMN IF NOT EXISTS address_id bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE addresses OWNER TO eddsuser;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS
+    address_registers (
+        id           bigserial PRIMARY KEY,
+        source       text NOT NULL DEFAULT '',
+        region       text NOT NULL DEFAULT '',
+        district     text NOT NULL DEFAULT '',
+        locality     text NOT NULL DEFAULT '',
+        street       text NOT NULL DEFAULT '',
+        house        text NOT NULL DEFAULT '',
+        building     text NOT NULL DEFAULT '',
+        latitude     double precision,
+        longitude    double precision,
+        locality_key text NOT NULL DEFAULT '',
+        street_key   text NOT NULL DEFAULT '',
+        house_key    text NOT NULL DEFAULT '',
+        created_at   TIMESTAMP without time zone,
+        updated_at   TIMESTAMP without time zone default now()
+    );
+
+CREATE INDEX IF NOT EXISTS
+    address_registers_key_idx
+ON
+    address_registers (locality_key, street_key, house_key);
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS latitude text;
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS longitude text;
+
+ALTER TABLE hideouts ADD COLUMN IF NOT EXISTS latitude text;
+
+ALTER TABLE hideouts ADD COLUMN IF NOT EXISTS longitude text;
+
+ALTER TABLE address_registers OWNER TO eddsuser;
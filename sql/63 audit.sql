@@ -0,0 +1,352 @@
+CREATE TABLE IF NOT EXISTS
+    audit_logs (
+        id         bigserial PRIMARY KEY,
+        actor      text NOT NULL DEFAULT '',
+        entity     text NOT NULL,
+        record_id  bigint,
+        operation  text NOT NULL,
+        before     jsonb,
+        after      jsonb,
+        created_at TIMESTAMP without time zone default now()
+    );
+
+CREATE INDEX IF NOT EXISTS
+    audit_logs_record_idx
+ON
+    audit_logs (entity, record_id);
+
+CREATE OR REPLACE FUNCTION audit_log_trigger() RETURNS trigger AS $$
+DECLARE
+    old_row    jsonb;
+    new_row    jsonb;
+    before_row jsonb;
+    after_row  jsonb;
+    field      text;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW);
+    END IF;
+    IF TG_OP = 'UPDATE' THEN
+        before_row := '{}';
+        after_row := '{}';
+        FOR field IN SELECT jsonb_object_keys(new_row) LOOP
+            IF field <> 'updated_at' AND new_row->field IS DISTINCT FROM old_row->field THEN
+                before_row := before_row || jsonb_build_object(field, old_row->field);
+                after_row := after_row || jsonb_build_object(field, new_row->field);
+            END IF;
+        END LOOP;
+        IF before_row = '{}' THEN
+            RETURN NULL;
+        END IF;
+    ELSE
+        before_row := old_row;
+        after_row := new_row;
+    END IF;
+    INSERT INTO audit_logs
+        (actor, entity, record_id, operation, before, after, created_at)
+    VALUES
+        (
+            COALESCE(NULLIF(current_setting('edc.actor', true), ''), current_user),
+            TG_TABLE_NAME,
+            (COALESCE(new_row, old_row)->>'id')::bigint,
+            lower(TG_OP),
+            before_row,
+            after_row,
+            now()
+        );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log ON addresses;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    addresses
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON certificate_series;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    certificate_series
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON certificates;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    certificates
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON companies;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    companies
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON company_go_roles;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    company_go_roles
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON contact_assignments;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    contact_assignments
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON contacts;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    contacts
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON course_members;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    course_members
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON course_sessions;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    course_sessions
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON departments;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    departments
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON desk_radio_channels;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    desk_radio_channels
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON desks;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    desks
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON educations;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    educations
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON emails;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    emails
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON hideout_types;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    hideout_types
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON hideouts;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    hideouts
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON kinds;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    kinds
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON phones;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    phones
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON post_trainings;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    post_trainings
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON posts;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    posts
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON practice_frequencies;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    practice_frequencies
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON practice_participants;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    practice_participants
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON practice_plans;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    practice_plans
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON practices;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    practices
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON radio_channels;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    radio_channels
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON ranks;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    ranks
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON scope_go_posts;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    scope_go_posts
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON scopes;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    scopes
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON siren_events;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    siren_events
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON siren_types;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    siren_types
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON sirens;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    sirens
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+DROP TRIGGER IF EXISTS audit_log ON tccs;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    tccs
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger();
+
+ALTER TABLE audit_logs OWNER TO eddsuser;
@@ -0,0 +1,15 @@
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP without time zone;
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP without time zone;
+
+ALTER TABLE practices ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP without time zone;
+
+ALTER TABLE sirens ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP without time zone;
+
+ALTER TABLE hideouts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP without time zone;
+
+ALTER TABLE tccs ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP without time zone;
+
+ALTER TABLE educations ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP without time zone;
+
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP without time zone;
@@ -0,0 +1,283 @@
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE certificate_series ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE course_members ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE course_sessions ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE desks ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE educations ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE hideouts ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE kinds ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE post_trainings ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE practice_frequencies ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE practice_plans ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE practices ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE radio_channels ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE ranks ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE scope_go_posts ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE scopes ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE siren_events ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE siren_types ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE sirens ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE tccs ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION version_bump() RETURNS trigger AS $$
+BEGIN
+    IF NEW.version = OLD.version THEN
+        NEW.version := OLD.version + 1;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS version_bump ON addresses;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    addresses
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON certificate_series;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    certificate_series
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON certificates;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    certificates
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON companies;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    companies
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON contacts;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    contacts
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON course_members;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    course_members
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON course_sessions;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    course_sessions
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON departments;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    departments
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON desks;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    desks
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON educations;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    educations
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON hideouts;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    hideouts
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON kinds;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    kinds
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON post_trainings;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    post_trainings
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON posts;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    posts
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON practice_frequencies;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    practice_frequencies
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON practice_plans;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    practice_plans
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON practices;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    practices
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON radio_channels;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    radio_channels
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON ranks;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    ranks
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON scope_go_posts;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    scope_go_posts
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON scopes;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    scopes
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON siren_events;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    siren_events
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON siren_types;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    siren_types
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON sirens;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    sirens
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
+
+DROP TRIGGER IF EXISTS version_bump ON tccs;
+
+CREATE TRIGGER
+    version_bump
+BEFORE UPDATE ON
+    tccs
+FOR EACH ROW EXECUTE PROCEDURE
+    version_bump();
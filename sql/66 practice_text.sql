@@ -0,0 +1,6 @@
+UPDATE practices SET equipment = '' WHERE equipment IS NULL;
+UPDATE practices SET remarks = '' WHERE remarks IS NULL;
+ALTER TABLE practices ALTER COLUMN equipment SET DEFAULT '';
+ALTER TABLE practices ALTER COLUMN equipment SET NOT NULL;
+ALTER TABLE practices ALTER COLUMN remarks SET DEFAULT '';
+ALTER TABLE practices ALTER COLUMN remarks SET NOT NULL;
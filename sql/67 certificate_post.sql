@@ -0,0 +1,3 @@
+UPDATE certificates SET post_id = 0 WHERE post_id IS NULL;
+ALTER TABLE certificates ALTER COLUMN post_id SET DEFAULT 0;
+ALTER TABLE certificates ALTER COLUMN post_id SET NOT NULL;
@@ -0,0 +1,6 @@
+UPDATE educations AS e SET
+    completed = false
+WHERE
+    e.completed
+AND
+    NOT EXISTS (SELECT 1 FROM certificates AS c WHERE c.education_id = e.id);
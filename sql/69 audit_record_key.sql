@@ -0,0 +1,54 @@
+CREATE OR REPLACE FUNCTION audit_log_trigger() RETURNS trigger AS $$
+DECLARE
+    old_row    jsonb;
+    new_row    jsonb;
+    before_row jsonb;
+    after_row  jsonb;
+    field      text;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW);
+    END IF;
+    IF TG_OP = 'UPDATE' THEN
+        before_row := '{}';
+        after_row := '{}';
+        FOR field IN SELECT jsonb_object_keys(new_row) LOOP
+            IF field <> 'updated_at' AND new_row->field IS DISTINCT FROM old_row->field THEN
+                before_row := before_row || jsonb_build_object(field, old_row->field);
+                after_row := after_row || jsonb_build_object(field, new_row->field);
+            END IF;
+        END LOOP;
+        IF before_row = '{}' THEN
+            RETURN NULL;
+        END IF;
+    ELSE
+        before_row := old_row;
+        after_row := new_row;
+    END IF;
+    INSERT INTO audit_logs
+        (actor, entity, record_id, operation, before, after, created_at)
+    VALUES
+        (
+            COALESCE(NULLIF(current_setting('edc.actor', true), ''), current_user),
+            TG_TABLE_NAME,
+            (COALESCE(new_row, old_row)->>COALESCE(TG_ARGV[0], 'id'))::bigint,
+            lower(TG_OP),
+            before_row,
+            after_row,
+            now()
+        );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log ON desk_radio_channels;
+
+CREATE TRIGGER
+    audit_log
+AFTER INSERT OR UPDATE OR DELETE ON
+    desk_radio_channels
+FOR EACH ROW EXECUTE PROCEDURE
+    audit_log_trigger('desk_id');
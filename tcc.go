@@ -9,9 +9,11 @@ import (
 type Tcc struct {
 	ID        int64  `sql:"id"         json:"id"         form:"id"         query:"id"`
 	Address   string `sql:"address"    json:"address"    form:"address"    query:"address"`
+	AddressID int64  `sql:"address_id" json:"address_id" form:"address_id" query:"address_id"`
 	ContactID int64  `sql:"contact_id" json:"contact_id" form:"contact_id" query:"contact_id"`
 	CompanyID int64  `sql:"company_id" json:"company_id" form:"company_id" query:"company_id"`
 	Note      string `sql:"note"       json:"note"       form:"note"       query:"note"`
+	Version   int64  `sql:"version"    json:"version"    form:"version"    query:"version"`
 	CreatedAt string `sql:"created_at" json:"-"`
 	UpdatedAt string `sql:"updated_at" json:"-"`
 }
@@ -34,16 +36,18 @@ func TccGet(id int64) (Tcc, error) {
 	err := pool.QueryRow(context.Background(), `
 		SELECT
 			address,
+			address_id,
 			contact_id,
 			company_id,
 			note,
+			version,
 			created_at,
 			updated_at
 		FROM
 			tccs
 		WHERE
 			id = $1
-	`, id).Scan(&tcc.Address, &tcc.Address, &tcc.ContactID, &tcc.CompanyID, &tcc.Note, &tcc.CreatedAt, &tcc.UpdatedAt)
+	`, id).Scan(&tcc.Address, &tcc.AddressID, &tcc.ContactID, &tcc.CompanyID, &tcc.Note, &tcc.Version, &tcc.CreatedAt, &tcc.UpdatedAt)
 	if err != nil {
 		errmsg("GetTcc select", err)
 	}
@@ -58,11 +62,13 @@ func TccListGet() ([]TccList, error) {
 			id,
 			address,
 			contact_id,
-			note,
+			note
 		FROM
 			tccs
+		WHERE
+			deleted_at IS NULL
 		ORDER BY
-			name ASC
+			address ASC
 	`)
 	if err != nil {
 		errmsg("TccListGet Query", err)
@@ -81,10 +87,27 @@ func TccListGet() ([]TccList, error) {
 
 // TccInsert - create new tcc
 func TccInsert(tcc Tcc) (int64, error) {
-	err := pool.QueryRow(context.Background(), `
+	return TccInsertCtx(context.Background(), tcc)
+}
+
+// TccInsertCtx - TccInsert with context, actor of context is written to audit log
+func TccInsertCtx(ctx context.Context, tcc Tcc) (_ int64, err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("TccInsert auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tcc.AddressID, err = addressResolve(ctx, tx, "tccs", 0, tcc.Address)
+	if err != nil {
+		errmsg("CreateTcc addressResolve", err)
+		return 0, err
+	}
+	err = tx.QueryRow(ctx, `
 		INSERT INTO tccs
 		(
 			address,
+			address_id,
 			contact_id,
 			company_id,
 			note,
@@ -98,11 +121,12 @@ func TccInsert(tcc Tcc) (int64, error) {
 			$3,
 			$4,
 			$5,
-			$6
+			$6,
+			$7
 		)
 		RETURNING
 			id
-	`, tcc.Address, tcc.ContactID, tcc.CompanyID, tcc.Note, time.Now(), time.Now()).Scan(&tcc.ID)
+	`, tcc.Address, tcc.AddressID, tcc.ContactID, tcc.CompanyID, tcc.Note, time.Now(), time.Now()).Scan(&tcc.ID)
 	if err != nil {
 		errmsg("CreateTcc insert", err)
 	}
@@ -111,28 +135,70 @@ func TccInsert(tcc Tcc) (int64, error) {
 
 // TccUpdate - save tcc changes
 func TccUpdate(tcc Tcc) error {
-	_, err := pool.Exec(context.Background(), `
+	return TccUpdateCtx(context.Background(), tcc)
+}
+
+// TccUpdateCtx - TccUpdate with context, actor of context is written to audit log
+func TccUpdateCtx(ctx context.Context, tcc Tcc) (err error) {
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("TccUpdate auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	tag, err := tx.Exec(ctx, `
 		UPDATE tccs SET
 			address = $2,
+			address_id = CASE WHEN address IS NOT DISTINCT FROM $2 THEN address_id ELSE 0 END,
 			contact_id = $3,
 			company_id = $4,
 			note = $5,
-			updated_at = $6
+			updated_at = $6,
+			version = version + 1
 		WHERE
 			id = $1
-	`, tcc.ID, tcc.Address, tcc.ContactID, tcc.CompanyID, tcc.Note, time.Now())
+		AND
+			version = $7
+	`, tcc.ID, tcc.Address, tcc.ContactID, tcc.CompanyID, tcc.Note, time.Now(), tcc.Version)
 	if err != nil {
 		errmsg("UpdateTcc update", err)
+		return err
+	}
+	err = versionCheck("tccs", tcc.ID, tcc.Version, tag.RowsAffected(), func() (interface{}, error) {
+		return TccGet(tcc.ID)
+	})
+	if err != nil {
+		return err
+	}
+	err = addressLink(ctx, tx, "tccs", tcc.ID, tcc.Address)
+	if err != nil {
+		errmsg("UpdateTcc addressLink", err)
 	}
 	return err
 }
 
-// TccDelete - delete tcc by id
+// TccDelete - move tcc to trash
 func TccDelete(id int64) error {
+	return TccDeleteCtx(context.Background(), id)
+}
+
+// TccDeleteCtx - TccDelete with context, actor of context is written to audit log
+func TccDeleteCtx(ctx context.Context, id int64) error {
+	return trashDelete(ctx, "tccs", id)
+}
+
+// tccPurge - delete tcc by id with child rows
+func tccPurge(ctx context.Context, id int64) (err error) {
 	if id == 0 {
 		return nil
 	}
-	_, err := pool.Exec(context.Background(), `
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("tccPurge auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
 		DELETE FROM
 			tccs
 		WHERE
@@ -150,9 +216,12 @@ func tccCreateTable() error {
 			tccs (
 				id         bigserial PRIMARY KEY,
 				address    text,
+				address_id bigint NOT NULL DEFAULT 0,
 				contact_id bigint,
 				company_id bigint,
 				note       text,
+				deleted_at TIMESTAMP without time zone,
+				version    bigint NOT NULL DEFAULT 0,
 				created_at TIMESTAMP without time zone,
 				updated_at TIMESTAMP without time zone default now(),
 				UNIQUE(num_id, num_pass, type_id)
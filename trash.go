@@ -0,0 +1,207 @@
+package edc
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrTrashEntity - entity has no trash
+var ErrTrashEntity = errors.New("entity has no soft delete")
+
+// ErrTrashRecord - record is missing or not in trash
+var ErrTrashRecord = errors.New("record is not in trash")
+
+// TrashRetention - deleted records older than retention in days are removed by TrashPurge with 0 days
+const TrashRetention = 30
+
+// TrashItem - deleted record in trash
+// Entity - table name of record
+type TrashItem struct {
+	Entity    string `json:"entity"     form:"entity"     query:"entity"`
+	ID        int64  `json:"id"         form:"id"         query:"id"`
+	Name      string `json:"name"       form:"name"       query:"name"`
+	DeletedAt string `json:"deleted_at" form:"deleted_at" query:"deleted_at"`
+}
+
+// trashEntities - tables with soft delete, name - sql expression shown in trash,
+// purge - hard delete of record with its child rows
+var trashEntities = []struct {
+	table string
+	name  string
+	purge func(context.Context, int64) error
+}{
+	{"contacts", "name", contactPurge},
+	{"companies", "name", companyPurge},
+	{"practices", "concat_ws(' ', date_of_practice::text, topic)", practicePurge},
+	{"sirens", "address", sirenPurge},
+	{"hideouts", "address", hideoutPurge},
+	{"tccs", "address", tccPurge},
+	{"educations", "concat_ws(' - ', start_date::text, end_date::text)", educationPurge},
+	{"certificates", "num", certificatePurge},
+}
+
+// trashDelete - move record to trash, child rows like emails and phones are kept with record
+func trashDelete(ctx context.Context, table string, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("trashDelete auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	_, err = tx.Exec(ctx, `
+		UPDATE `+pgx.Identifier{table}.Sanitize()+` SET
+			deleted_at = $2
+		WHERE
+			id = $1
+		AND
+			deleted_at IS NULL
+	`, id, time.Now())
+	if err != nil {
+		errmsg("trashDelete "+table, err)
+	}
+	return err
+}
+
+// TrashListGet - get deleted records of entity (table name), empty for all entities, latest deleted first
+func TrashListGet(entity string) ([]TrashItem, error) {
+	var items []TrashItem
+	for _, t := range trashEntities {
+		if entity != "" && entity != t.table {
+			continue
+		}
+		rows, err := pool.Query(context.Background(), `
+			SELECT
+				id,
+				COALESCE(`+t.name+`, ''),
+				deleted_at::text
+			FROM
+				`+pgx.Identifier{t.table}.Sanitize()+`
+			WHERE
+				deleted_at IS NOT NULL
+		`)
+		if err != nil {
+			errmsg("TrashListGet Query "+t.table, err)
+			return items, err
+		}
+		for rows.Next() {
+			item := TrashItem{Entity: t.table}
+			err := rows.Scan(&item.ID, &item.Name, &item.DeletedAt)
+			if err != nil {
+				rows.Close()
+				errmsg("TrashListGet Scan "+t.table, err)
+				return items, err
+			}
+			items = append(items, item)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			errmsg("TrashListGet rows "+t.table, rows.Err())
+			return items, rows.Err()
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt > items[j].DeletedAt
+	})
+	return items, nil
+}
+
+// TrashRestore - restore deleted record of entity (table name) with kept child rows,
+// ErrTrashRecord if record is not in trash
+func TrashRestore(entity string, id int64) error {
+	return TrashRestoreCtx(context.Background(), entity, id)
+}
+
+// TrashRestoreCtx - TrashRestore with context, actor of context is written to audit log
+func TrashRestoreCtx(ctx context.Context, entity string, id int64) (err error) {
+	if id == 0 {
+		return nil
+	}
+	tx, err := auditBegin(ctx)
+	if err != nil {
+		errmsg("TrashRestore auditBegin", err)
+		return
+	}
+	defer auditEnd(ctx, tx, &err)
+	for _, t := range trashEntities {
+		if t.table != entity {
+			continue
+		}
+		tag, err := tx.Exec(ctx, `
+			UPDATE `+pgx.Identifier{t.table}.Sanitize()+` SET
+				deleted_at = NULL,
+				updated_at = $2
+			WHERE
+				id = $1
+			AND
+				deleted_at IS NOT NULL
+		`, id, time.Now())
+		if err != nil {
+			errmsg("TrashRestore "+t.table, err)
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrTrashRecord
+		}
+		return nil
+	}
+	return ErrTrashEntity
+}
+
+// TrashPurge - remove records deleted more than days ago with child rows, 0 for TrashRetention.
+// Returns number of removed records.
+func TrashPurge(days int64) (int64, error) {
+	return TrashPurgeCtx(context.Background(), days)
+}
+
+// TrashPurgeCtx - TrashPurge with context, actor of context is written to audit log
+func TrashPurgeCtx(ctx context.Context, days int64) (int64, error) {
+	var count int64
+	if days == 0 {
+		days = TrashRetention
+	}
+	for _, t := range trashEntities {
+		rows, err := pool.Query(ctx, `
+			SELECT
+				id
+			FROM
+				`+pgx.Identifier{t.table}.Sanitize()+`
+			WHERE
+				deleted_at < $1
+		`, time.Now().AddDate(0, 0, -int(days)))
+		if err != nil {
+			errmsg("TrashPurge Query "+t.table, err)
+			return count, err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			err := rows.Scan(&id)
+			if err != nil {
+				rows.Close()
+				errmsg("TrashPurge Scan "+t.table, err)
+				return count, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			errmsg("TrashPurge rows "+t.table, rows.Err())
+			return count, rows.Err()
+		}
+		for _, id := range ids {
+			err = t.purge(ctx, id)
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,123 @@
+package edc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrConflict - record was changed by another user after it was read
+var ErrConflict = errors.New("record is changed by another user")
+
+// ConflictError - stale update, record version differs from version in database
+// Current - record as saved by another user, for example Company for CompanyUpdate
+type ConflictError struct {
+	Entity  string
+	ID      int64
+	Version int64
+	Current interface{}
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %d version %d: %v", e.Entity, e.ID, e.Version, ErrConflict)
+}
+
+// Unwrap - errors.Is(err, ErrConflict) reports true for ConflictError
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// versionTables - tables with version, version is incremented on every update
+var versionTables = []string{
+	"addresses",
+	"certificate_series",
+	"certificates",
+	"companies",
+	"contacts",
+	"course_members",
+	"course_sessions",
+	"departments",
+	"desks",
+	"educations",
+	"hideouts",
+	"kinds",
+	"post_trainings",
+	"posts",
+	"practice_frequencies",
+	"practice_plans",
+	"practices",
+	"radio_channels",
+	"ranks",
+	"scope_go_posts",
+	"scopes",
+	"siren_events",
+	"siren_types",
+	"sirens",
+	"tccs",
+}
+
+// versionCheck - return ConflictError with current record if update with version precondition changed no rows,
+// pgx.ErrNoRows if record is deleted
+func versionCheck(entity string, id, version, rows int64, current func() (interface{}, error)) error {
+	if rows != 0 {
+		return nil
+	}
+	record, err := current()
+	if err != nil {
+		return err
+	}
+	return &ConflictError{Entity: entity, ID: id, Version: version, Current: record}
+}
+
+// versionTrigger - trigger function increments version of row changed without update functions,
+// like merges, restores and geocoding
+const versionTrigger = `
+	CREATE OR REPLACE FUNCTION version_bump() RETURNS trigger AS $$
+	BEGIN
+		IF NEW.version = OLD.version THEN
+			NEW.version := OLD.version + 1;
+		END IF;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql
+`
+
+func versionCreateTable() error {
+	_, err := pool.Exec(context.Background(), versionTrigger)
+	if err != nil {
+		errmsg("versionCreateTable function", err)
+		return err
+	}
+	for _, table := range versionTables {
+		var exists bool
+		err = pool.QueryRow(context.Background(), `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists)
+		if err != nil {
+			errmsg("versionCreateTable to_regclass", err)
+			return err
+		}
+		if !exists {
+			continue
+		}
+		_, err = pool.Exec(context.Background(), `
+			DROP TRIGGER IF EXISTS version_bump ON `+pgx.Identifier{table}.Sanitize())
+		if err != nil {
+			errmsg("versionCreateTable drop trigger "+table, err)
+			return err
+		}
+		_, err = pool.Exec(context.Background(), `
+			CREATE TRIGGER
+				version_bump
+			BEFORE UPDATE ON
+				`+pgx.Identifier{table}.Sanitize()+`
+			FOR EACH ROW EXECUTE PROCEDURE
+				version_bump()
+		`)
+		if err != nil {
+			errmsg("versionCreateTable create trigger "+table, err)
+			return err
+		}
+	}
+	return nil
+}
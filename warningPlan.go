@@ -0,0 +1,246 @@
+package edc
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WarningPlan - staged siren activation plan
+// Stages - sirens grouped by stage (очередь) and siren type
+// Items  - ordered activation checklist
+type WarningPlan struct {
+	Stages []WarningPlanStage `json:"stages" form:"stages" query:"stages"`
+	Items  []WarningPlanItem  `json:"items"  form:"items"  query:"items"`
+}
+
+// WarningPlanStage - sirens of one activation stage
+// Coverage - estimated combined coverage of stage sirens in square kilometers
+type WarningPlanStage struct {
+	Stage    int64              `json:"stage"    form:"stage"    query:"stage"`
+	Count    int64              `json:"count"    form:"count"    query:"count"`
+	Coverage float64            `json:"coverage" form:"coverage" query:"coverage"`
+	Types    []WarningPlanTypes `json:"types"    form:"types"    query:"types"`
+}
+
+// WarningPlanTypes - count of sirens of one type in stage
+type WarningPlanTypes struct {
+	SirenTypeID   int64  `json:"siren_type_id"   form:"siren_type_id"   query:"siren_type_id"`
+	SirenTypeName string `json:"siren_type_name" form:"siren_type_name" query:"siren_type_name"`
+	Radius        int64  `json:"radius"          form:"radius"          query:"radius"`
+	Count         int64  `json:"count"           form:"count"           query:"count"`
+}
+
+// WarningPlanItem - one row of activation checklist
+type WarningPlanItem struct {
+	Order            int64   `json:"order"              form:"order"              query:"order"`
+	Stage            int64   `json:"stage"              form:"stage"              query:"stage"`
+	SirenID          int64   `json:"siren_id"           form:"siren_id"           query:"siren_id"`
+	SirenTypeID      int64   `json:"siren_type_id"      form:"siren_type_id"      query:"siren_type_id"`
+	SirenTypeName    string  `json:"siren_type_name"    form:"siren_type_name"    query:"siren_type_name"`
+	Radius           int64   `json:"radius"             form:"radius"             query:"radius"`
+	Address          string  `json:"address"            form:"address"            query:"address"`
+	DeskName         string  `json:"desk_name"          form:"desk_name"          query:"desk_name"`
+	RadioChannelName string  `json:"radio_channel_name" form:"radio_channel_name" query:"radio_channel_name"`
+	ContactID        int64   `json:"contact_id"         form:"contact_id"         query:"contact_id"`
+	ContactName      string  `json:"contact_name"       form:"contact_name"       query:"contact_name"`
+	Phones           []int64 `json:"phones"             form:"phones"             query:"phones"`
+	Latitude         string  `json:"-"`
+	Longitude        string  `json:"-"`
+}
+
+// WarningPlanGet - get staged siren activation plan
+func WarningPlanGet() (WarningPlan, error) {
+	var plan WarningPlan
+	rows, err := pool.Query(context.Background(), `
+		SELECT
+			s.id,
+			s.stage,
+			s.siren_type_id,
+			COALESCE(t.name, '') AS siren_type_name,
+			COALESCE(t.radius, 0) AS radius,
+			s.address,
+			COALESCE(d.name, '') AS desk_name,
+			COALESCE(r.name, '') AS radio_channel_name,
+			s.contact_id,
+			COALESCE(c.name, '') AS contact_name,
+			array_remove(array_agg(DISTINCT ph.phone), NULL) AS phones,
+			s.latitude,
+			s.longitude
+		FROM
+			sirens AS s
+		LEFT JOIN
+			siren_types AS t ON s.siren_type_id = t.id
+		LEFT JOIN
+			desks AS d ON s.desk_id = d.id
+		LEFT JOIN
+			radio_channels AS r ON s.radio_channel_id = r.id
+		LEFT JOIN
+			contacts AS c ON s.contact_id = c.id
+		LEFT JOIN
+			phones AS ph ON s.contact_id = ph.contact_id AND ph.fax = false
+		WHERE
+			s.deleted_at IS NULL
+		GROUP BY
+			s.id,
+			t.id,
+			d.name,
+			r.name,
+			c.name
+		ORDER BY
+			s.stage ASC,
+			desk_name ASC,
+			radio_channel_name ASC,
+			siren_type_name ASC,
+			s.address ASC
+	`)
+	if err != nil {
+		errmsg("WarningPlanGet Query", err)
+		return plan, err
+	}
+	for rows.Next() {
+		var item WarningPlanItem
+		err := rows.Scan(&item.SirenID, &item.Stage, &item.SirenTypeID, &item.SirenTypeName, &item.Radius, &item.Address,
+			&item.DeskName, &item.RadioChannelName, &item.ContactID, &item.ContactName, &item.Phones, &item.Latitude, &item.Longitude)
+		if err != nil {
+			errmsg("WarningPlanGet Scan", err)
+			return plan, err
+		}
+		item.Order = int64(len(plan.Items) + 1)
+		plan.Items = append(plan.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		errmsg("WarningPlanGet Rows", err)
+		return plan, err
+	}
+	plan.Stages = warningPlanStages(plan.Items)
+	return plan, nil
+}
+
+func warningPlanStages(items []WarningPlanItem) []WarningPlanStage {
+	var stages []WarningPlanStage
+	for i := 0; i < len(items); {
+		stage := WarningPlanStage{Stage: items[i].Stage}
+		var circles []coverageCircle
+		types := make(map[int64]int)
+		for ; i < len(items) && items[i].Stage == stage.Stage; i++ {
+			item := items[i]
+			stage.Count++
+			if j, ok := types[item.SirenTypeID]; ok {
+				stage.Types[j].Count++
+			} else {
+				types[item.SirenTypeID] = len(stage.Types)
+				stage.Types = append(stage.Types, WarningPlanTypes{
+					SirenTypeID:   item.SirenTypeID,
+					SirenTypeName: item.SirenTypeName,
+					Radius:        item.Radius,
+					Count:         1,
+				})
+			}
+			lat, errLat := parseCoordinate(item.Latitude)
+			lon, errLon := parseCoordinate(item.Longitude)
+			if errLat == nil && errLon == nil && item.Radius > 0 {
+				circles = append(circles, coverageCircle{lat: lat, lon: lon, radius: float64(item.Radius)})
+			}
+		}
+		stage.Coverage = coverageArea(circles) / 1e6
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+func parseCoordinate(s string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(strings.TrimSpace(s), ",", ".", 1), 64)
+}
+
+// coverageCircle - audibility circle of siren, radius in meters
+type coverageCircle struct {
+	lat    float64
+	lon    float64
+	radius float64
+}
+
+// coverageArea - estimate area of union of circles in square meters
+// by counting grid cells covered by at least one circle
+func coverageArea(circles []coverageCircle) float64 {
+	if len(circles) == 0 {
+		return 0
+	}
+	const earthRadius = 6371000.0
+	lat0 := circles[0].lat * math.Pi / 180
+	type point struct{ x, y, r float64 }
+	points := make([]point, len(circles))
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, c := range circles {
+		p := point{
+			x: c.lon * math.Pi / 180 * earthRadius * math.Cos(lat0),
+			y: c.lat * math.Pi / 180 * earthRadius,
+			r: c.radius,
+		}
+		points[i] = p
+		minX, maxX = math.Min(minX, p.x-p.r), math.Max(maxX, p.x+p.r)
+		minY, maxY = math.Min(minY, p.y-p.r), math.Max(maxY, p.y+p.r)
+	}
+	step := math.Max(math.Max(maxX-minX, maxY-minY)/500, 1)
+	var cells int64
+	for y := minY + step/2; y < maxY; y += step {
+		for x := minX + step/2; x < maxX; x += step {
+			for _, p := range points {
+				if (x-p.x)*(x-p.x)+(y-p.y)*(y-p.y) <= p.r*p.r {
+					cells++
+					break
+				}
+			}
+		}
+	}
+	return float64(cells) * step * step
+}
+
+var warningPlanTemplate = template.Must(template.New("warningPlan").Funcs(template.FuncMap{
+	"coverage": func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) },
+	"phones": func(phones []int64) string {
+		list := make([]string, len(phones))
+		for i := range phones {
+			list[i] = strconv.FormatInt(phones[i], 10)
+		}
+		return strings.Join(list, ", ")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>План оповещения</title>
+<style>
+body { font-family: serif; font-size: 12pt; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1em; }
+th, td { border: 1px solid #000; padding: 2px 4px; }
+@media print { h2 { page-break-before: always; } h2:first-of-type { page-break-before: avoid; } }
+</style>
+</head>
+<body>
+<h1>План оповещения</h1>
+<table>
+<tr><th>Очередь</th><th>Тип сирены</th><th>Радиус, м</th><th>Количество</th><th>Охват, км²</th></tr>
+{{range .Stages}}{{$stage := .}}{{range $i, $t := .Types}}<tr>{{if eq $i 0}}<td rowspan="{{len $stage.Types}}">{{$stage.Stage}}</td>{{end}}<td>{{$t.SirenTypeName}}</td><td>{{$t.Radius}}</td><td>{{$t.Count}}</td>{{if eq $i 0}}<td rowspan="{{len $stage.Types}}">{{coverage $stage.Coverage}}</td>{{end}}</tr>
+{{end}}{{end}}</table>
+{{range .Stages}}{{$stage := .Stage}}<h2>Очередь {{$stage}}</h2>
+<table>
+<tr><th>№</th><th>Адрес</th><th>Тип сирены</th><th>Пульт</th><th>Радиоканал</th><th>Ответственный</th><th>Телефоны</th><th>Отметка</th></tr>
+{{range $.Items}}{{if eq .Stage $stage}}<tr><td>{{.Order}}</td><td>{{.Address}}</td><td>{{.SirenTypeName}}</td><td>{{.DeskName}}</td><td>{{.RadioChannelName}}</td><td>{{.ContactName}}</td><td>{{phones .Phones}}</td><td></td></tr>
+{{end}}{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// WarningPlanExport - write warning plan as printable html document
+func WarningPlanExport(w io.Writer, plan WarningPlan) error {
+	err := warningPlanTemplate.Execute(w, plan)
+	if err != nil {
+		errmsg("WarningPlanExport Execute", err)
+	}
+	return err
+}